@@ -19,11 +19,14 @@ package app
 import (
 	"context"
 	"flag"
+	"net"
 	"runtime/debug"
 
 	"github.com/spf13/cobra"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -47,6 +50,8 @@ var (
 func init() {
 	utilruntime.Must(corev1.AddToScheme(scheme))
 	utilruntime.Must(appsv1.AddToScheme(scheme))
+	utilruntime.Must(networkingv1.AddToScheme(scheme))
+	utilruntime.Must(policyv1.AddToScheme(scheme))
 	utilruntime.Must(v1alpha1.AddToScheme(scheme))
 }
 
@@ -112,11 +117,12 @@ func run(ctx context.Context, opts *options.Options) error {
 	if namespace == "" {
 		namespace = "default"
 	}
-	etcdSecret := &corev1.Secret{}
-	if err := mgr.GetClient().Get(ctx, types.NamespacedName{
+	etcdSecret := types.NamespacedName{
 		Namespace: namespace,
 		Name:      name,
-	}, etcdSecret); err != nil {
+	}
+	// fail fast on a missing secret, the controller reads it on every use
+	if err := mgr.GetClient().Get(ctx, etcdSecret, &corev1.Secret{}); err != nil {
 		if apierrors.IsNotFound(err) {
 			klog.ErrorS(err, "secret[etcd-secret] not exists")
 			return err
@@ -125,10 +131,24 @@ func run(ctx context.Context, opts *options.Options) error {
 		return err
 	}
 
+	// the pools are validated with the options
+	var serviceCIDRPool, podCIDRPool *net.IPNet
+	if opts.ServiceCIDRPool != "" {
+		_, serviceCIDRPool, _ = net.ParseCIDR(opts.ServiceCIDRPool)
+	}
+	if opts.PodCIDRPool != "" {
+		_, podCIDRPool, _ = net.ParseCIDR(opts.PodCIDRPool)
+	}
+
 	if err = (&controllers.TenantController{
-		EtcdSecret:  etcdSecret.Data,
-		EtcdServers: opts.EtcdServers,
-		Client:      mgr.GetClient(),
+		EtcdSecret:          etcdSecret,
+		EtcdServers:         opts.EtcdServers,
+		Client:              mgr.GetClient(),
+		APIReader:           mgr.GetAPIReader(),
+		ServiceCIDRPool:     serviceCIDRPool,
+		ServiceCIDRMaskSize: opts.ServiceCIDRMaskSize,
+		PodCIDRPool:         podCIDRPool,
+		PodCIDRMaskSize:     opts.PodCIDRMaskSize,
 	}).SetupWithManager(mgr, controller.Options{
 		MaxConcurrentReconciles: opts.ConcurrencyTenantSync,
 	}); err != nil {
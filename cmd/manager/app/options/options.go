@@ -17,6 +17,8 @@ limitations under the License.
 package options
 
 import (
+	"fmt"
+	"net"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -32,6 +34,11 @@ type Options struct {
 	EtcdSecret            string
 	ConcurrencyTenantSync int
 
+	ServiceCIDRPool     string
+	ServiceCIDRMaskSize int
+	PodCIDRPool         string
+	PodCIDRMaskSize     int
+
 	Log            *logs.Options
 	LeaderElection *componentbaseconfig.LeaderElectionConfiguration
 }
@@ -51,13 +58,22 @@ func (o *Options) AddFlags(flags *pflag.FlagSet) {
 	o.Log.AddFlags(flags)
 
 	flags.StringVar(&o.EtcdServers, "etcd-servers", "",
-		"Etcd servers, used for tenant apiserver connect to host etcd clusters, use ',' to separate.")
+		"Etcd servers, used for tenant apiserver connect to host etcd clusters, use ',' to separate. Tenants are placed on EtcdBackends instead once any exists.")
 	flags.StringVar(&o.EtcdSecret, "etcd-secret", "",
 		"Reference of etcd secret, use [namespace]/[name] or [name](use default namespace).")
 
 	flags.IntVar(&o.ConcurrencyTenantSync, "concurrency-tenant-sync", 10,
 		"Concurrency of tenant controllers to sync.")
 
+	flags.StringVar(&o.ServiceCIDRPool, "service-cidr-pool", "",
+		"Pool the service cidrs of the tenants are allocated from, unless set in their spec. Tenants use 10.101.0.0/16 if empty.")
+	flags.IntVar(&o.ServiceCIDRMaskSize, "service-cidr-mask-size", 20,
+		"Prefix length of the service cidrs allocated from the service-cidr-pool.")
+	flags.StringVar(&o.PodCIDRPool, "pod-cidr-pool", "",
+		"Pool the pod cidrs of the tenants are allocated from, unless set in their spec. Tenants use 10.100.0.0/16 if empty.")
+	flags.IntVar(&o.PodCIDRMaskSize, "pod-cidr-mask-size", 16,
+		"Prefix length of the pod cidrs allocated from the pod-cidr-pool.")
+
 	flags.BoolVar(&o.LeaderElection.LeaderElect, "leader-elect", true,
 		"Enable leader elect.")
 	flags.StringVar(&o.LeaderElection.ResourceNamespace, "leader-elect-resource-namespace", "default",
@@ -94,5 +110,27 @@ func (o *Options) Validate() field.ErrorList {
 		errs = append(errs, field.Required(newPath.Child("EtcdSecret"), "must not empty"))
 	}
 
+	for _, pool := range []struct {
+		name     string
+		cidr     string
+		maskSize int
+	}{
+		{"ServiceCIDRPool", o.ServiceCIDRPool, o.ServiceCIDRMaskSize},
+		{"PodCIDRPool", o.PodCIDRPool, o.PodCIDRMaskSize},
+	} {
+		if pool.cidr == "" {
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(pool.cidr)
+		if err != nil {
+			errs = append(errs, field.Invalid(newPath.Child(pool.name), pool.cidr, err.Error()))
+			continue
+		}
+		if ones, bits := cidr.Mask.Size(); pool.maskSize < ones || pool.maskSize > bits {
+			errs = append(errs, field.Invalid(newPath.Child(pool.name), pool.maskSize,
+				fmt.Sprintf("mask size must be between %d and %d", ones, bits)))
+		}
+	}
+
 	return errs
 }
@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=etcdbackends,scope=Cluster
+// +kubebuilder:storageversion
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// EtcdBackend is an etcd cluster the tenants in Shared mode are placed on.
+type EtcdBackend struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec EtcdBackendSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type EtcdBackendList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdBackend `json:"items"`
+}
+
+type EtcdBackendSpec struct {
+	// Endpoints are the client URLs of the etcd cluster.
+	// +kubebuilder:validation:MinItems=1
+	Endpoints []string `json:"endpoints"`
+
+	// CredentialsSecret references the Secret holding the client credentials of the etcd cluster,
+	// the ca under etcd-ca.crt and the client certificate under apiserver-etcd-client.crt and
+	// apiserver-etcd-client.key.
+	CredentialsSecret SecretReference `json:"credentialsSecret"`
+
+	// Capacity is the maximum number of tenants placed on the etcd cluster, unlimited if not set.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Capacity *int32 `json:"capacity,omitempty"`
+}
+
+type SecretReference struct {
+	// Namespace is the namespace of the Secret.
+	Namespace string `json:"namespace"`
+
+	// Name is the name of the Secret.
+	Name string `json:"name"`
+}
@@ -19,6 +19,10 @@ package v1alpha1
 type TenantConditionType string
 
 const (
-	TenantConditionProvisioned = "Provisioned"
-	TenantConditionReady       = "Ready"
+	TenantConditionProvisioned          = "Provisioned"
+	TenantConditionReady                = "Ready"
+	TenantConditionUpgrading            = "Upgrading"
+	TenantConditionDataDeleted          = "DataDeleted"
+	TenantConditionCertificatesExpiring = "CertificatesExpiring"
+	TenantConditionCARotating           = "CARotating"
 )
@@ -23,6 +23,7 @@ const (
 	TenantPhaseProvisioning TenantPhase = "Provisioning"
 	TenantPhaseProvisioned  TenantPhase = "Provisioned"
 	TenantPhaseReady        TenantPhase = "Ready"
+	TenantPhaseUpgrading    TenantPhase = "Upgrading"
 	TenantPhaseFailed       TenantPhase = "Failed"
 	TenantPhaseTerminating  TenantPhase = "Terminating"
 	TenantPhaseUnknown      TenantPhase = "Unknown"
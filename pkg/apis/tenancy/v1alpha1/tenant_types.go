@@ -17,9 +17,16 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// RotateCAAnnotation requests a rotation of the tenant ca when changed to a new value.
+	RotateCAAnnotation = "tenancy.kcp.io/rotate-ca"
+)
+
 // +genclient
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:path=tenants,scope=Cluster
@@ -45,6 +52,570 @@ type TenantList struct {
 }
 
 type TenantSpec struct {
+	// Version is the Kubernetes version of the tenant control plane, e.g. v1.23 or v1.23.4.
+	// A minor version resolves to its default patch release. Defaults to v1.23.4.
+	// +kubebuilder:validation:Pattern=`^v?[0-9]+\.[0-9]+(\.[0-9]+)?$`
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// ImageRepository overrides the registry the control-plane images are pulled from.
+	// Defaults to k8s.gcr.io.
+	// +optional
+	ImageRepository string `json:"imageRepository,omitempty"`
+
+	// ControlPlane configures the control-plane components of the tenant.
+	// +optional
+	ControlPlane ControlPlaneSpec `json:"controlPlane,omitempty"`
+
+	// Authentication configures how the tenant apiserver authenticates users besides the client
+	// certificates signed by the tenant ca.
+	// +optional
+	Authentication AuthenticationSpec `json:"authentication,omitempty"`
+
+	// Authorization configures how the tenant apiserver authorizes requests besides the Node and
+	// RBAC authorizers.
+	// +optional
+	Authorization AuthorizationSpec `json:"authorization,omitempty"`
+
+	// Audit configures the audit logging of the tenant apiserver, disabled if not set.
+	// +optional
+	Audit *AuditSpec `json:"audit,omitempty"`
+
+	// Network configures the ip ranges of the tenant cluster.
+	// +optional
+	Network NetworkSpec `json:"network,omitempty"`
+
+	// Etcd configures the etcd the tenant apiserver stores its data in.
+	// +optional
+	Etcd EtcdSpec `json:"etcd,omitempty"`
+
+	// CertSANs are extra subject alternative names of the apiserver certificate, IPs or DNS names.
+	// +optional
+	CertSANs []string `json:"certSANs,omitempty"`
+
+	// Certificates configures the validity and renewal of the leaf certificates of the tenant.
+	// +optional
+	Certificates CertificatesSpec `json:"certificates,omitempty"`
+
+	// Expose publishes the tenant apiserver outside the host cluster, the apiserver is only
+	// reachable inside the host cluster if not set.
+	// +optional
+	Expose *ExposeSpec `json:"expose,omitempty"`
+}
+
+type CertificatesSpec struct {
+	// Validity is how long an issued leaf certificate is valid. Defaults to 8760h (1 year).
+	// +optional
+	Validity *metav1.Duration `json:"validity,omitempty"`
+
+	// RenewBefore is how long before expiry a leaf certificate is renewed, must be less than
+	// the validity. Defaults to 720h (30 days).
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+
+	// CARotation requests a rotation of the tenant ca when changed to a new value, e.g. a timestamp.
+	// The tenancy.kcp.io/rotate-ca annotation takes precedence if set.
+	// +optional
+	CARotation string `json:"caRotation,omitempty"`
+
+	// CARotationOverlap is how long both the old and the new ca are trusted once the leaf
+	// certificates are signed by the new ca, so clients can pick up the new ca. Defaults to 1h.
+	// +optional
+	CARotationOverlap *metav1.Duration `json:"caRotationOverlap,omitempty"`
+
+	// KeyAlgorithm is the algorithm of the private keys issued for the tenant. Changing it
+	// reissues the leaf certificates, the ca keeps its key until it is rotated and the service
+	// account key is never changed. Ed25519 is not supported for signing service account tokens,
+	// an ECDSA P-256 key is used instead. Defaults to RSA.
+	// +kubebuilder:validation:Enum=RSA;ECDSA;Ed25519
+	// +optional
+	KeyAlgorithm KeyAlgorithm `json:"keyAlgorithm,omitempty"`
+
+	// KeySize is the size of the private keys, 2048, 3072 or 4096 bits for RSA, defaults to 2048,
+	// or the curve size 256 or 384 for ECDSA, defaults to 256. Must not be set for Ed25519.
+	// +optional
+	KeySize int `json:"keySize,omitempty"`
+
+	// CA references a Secret holding a pre-existing ca, e.g. an intermediate of a corporate pki,
+	// the leaf certificates and kubeconfigs of the tenant are signed with instead of a generated
+	// ca. The ca is not rotated by the controller, rotate it by updating the Secret. Only the ca
+	// certificate is copied into the tenant, its key is read from the Secret when signing, so the
+	// controller-manager does not sign certificate signing requests. The reference can not be
+	// removed once in use, the tenant does not hold a ca key to sign with a generated ca.
+	// +optional
+	CA *CASecretReference `json:"ca,omitempty"`
+
+	// FrontProxyCA references a Secret holding a pre-existing ca the front proxy client certificate
+	// is signed with instead of a generated ca. Only the ca certificate is copied into the tenant.
+	// +optional
+	FrontProxyCA *CASecretReference `json:"frontProxyCA,omitempty"`
+
+	// Issuer requests the certificates signed by the tenant ca from a cert-manager issuer instead
+	// of issuing them in-process: the apiserver serving and kubelet client certificates and the
+	// client certificates of the kubeconfigs. The tenant trusts the ca.crt of the issued Secrets.
+	// Without the ca key the controller-manager does not sign certificate signing requests. The
+	// front proxy and etcd certificates are still issued in-process. Mutually exclusive with CA.
+	// The reference can not be removed once in use, as for CA.
+	// +optional
+	Issuer *IssuerReference `json:"issuer,omitempty"`
+}
+
+// IssuerReference references a cert-manager issuer.
+type IssuerReference struct {
+	// Name is the name of the issuer.
+	Name string `json:"name"`
+
+	// Kind is the kind of the issuer, Issuer or ClusterIssuer for the cert-manager issuers. An
+	// Issuer must be in the namespace of the tenant in the host cluster. Defaults to Issuer.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Group is the api group of the issuer. Defaults to cert-manager.io.
+	// +optional
+	Group string `json:"group,omitempty"`
+}
+
+// CASecretReference references a Secret of type kubernetes.io/tls holding a ca certificate under
+// tls.crt and its private key under tls.key. The ca must be allowed to sign certificates.
+type CASecretReference struct {
+	// Namespace is the namespace of the Secret.
+	Namespace string `json:"namespace"`
+
+	// Name is the name of the Secret.
+	Name string `json:"name"`
+}
+
+type KeyAlgorithm string
+
+const (
+	KeyAlgorithmRSA     KeyAlgorithm = "RSA"
+	KeyAlgorithmECDSA   KeyAlgorithm = "ECDSA"
+	KeyAlgorithmEd25519 KeyAlgorithm = "Ed25519"
+)
+
+type ExposeType string
+
+const (
+	// ExposeTypeNodePort exposes the apiserver on a port of every node of the host cluster.
+	ExposeTypeNodePort ExposeType = "NodePort"
+	// ExposeTypeLoadBalancer exposes the apiserver through a load balancer of the host cluster.
+	ExposeTypeLoadBalancer ExposeType = "LoadBalancer"
+	// ExposeTypeIngress exposes the apiserver through an Ingress with TLS passthrough, the
+	// ingress controller must support it, e.g. ingress-nginx with --enable-ssl-passthrough.
+	ExposeTypeIngress ExposeType = "Ingress"
+)
+
+type ExposeSpec struct {
+	// Type is how the apiserver is exposed, one of NodePort, LoadBalancer or Ingress.
+	// +kubebuilder:validation:Enum=NodePort;LoadBalancer;Ingress
+	Type ExposeType `json:"type"`
+
+	// Host is the address clients reach the apiserver at, an IP or a DNS name. Required for
+	// NodePort and Ingress, defaults to the load balancer address for LoadBalancer.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// NodePort is the node port of the apiserver, only used for NodePort. Allocated if not set.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	NodePort int32 `json:"nodePort,omitempty"`
+
+	// IngressClassName is the class of the Ingress, only used for Ingress.
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+
+	// Annotations are added to the Service for NodePort and LoadBalancer, and to the Ingress for Ingress.
+	// The ones removed, or no longer used for the type, are removed from the objects.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type AuthenticationSpec struct {
+	// OIDC authenticates users with the ID tokens of an OpenID Connect provider, e.g. the
+	// corporate SSO. A kubeconfig fetching the tokens with the kubelogin plugin is generated in
+	// the Secret kubeconfig-oidc.
+	// +optional
+	OIDC *OIDCSpec `json:"oidc,omitempty"`
+
+	// Webhook authenticates bearer tokens with a TokenReview webhook.
+	// +optional
+	Webhook *WebhookSpec `json:"webhook,omitempty"`
+}
+
+type AuthorizationSpec struct {
+	// Webhook authorizes the requests not allowed by RBAC with a SubjectAccessReview webhook.
+	// +optional
+	Webhook *WebhookSpec `json:"webhook,omitempty"`
+}
+
+// WebhookSpec configures a webhook of the tenant apiserver.
+type WebhookSpec struct {
+	// KubeConfigSecret references a Secret holding the kubeconfig of the webhook under
+	// kubeconfig. Its current context must embed the certificates and credentials, files and
+	// exec plugins are not available to the apiserver.
+	KubeConfigSecret SecretReference `json:"kubeConfigSecret"`
+}
+
+type OIDCSpec struct {
+	// IssuerURL is the https URL of the provider, the iss claim of its ID tokens.
+	IssuerURL string `json:"issuerURL"`
+
+	// ClientID is the client the ID tokens must be issued for, the aud claim.
+	ClientID string `json:"clientID"`
+
+	// UsernameClaim is the claim used as the username. Defaults to sub.
+	// +optional
+	UsernameClaim string `json:"usernameClaim,omitempty"`
+
+	// UsernamePrefix is prepended to the usernames, "-" disables prefixing. Defaults to the
+	// issuer URL followed by # for claims other than email.
+	// +optional
+	UsernamePrefix string `json:"usernamePrefix,omitempty"`
+
+	// GroupsClaim is the claim used as the groups of the user, none if not set.
+	// +optional
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+
+	// GroupsPrefix is prepended to the groups.
+	// +optional
+	GroupsPrefix string `json:"groupsPrefix,omitempty"`
+
+	// ExtraScopes are the scopes the kubectl oidc-login plugin of the OIDC kubeconfig requests in
+	// addition to openid. Defaults to groups if GroupsClaim is set.
+	// +optional
+	ExtraScopes []string `json:"extraScopes,omitempty"`
+
+	// CASecret references a Secret holding the ca bundle the serving certificate of the provider
+	// is verified with under ca.crt. The system roots are used if not set.
+	// +optional
+	CASecret *SecretReference `json:"caSecret,omitempty"`
+}
+
+type AuditPolicyPreset string
+
+const (
+	AuditPolicyPresetMetadata        AuditPolicyPreset = "Metadata"
+	AuditPolicyPresetRequest         AuditPolicyPreset = "Request"
+	AuditPolicyPresetRequestResponse AuditPolicyPreset = "RequestResponse"
+)
+
+type AuditSpec struct {
+	// Preset logs every request at the level, except the health checks, and the requests on
+	// secrets, configmaps and token reviews at the Metadata level only. Defaults to Metadata.
+	// +kubebuilder:validation:Enum=Metadata;Request;RequestResponse
+	// +optional
+	Preset AuditPolicyPreset `json:"preset,omitempty"`
+
+	// PolicyConfigMap references a ConfigMap holding an audit.k8s.io/v1 Policy under policy.yaml,
+	// used instead of the preset.
+	// +optional
+	PolicyConfigMap *ConfigMapReference `json:"policyConfigMap,omitempty"`
+
+	// Log writes the events to files, one per apiserver pod at
+	// /var/log/kubernetes/audit/<tenant>/<pod>.log.
+	// +optional
+	Log *AuditLogSpec `json:"log,omitempty"`
+
+	// Webhook posts the events to a webhook, the name of the tenant is appended to the path of
+	// the server of its kubeconfig, e.g. https://audit.example.com/events/tenant-1.
+	// +optional
+	Webhook *WebhookSpec `json:"webhook,omitempty"`
+}
+
+type ConfigMapReference struct {
+	// Namespace is the namespace of the ConfigMap.
+	Namespace string `json:"namespace"`
+
+	// Name is the name of the ConfigMap.
+	Name string `json:"name"`
+}
+
+type AuditLogSpec struct {
+	// MaxAge is the number of days a rotated file is kept. Defaults to 7.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxAge *int32 `json:"maxAge,omitempty"`
+
+	// MaxBackups is the number of rotated files kept. Defaults to 10.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxBackups *int32 `json:"maxBackups,omitempty"`
+
+	// MaxSize is the size in megabytes a file is rotated at. Defaults to 100.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxSize *int32 `json:"maxSize,omitempty"`
+
+	// ClaimName is a PersistentVolumeClaim in the namespace of the tenant in the host cluster the
+	// files are written to, it must be ReadWriteMany for more than one replica. The files are
+	// written to an emptyDir if not set, and lost with the pod.
+	// +optional
+	ClaimName string `json:"claimName,omitempty"`
+}
+
+type NetworkSpec struct {
+	// ServiceCIDRs are the ip ranges of the Services, one per ip family for dual-stack. The
+	// kubernetes Service gets the first ip of the first range. Allocated from the pool of the
+	// platform if not set, 10.101.0.0/16 without a pool. Can not be changed once allocated.
+	// +kubebuilder:validation:MaxItems=2
+	// +optional
+	ServiceCIDRs []string `json:"serviceCIDRs,omitempty"`
+
+	// PodCIDRs are the ip ranges of the Pods, one per ip family for dual-stack. Allocated from
+	// the pool of the platform if not set, 10.100.0.0/16 without a pool. Can not be changed once
+	// allocated.
+	// +kubebuilder:validation:MaxItems=2
+	// +optional
+	PodCIDRs []string `json:"podCIDRs,omitempty"`
+
+	// NodeCIDRMaskSizeIPv4 is the prefix length of the ipv4 pod range of every node, 24 if not
+	// set.
+	// +optional
+	NodeCIDRMaskSizeIPv4 *int32 `json:"nodeCIDRMaskSizeIPv4,omitempty"`
+
+	// NodeCIDRMaskSizeIPv6 is the prefix length of the ipv6 pod range of every node, 64 if not
+	// set.
+	// +optional
+	NodeCIDRMaskSizeIPv6 *int32 `json:"nodeCIDRMaskSizeIPv6,omitempty"`
+}
+
+type ControlPlaneSpec struct {
+	// Replicas is the number of replicas of every control-plane component. Defaults to 1.
+	// The replicas are spread across host nodes, the controller-manager and the scheduler
+	// elect a leader among their replicas.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Size is the preset the resources of the components are sized by, one of Small, Medium or
+	// Large. Defaults to Small.
+	// +kubebuilder:validation:Enum=Small;Medium;Large
+	// +optional
+	Size ControlPlaneSize `json:"size,omitempty"`
+
+	// APIServer configures the pods of the apiserver.
+	// +optional
+	APIServer ComponentSpec `json:"apiServer,omitempty"`
+
+	// ControllerManager configures the pods of the controller-manager.
+	// +optional
+	ControllerManager ComponentSpec `json:"controllerManager,omitempty"`
+
+	// Scheduler configures the pods of the scheduler.
+	// +optional
+	Scheduler ComponentSpec `json:"scheduler,omitempty"`
+}
+
+type ControlPlaneSize string
+
+const (
+	// ControlPlaneSizeSmall sizes the components for a few nodes and light api traffic.
+	ControlPlaneSizeSmall ControlPlaneSize = "Small"
+	// ControlPlaneSizeMedium sizes the components for tens of nodes.
+	ControlPlaneSizeMedium ControlPlaneSize = "Medium"
+	// ControlPlaneSizeLarge sizes the components for hundreds of nodes.
+	ControlPlaneSizeLarge ControlPlaneSize = "Large"
+)
+
+type ComponentSpec struct {
+	// Resources overrides the resources of the component container sized by the preset.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// NodeSelector constrains the host nodes the pods are scheduled on.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the pods.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity of the pods, the replicas are spread across host nodes in addition.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// PriorityClassName is the priority class of the pods.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// ExtraArgs adds flags to the command of the component or overrides the flags set by the
+	// controller, keyed by the flag name without the leading dashes. The flags owned by the
+	// platform, e.g. the etcd and certificate flags, can not be set.
+	// +optional
+	ExtraArgs map[string]string `json:"extraArgs,omitempty"`
+
+	// FeatureGates enables or disables the feature gates of the component.
+	// +optional
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+
+	// Env are extra environment variables of the component container.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// ExtraVolumes are Secrets and ConfigMaps mounted read-only into the component container.
+	// +optional
+	ExtraVolumes []ComponentVolume `json:"extraVolumes,omitempty"`
+
+	// Probes overrides the timing of the probes of the component container.
+	// +optional
+	Probes ComponentProbes `json:"probes,omitempty"`
+}
+
+type ComponentProbes struct {
+	// Liveness overrides the liveness probe.
+	// +optional
+	Liveness *ProbeOverride `json:"liveness,omitempty"`
+
+	// Readiness overrides the readiness probe.
+	// +optional
+	Readiness *ProbeOverride `json:"readiness,omitempty"`
+
+	// Startup overrides the startup probe.
+	// +optional
+	Startup *ProbeOverride `json:"startup,omitempty"`
+}
+
+// ProbeOverride overrides the timing of a probe, the unset fields keep the defaults of the
+// controller. The endpoint probed is owned by the platform.
+type ProbeOverride struct {
+	// InitialDelaySeconds is the number of seconds after the container started before the probe
+	// is initiated.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+
+	// PeriodSeconds is how often the probe is performed.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+
+	// TimeoutSeconds is the number of seconds after which the probe times out.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// SuccessThreshold is the number of consecutive successes for the probe to be considered
+	// successful after having failed. Must be 1 for the liveness and startup probes.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SuccessThreshold *int32 `json:"successThreshold,omitempty"`
+
+	// FailureThreshold is the number of consecutive failures for the probe to be considered
+	// failed after having succeeded.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+}
+
+type ComponentVolume struct {
+	// Name is the name of the volume, unique among the volumes of the pod.
+	Name string `json:"name"`
+
+	// MountPath is the absolute path the volume is mounted at.
+	MountPath string `json:"mountPath"`
+
+	// Secret is the Secret in the namespace of the tenant in the host cluster to mount.
+	// +optional
+	Secret *corev1.SecretVolumeSource `json:"secret,omitempty"`
+
+	// ConfigMap is the ConfigMap in the namespace of the tenant in the host cluster to mount.
+	// +optional
+	ConfigMap *corev1.ConfigMapVolumeSource `json:"configMap,omitempty"`
+}
+
+type EtcdMode string
+
+const (
+	// EtcdModeShared stores the tenant data under its own prefix in the etcd shared by all tenants.
+	EtcdModeShared EtcdMode = "Shared"
+	// EtcdModeDedicated provisions an etcd cluster dedicated to the tenant.
+	EtcdModeDedicated EtcdMode = "Dedicated"
+)
+
+type EtcdDeletionPolicy string
+
+const (
+	// EtcdDeletionPolicyPurge deletes the tenant data from etcd when the tenant is deleted.
+	EtcdDeletionPolicyPurge EtcdDeletionPolicy = "Purge"
+	// EtcdDeletionPolicyOrphan keeps the tenant data in etcd when the tenant is deleted,
+	// a tenant recreated with the same name sees the data again.
+	EtcdDeletionPolicyOrphan EtcdDeletionPolicy = "Orphan"
+)
+
+type EtcdSpec struct {
+	// Mode is the etcd mode of the tenant, one of Shared or Dedicated. Defaults to Shared.
+	// The mode can not be changed once the tenant is provisioned.
+	// +kubebuilder:validation:Enum=Shared;Dedicated
+	// +optional
+	Mode EtcdMode `json:"mode,omitempty"`
+
+	// Dedicated configures the etcd cluster of the tenant, only used in Dedicated mode.
+	// +optional
+	Dedicated *DedicatedEtcdSpec `json:"dedicated,omitempty"`
+
+	// DeletionPolicy is what happens to the tenant data in the shared etcd when the tenant
+	// is deleted, one of Purge or Orphan. Defaults to Purge. The deletion of the tenant waits
+	// for the purge, switching to Orphan releases a tenant whose etcd is unreachable. The data
+	// of a dedicated etcd is always deleted with the tenant.
+	// +kubebuilder:validation:Enum=Purge;Orphan
+	// +optional
+	DeletionPolicy EtcdDeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// Placement places the tenant on an EtcdBackend, only used in Shared mode. The tenant is
+	// placed once when it is provisioned and stays on its EtcdBackend. The tenants are stored in
+	// the etcd of the manager as long as no EtcdBackend exists.
+	// +optional
+	Placement *EtcdPlacement `json:"placement,omitempty"`
+}
+
+type EtcdPlacementPolicy string
+
+const (
+	// EtcdPlacementPolicyLeastLoaded places the tenant on the EtcdBackend with the fewest tenants.
+	EtcdPlacementPolicyLeastLoaded EtcdPlacementPolicy = "LeastLoaded"
+	// EtcdPlacementPolicySelector places the tenant on the EtcdBackend with the fewest tenants
+	// among the ones matching the selector.
+	EtcdPlacementPolicySelector EtcdPlacementPolicy = "Selector"
+	// EtcdPlacementPolicyReference places the tenant on the referenced EtcdBackend.
+	EtcdPlacementPolicyReference EtcdPlacementPolicy = "Reference"
+)
+
+type EtcdPlacement struct {
+	// Policy is how the EtcdBackend is chosen, one of LeastLoaded, Selector or Reference.
+	// Defaults to LeastLoaded. EtcdBackends at capacity are never chosen.
+	// +kubebuilder:validation:Enum=LeastLoaded;Selector;Reference
+	// +optional
+	Policy EtcdPlacementPolicy `json:"policy,omitempty"`
+
+	// Selector selects the EtcdBackends for the Selector policy.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Backend is the name of the EtcdBackend for the Reference policy.
+	// +optional
+	Backend string `json:"backend,omitempty"`
+}
+
+type DedicatedEtcdSpec struct {
+	// Replicas is the number of etcd members, must be odd. Defaults to 1.
+	// It can not be changed once the etcd cluster is created.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Image overrides the etcd image. Defaults to etcd from the image repository of the tenant.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Storage is the size of the PersistentVolumeClaim of every etcd member. Defaults to 8Gi.
+	// It can not be changed once the etcd cluster is created.
+	// +optional
+	Storage *resource.Quantity `json:"storage,omitempty"`
+
+	// StorageClassName is the storage class of the volume of every etcd member.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
 }
 
 type TenantStatus struct {
@@ -56,6 +627,110 @@ type TenantStatus struct {
 	// Conditions defines current service state of Tenant.
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Version is the resolved Kubernetes version of the tenant control plane.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Upgrade tracks the in-flight control-plane upgrade, nil if none.
+	// +optional
+	Upgrade *TenantUpgradeStatus `json:"upgrade,omitempty"`
+
+	// EtcdMode is the etcd mode the tenant is provisioned with.
+	// +optional
+	EtcdMode EtcdMode `json:"etcdMode,omitempty"`
+
+	// EtcdBackend is the EtcdBackend the tenant is placed on, empty for the etcd of the manager
+	// or a dedicated etcd.
+	// +optional
+	EtcdBackend string `json:"etcdBackend,omitempty"`
+
+	// Network is the network the tenant is provisioned with.
+	// +optional
+	Network *NetworkStatus `json:"network,omitempty"`
+
+	// DedicatedEtcd is the dedicated etcd cluster as created, nil in Shared mode.
+	// +optional
+	DedicatedEtcd *DedicatedEtcdStatus `json:"dedicatedEtcd,omitempty"`
+
+	// ExternalCA is set once the tenant ca is taken from a referenced Secret or an issuer, the
+	// tenant does not hold the key of its ca from then on.
+	// +optional
+	ExternalCA bool `json:"externalCA,omitempty"`
+
+	// ExternalEndpoint is the URL the apiserver is reachable at from outside the host cluster,
+	// empty if not exposed or the address is not assigned yet.
+	// +optional
+	ExternalEndpoint string `json:"externalEndpoint,omitempty"`
+
+	// Certificates reports when the certificates of the tenant expire.
+	// +optional
+	Certificates []CertificateStatus `json:"certificates,omitempty"`
+
+	// CARotation tracks the in-flight ca rotation, nil if none.
+	// +optional
+	CARotation *CARotationStatus `json:"caRotation,omitempty"`
+
+	// CARotationTrigger is the trigger of the last completed ca rotation.
+	// +optional
+	CARotationTrigger string `json:"caRotationTrigger,omitempty"`
+}
+
+type NetworkStatus struct {
+	// ServiceCIDRs are the ip ranges of the Services.
+	ServiceCIDRs []string `json:"serviceCIDRs"`
+
+	// PodCIDRs are the ip ranges of the Pods.
+	PodCIDRs []string `json:"podCIDRs"`
+}
+
+type CARotationStage string
+
+const (
+	// CARotationStageTrustBoth issues the new ca and trusts both cas, the leaf certificates are
+	// still signed by the old ca.
+	CARotationStageTrustBoth CARotationStage = "TrustBoth"
+	// CARotationStageSignWithNew signs the leaf certificates with the new ca, both cas are trusted
+	// for the overlap window.
+	CARotationStageSignWithNew CARotationStage = "SignWithNew"
+	// CARotationStageTrustNew drops the old ca.
+	CARotationStageTrustNew CARotationStage = "TrustNew"
+)
+
+type CARotationStatus struct {
+	// Trigger is the trigger the rotation was started for.
+	Trigger string `json:"trigger"`
+
+	// Stage is the current stage of the rotation.
+	Stage CARotationStage `json:"stage"`
+
+	// LastTransitionTime is when the rotation entered the current stage.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+}
+
+type CertificateStatus struct {
+	// Name identifies the certificate as <secret>/<key>, e.g. apiserver-cert/apiserver.crt.
+	Name string `json:"name"`
+
+	// NotAfter is when the certificate expires.
+	NotAfter metav1.Time `json:"notAfter"`
+}
+
+type DedicatedEtcdStatus struct {
+	// Replicas is the number of etcd members.
+	Replicas int32 `json:"replicas"`
+
+	// Storage is the size of the volume of every etcd member.
+	Storage resource.Quantity `json:"storage"`
+}
+
+type TenantUpgradeStatus struct {
+	// Version is the Kubernetes version the control plane is upgrading to.
+	Version string `json:"version"`
+
+	// Components lists the control-plane components already upgraded, in upgrade order.
+	// +optional
+	Components []string `json:"components,omitempty"`
 }
 
 func (t *TenantStatus) IsPhase(p TenantPhase) bool {
@@ -70,6 +745,39 @@ func (t *Tenant) ClusterNamespaceInHost() string {
 	return "tenant-" + t.Name
 }
 
+// CARotationTrigger returns the requested trigger of the ca rotation, the rotate-ca annotation
+// takes precedence over the spec.
+func (t *Tenant) CARotationTrigger() string {
+	if trigger := t.Annotations[RotateCAAnnotation]; trigger != "" {
+		return trigger
+	}
+	return t.Spec.Certificates.CARotation
+}
+
+// EtcdMode returns the etcd mode of the tenant, Shared if not set.
+func (t *Tenant) EtcdMode() EtcdMode {
+	if t.Spec.Etcd.Mode == "" {
+		return EtcdModeShared
+	}
+	return t.Spec.Etcd.Mode
+}
+
+// EtcdPlacementPolicy returns the etcd placement policy of the tenant, LeastLoaded if not set.
+func (t *Tenant) EtcdPlacementPolicy() EtcdPlacementPolicy {
+	if t.Spec.Etcd.Placement == nil || t.Spec.Etcd.Placement.Policy == "" {
+		return EtcdPlacementPolicyLeastLoaded
+	}
+	return t.Spec.Etcd.Placement.Policy
+}
+
+// EtcdDeletionPolicy returns the etcd deletion policy of the tenant, Purge if not set.
+func (t *Tenant) EtcdDeletionPolicy() EtcdDeletionPolicy {
+	if t.Spec.Etcd.DeletionPolicy == "" {
+		return EtcdDeletionPolicyPurge
+	}
+	return t.Spec.Etcd.DeletionPolicy
+}
+
 func (t *Tenant) GetConditions() []metav1.Condition {
 	return t.Status.Conditions
 }
@@ -0,0 +1,82 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package args merges flags into the command lines of the control-plane components.
+package args
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Name returns the name of the flag arg, without the leading dashes and the value. It is empty if
+// arg is not a flag.
+func Name(arg string) string {
+	if !strings.HasPrefix(arg, "-") {
+		return ""
+	}
+	name := strings.TrimLeft(arg, "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// Merge returns the command with the flags overridden by name, the flags missing from the
+// command are appended in the order of their names. The overrides are flag names without the
+// leading dashes mapped to their values.
+func Merge(command []string, overrides map[string]string) []string {
+	merged := make([]string, 0, len(command)+len(overrides))
+	seen := make(map[string]bool, len(overrides))
+	for _, arg := range command {
+		name := Name(arg)
+		if value, ok := overrides[name]; ok {
+			merged = append(merged, fmt.Sprintf("--%s=%s", name, value))
+			seen[name] = true
+			continue
+		}
+		merged = append(merged, arg)
+	}
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		merged = append(merged, fmt.Sprintf("--%s=%s", name, overrides[name]))
+	}
+	return merged
+}
+
+// FeatureGates returns the value of --feature-gates enabling or disabling the gates, in the
+// order of their names.
+func FeatureGates(gates map[string]bool) string {
+	names := make([]string, 0, len(gates))
+	for name := range gates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", name, gates[name]))
+	}
+	return strings.Join(pairs, ",")
+}
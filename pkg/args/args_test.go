@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package args
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "secure-port", Name("--secure-port=6443"))
+	assert.Equal(t, "v", Name("-v=2"))
+	assert.Equal(t, "profiling", Name("--profiling"))
+	assert.Equal(t, "", Name("kube-apiserver"))
+}
+
+func TestMerge(t *testing.T) {
+	command := []string{
+		"kube-apiserver",
+		"--authorization-mode=Node,RBAC",
+		"--enable-admission-plugins=NodeRestriction",
+		"--secure-port=6443",
+	}
+
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		want      []string
+	}{
+		{name: "no overrides", want: command},
+		{
+			name: "override",
+			overrides: map[string]string{
+				"enable-admission-plugins": "NodeRestriction,PodSecurity",
+			},
+			want: []string{
+				"kube-apiserver",
+				"--authorization-mode=Node,RBAC",
+				"--enable-admission-plugins=NodeRestriction,PodSecurity",
+				"--secure-port=6443",
+			},
+		},
+		{
+			name: "append in name order",
+			overrides: map[string]string{
+				"v":                  "2",
+				"audit-log-maxage":   "7",
+				"authorization-mode": "RBAC",
+			},
+			want: []string{
+				"kube-apiserver",
+				"--authorization-mode=RBAC",
+				"--enable-admission-plugins=NodeRestriction",
+				"--secure-port=6443",
+				"--audit-log-maxage=7",
+				"--v=2",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, Merge(command, test.overrides))
+		})
+	}
+}
+
+func TestFeatureGates(t *testing.T) {
+	assert.Equal(t, "", FeatureGates(nil))
+	assert.Equal(t, "EphemeralContainers=true,ServerSideApply=false",
+		FeatureGates(map[string]bool{"ServerSideApply": false, "EphemeralContainers": true}))
+}
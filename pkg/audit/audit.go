@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit builds the audit configuration of the tenant apiservers.
+package audit
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"k8s.io/apiserver/pkg/audit/policy"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// PresetPolicy returns the audit policy logging the requests at level. The health checks are
+// not logged, the requests on secrets, configmaps and token reviews only at the Metadata level
+// so no credentials are logged.
+func PresetPolicy(level auditv1.Level) ([]byte, error) {
+	preset := &auditv1.Policy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: auditv1.SchemeGroupVersion.String(),
+			Kind:       "Policy",
+		},
+		OmitStages: []auditv1.Stage{auditv1.StageRequestReceived},
+		Rules: []auditv1.PolicyRule{
+			{
+				Level:           auditv1.LevelNone,
+				NonResourceURLs: []string{"/healthz*", "/livez*", "/readyz*", "/version"},
+			},
+			{
+				Level: auditv1.LevelMetadata,
+				Resources: []auditv1.GroupResources{
+					{Group: "", Resources: []string{"secrets", "configmaps"}},
+					{Group: "authentication.k8s.io", Resources: []string{"tokenreviews"}},
+				},
+			},
+			{
+				Level: level,
+			},
+		},
+	}
+	data, err := yaml.Marshal(preset)
+	if err != nil {
+		return nil, err
+	}
+	return data, ValidatePolicy(data)
+}
+
+// ValidatePolicy checks data holds an audit policy the apiserver accepts.
+func ValidatePolicy(data []byte) error {
+	_, err := policy.LoadPolicyFromBytes(data)
+	return err
+}
+
+// TagWebhookKubeConfig returns the kubeconfig of an audit webhook with tag appended to the path of
+// the server of its current context, so the receiver tells the apiservers posting to it apart.
+func TagWebhookKubeConfig(data []byte, tag string) ([]byte, error) {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, err
+	}
+	context, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return nil, fmt.Errorf("current context %q not found", config.CurrentContext)
+	}
+	cluster, ok := config.Clusters[context.Cluster]
+	if !ok {
+		return nil, fmt.Errorf("cluster %q not found", context.Cluster)
+	}
+	server, err := url.Parse(cluster.Server)
+	if err != nil {
+		return nil, err
+	}
+	server.Path = path.Join("/", server.Path, tag)
+	cluster.Server = server.String()
+	return clientcmd.Write(*config)
+}
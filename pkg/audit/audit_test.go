@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"k8s.io/apiserver/pkg/audit/policy"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestPresetPolicy(t *testing.T) {
+	for _, level := range []auditv1.Level{auditv1.LevelMetadata, auditv1.LevelRequest, auditv1.LevelRequestResponse} {
+		data, err := PresetPolicy(level)
+		assert.NoError(t, err)
+		loaded, err := policy.LoadPolicyFromBytes(data)
+		if assert.NoError(t, err) {
+			assert.Equal(t, string(level), string(loaded.Rules[len(loaded.Rules)-1].Level))
+		}
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	assert.NoError(t, ValidatePolicy([]byte(`apiVersion: audit.k8s.io/v1
+kind: Policy
+rules:
+- level: Metadata
+`)))
+	assert.Error(t, ValidatePolicy([]byte(`apiVersion: audit.k8s.io/v1
+kind: Policy
+rules:
+- level: Everything
+`)))
+	assert.Error(t, ValidatePolicy([]byte("not a policy")))
+}
+
+func TestTagWebhookKubeConfig(t *testing.T) {
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{server: "https://audit.example.com", want: "https://audit.example.com/tenant-1"},
+		{server: "https://audit.example.com/events/", want: "https://audit.example.com/events/tenant-1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.server, func(t *testing.T) {
+			data, err := TagWebhookKubeConfig([]byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: audit
+  cluster:
+    server: `+test.server+`
+contexts:
+- name: audit
+  context:
+    cluster: audit
+    user: ""
+current-context: audit
+`), "tenant-1")
+			if !assert.NoError(t, err) {
+				return
+			}
+			config, err := clientcmd.Load(data)
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.want, config.Clusters["audit"].Server)
+			}
+		})
+	}
+
+	_, err := TagWebhookKubeConfig([]byte("apiVersion: v1\nkind: Config\n"), "tenant-1")
+	assert.Error(t, err)
+}
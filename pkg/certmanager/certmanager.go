@@ -0,0 +1,173 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package certmanager builds cert-manager Certificate resources as unstructured objects, so the
+// controller does not depend on the cert-manager api.
+package certmanager
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+)
+
+const (
+	// GroupName is the api group of the cert-manager resources.
+	GroupName = "cert-manager.io"
+
+	// CertificateNameAnnotation is set by cert-manager on the Secrets it issues.
+	CertificateNameAnnotation = "cert-manager.io/certificate-name"
+)
+
+// CertificateGVK is the kind of a cert-manager Certificate.
+var CertificateGVK = schema.GroupVersionKind{Group: GroupName, Version: "v1", Kind: "Certificate"}
+
+// IssuerRef references the issuer a certificate is requested from.
+type IssuerRef struct {
+	Name string
+	// Kind is Issuer or ClusterIssuer for cert-manager issuers, Issuer if empty.
+	Kind string
+	// Group is the api group of the issuer, cert-manager.io if empty.
+	Group string
+}
+
+// CertificateSpec is the certificate requested from the issuer.
+type CertificateSpec struct {
+	// SecretName is the name of the Secret the certificate is issued into.
+	SecretName string
+	Issuer     IssuerRef
+	// Config is the subject, the subject alternative names and the usages of the certificate.
+	Config *certutil.Config
+	Key    secret.KeyConfig
+	// Duration is how long the certificate is valid, and RenewBefore how long before expiry it is
+	// renewed, the issuer defaults apply if zero.
+	Duration    time.Duration
+	RenewBefore time.Duration
+}
+
+// NewCertificate returns a Certificate object with the namespace and name.
+func NewCertificate(namespace, name string) *unstructured.Unstructured {
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(CertificateGVK)
+	certificate.SetNamespace(namespace)
+	certificate.SetName(name)
+	return certificate
+}
+
+// SetSpec replaces the spec of the Certificate with the requested certificate.
+func SetSpec(certificate *unstructured.Unstructured, spec CertificateSpec) error {
+	issuerRef := map[string]interface{}{
+		"name":  spec.Issuer.Name,
+		"kind":  spec.Issuer.Kind,
+		"group": spec.Issuer.Group,
+	}
+	if spec.Issuer.Kind == "" {
+		issuerRef["kind"] = "Issuer"
+	}
+	if spec.Issuer.Group == "" {
+		issuerRef["group"] = GroupName
+	}
+
+	algorithm := spec.Key.Algorithm
+	if algorithm == "" {
+		algorithm = secret.KeyAlgorithmRSA
+	}
+	privateKey := map[string]interface{}{
+		"algorithm":      string(algorithm),
+		"encoding":       "PKCS8",
+		"rotationPolicy": "Always",
+	}
+	if spec.Key.Size != 0 {
+		privateKey["size"] = int64(spec.Key.Size)
+	}
+
+	usages := []interface{}{"digital signature"}
+	if algorithm == secret.KeyAlgorithmRSA {
+		usages = append(usages, "key encipherment")
+	}
+	for _, usage := range spec.Config.Usages {
+		switch usage {
+		case x509.ExtKeyUsageServerAuth:
+			usages = append(usages, "server auth")
+		case x509.ExtKeyUsageClientAuth:
+			usages = append(usages, "client auth")
+		default:
+			return fmt.Errorf("unsupported extended key usage %d", usage)
+		}
+	}
+
+	certSpec := map[string]interface{}{
+		"secretName": spec.SecretName,
+		"issuerRef":  issuerRef,
+		"commonName": spec.Config.CommonName,
+		"privateKey": privateKey,
+		"usages":     usages,
+	}
+	if len(spec.Config.Organization) != 0 {
+		organizations := make([]interface{}, 0, len(spec.Config.Organization))
+		for _, organization := range spec.Config.Organization {
+			organizations = append(organizations, organization)
+		}
+		certSpec["subject"] = map[string]interface{}{
+			"organizations": organizations,
+		}
+	}
+	if len(spec.Config.AltNames.DNSNames) != 0 {
+		dnsNames := make([]interface{}, 0, len(spec.Config.AltNames.DNSNames))
+		for _, name := range spec.Config.AltNames.DNSNames {
+			dnsNames = append(dnsNames, name)
+		}
+		certSpec["dnsNames"] = dnsNames
+	}
+	if len(spec.Config.AltNames.IPs) != 0 {
+		ips := make([]interface{}, 0, len(spec.Config.AltNames.IPs))
+		for _, ip := range spec.Config.AltNames.IPs {
+			ips = append(ips, ip.String())
+		}
+		certSpec["ipAddresses"] = ips
+	}
+	if spec.Duration != 0 {
+		certSpec["duration"] = spec.Duration.String()
+	}
+	if spec.RenewBefore != 0 {
+		certSpec["renewBefore"] = spec.RenewBefore.String()
+	}
+
+	return unstructured.SetNestedMap(certificate.Object, certSpec, "spec")
+}
+
+// IsReady returns true if cert-manager issued the certificate for the current spec of the
+// Certificate.
+func IsReady(certificate *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(certificate.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		if observed, ok, _ := unstructured.NestedInt64(condition, "observedGeneration"); ok && observed < certificate.GetGeneration() {
+			return false
+		}
+		return condition["status"] == "True"
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	certutil "k8s.io/client-go/util/cert"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+)
+
+func TestSetSpec(t *testing.T) {
+	tests := []struct {
+		name string
+		spec CertificateSpec
+		want map[string]interface{}
+	}{
+		{
+			name: "server certificate",
+			spec: CertificateSpec{
+				SecretName: "apiserver-tls",
+				Issuer:     IssuerRef{Name: "corporate", Kind: "ClusterIssuer"},
+				Config: &certutil.Config{
+					CommonName: "kube-apiserver",
+					AltNames: certutil.AltNames{
+						DNSNames: []string{"kubernetes"},
+						IPs:      []net.IP{net.ParseIP("10.101.0.1")},
+					},
+					Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+				},
+				Duration:    24 * time.Hour,
+				RenewBefore: time.Hour,
+			},
+			want: map[string]interface{}{
+				"secretName": "apiserver-tls",
+				"issuerRef": map[string]interface{}{
+					"name":  "corporate",
+					"kind":  "ClusterIssuer",
+					"group": "cert-manager.io",
+				},
+				"commonName": "kube-apiserver",
+				"dnsNames":   []interface{}{"kubernetes"},
+				"ipAddresses": []interface{}{
+					"10.101.0.1",
+				},
+				"privateKey": map[string]interface{}{
+					"algorithm":      "RSA",
+					"encoding":       "PKCS8",
+					"rotationPolicy": "Always",
+				},
+				"usages":      []interface{}{"digital signature", "key encipherment", "server auth"},
+				"duration":    "24h0m0s",
+				"renewBefore": "1h0m0s",
+			},
+		},
+		{
+			name: "client certificate",
+			spec: CertificateSpec{
+				SecretName: "kubeconfig-admin-tls",
+				Issuer:     IssuerRef{Name: "tenant", Group: "example.com", Kind: "VaultIssuer"},
+				Config: &certutil.Config{
+					CommonName:   "kubernetes-admin",
+					Organization: []string{"system:masters"},
+					Usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+				},
+				Key: secret.KeyConfig{Algorithm: secret.KeyAlgorithmECDSA, Size: 384},
+			},
+			want: map[string]interface{}{
+				"secretName": "kubeconfig-admin-tls",
+				"issuerRef": map[string]interface{}{
+					"name":  "tenant",
+					"kind":  "VaultIssuer",
+					"group": "example.com",
+				},
+				"commonName": "kubernetes-admin",
+				"subject": map[string]interface{}{
+					"organizations": []interface{}{"system:masters"},
+				},
+				"privateKey": map[string]interface{}{
+					"algorithm":      "ECDSA",
+					"size":           int64(384),
+					"encoding":       "PKCS8",
+					"rotationPolicy": "Always",
+				},
+				"usages": []interface{}{"digital signature", "client auth"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			certificate := NewCertificate("tenant-1", "test")
+			assert.NoError(t, SetSpec(certificate, test.spec))
+			spec, _, err := unstructured.NestedMap(certificate.Object, "spec")
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, spec)
+		})
+	}
+}
+
+func TestIsReady(t *testing.T) {
+	withConditions := func(generation int64, conditions ...interface{}) *unstructured.Unstructured {
+		certificate := NewCertificate("tenant-1", "test")
+		certificate.SetGeneration(generation)
+		_ = unstructured.SetNestedSlice(certificate.Object, conditions, "status", "conditions")
+		return certificate
+	}
+
+	tests := []struct {
+		name        string
+		certificate *unstructured.Unstructured
+		want        bool
+	}{
+		{name: "no status", certificate: NewCertificate("tenant-1", "test")},
+		{
+			name: "ready",
+			certificate: withConditions(2, map[string]interface{}{
+				"type": "Ready", "status": "True", "observedGeneration": int64(2),
+			}),
+			want: true,
+		},
+		{
+			name: "issuing",
+			certificate: withConditions(2, map[string]interface{}{
+				"type": "Ready", "status": "False", "observedGeneration": int64(2),
+			}),
+		},
+		{
+			name: "ready for a previous spec",
+			certificate: withConditions(3, map[string]interface{}{
+				"type": "Ready", "status": "True", "observedGeneration": int64(2),
+			}),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, IsReady(test.certificate))
+		})
+	}
+}
+
+func TestCreateCertificate(t *testing.T) {
+	// the fake client serves Certificates without the cert-manager api registered
+	scheme := runtime.NewScheme()
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	ctx := context.Background()
+
+	certificate := NewCertificate("tenant-1", "apiserver")
+	assert.NoError(t, SetSpec(certificate, CertificateSpec{
+		SecretName: "apiserver-tls",
+		Issuer:     IssuerRef{Name: "corporate"},
+		Config: &certutil.Config{
+			CommonName: "kube-apiserver",
+			Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		},
+	}))
+	assert.NoError(t, c.Create(ctx, certificate))
+
+	got := NewCertificate("tenant-1", "apiserver")
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(got), got))
+	secretName, _, _ := unstructured.NestedString(got.Object, "spec", "secretName")
+	assert.Equal(t, "apiserver-tls", secretName)
+}
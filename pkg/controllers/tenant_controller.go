@@ -18,10 +18,15 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"net"
+	"sync"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -31,29 +36,91 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
 	"github.com/k8s-cloud-platform/multi-tenants/pkg/conditions"
 	util "github.com/k8s-cloud-platform/multi-tenants/pkg/controllerutil"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/ipam"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/version"
 )
 
 const (
 	tenantFinalizer = "tenancy.kcp.io/tenants"
+
+	// secretIndex indexes the Tenants and EtcdBackends by the Secrets they reference, as
+	// <namespace>/<name>.
+	secretIndex = "secrets"
+	// configMapIndex indexes the Tenants by the ConfigMaps they reference, as <namespace>/<name>.
+	configMapIndex = "configMaps"
+	// etcdBackendIndex indexes the Tenants in Shared mode by the EtcdBackend they are placed on,
+	// the etcd of the manager under the empty name.
+	etcdBackendIndex = "status.etcdBackend"
 )
 
+// fieldIndexes are the indexes of the cache the watched Secrets, ConfigMaps and EtcdBackends
+// are mapped to the tenants with, so an event does not list every Tenant.
+var fieldIndexes = []struct {
+	obj     client.Object
+	field   string
+	extract client.IndexerFunc
+}{
+	{&v1alpha1.Tenant{}, secretIndex, tenantSecrets},
+	{&v1alpha1.Tenant{}, configMapIndex, tenantConfigMaps},
+	{&v1alpha1.Tenant{}, etcdBackendIndex, tenantEtcdBackend},
+	{&v1alpha1.EtcdBackend{}, secretIndex, etcdBackendSecrets},
+}
+
 type TenantController struct {
-	EtcdSecret  map[string][]byte
+	// EtcdSecret is the client secret of the host etcd, it is read on every use so its rotation
+	// is propagated to the tenants.
+	EtcdSecret  types.NamespacedName
 	EtcdServers string
 	Client      client.Client
+	// APIReader reads around the cache of Client, for the checks that must not act on an
+	// outdated object. Client is used if not set.
+	APIReader client.Reader
+
+	// ServiceCIDRPool and PodCIDRPool are the pools the ranges of the tenants are allocated from,
+	// with the prefix lengths ServiceCIDRMaskSize and PodCIDRMaskSize. The default ranges are used
+	// without a pool.
+	ServiceCIDRPool     *net.IPNet
+	ServiceCIDRMaskSize int
+	PodCIDRPool         *net.IPNet
+	PodCIDRMaskSize     int
+
+	networkLock sync.Mutex
+	// networks are the networks allocated by the controller, by tenant name
+	networks map[string]v1alpha1.NetworkStatus
+
+	etcdBackendLock sync.Mutex
+	// etcdBackends are the EtcdBackends the tenants are placed on by the controller, by tenant name
+	etcdBackends map[string]string
 }
 
 var _ reconcile.Reconciler = &TenantController{}
 
 // SetupWithManager sets up the controller with the Manager.
 func (c *TenantController) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
+	for _, index := range fieldIndexes {
+		if err := mgr.GetFieldIndexer().IndexField(context.Background(), index.obj, index.field, index.extract); err != nil {
+			return err
+		}
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.Tenant{}).
+		Owns(&corev1.Namespace{}).
+		Owns(&corev1.Secret{}).
+		Owns(&corev1.Service{}).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(c.tenantsForSecret)).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(c.tenantsForConfigMap)).
+		Watches(&source.Kind{Type: &v1alpha1.EtcdBackend{}}, handler.EnqueueRequestsFromMapFunc(c.tenantsForEtcdBackend)).
 		WithOptions(options).
 		Complete(c)
 }
@@ -77,6 +144,17 @@ func (c *TenantController) Reconcile(ctx context.Context, req reconcile.Request)
 			runtimeObj.ObjectMeta.OwnerReferences = tenant.ObjectMeta.OwnerReferences
 			runtimeObj.Status.Phase = tenant.Status.Phase
 			runtimeObj.Status.Conditions = tenant.Status.Conditions
+			runtimeObj.Status.Version = tenant.Status.Version
+			runtimeObj.Status.Upgrade = tenant.Status.Upgrade
+			runtimeObj.Status.EtcdMode = tenant.Status.EtcdMode
+			runtimeObj.Status.EtcdBackend = tenant.Status.EtcdBackend
+			runtimeObj.Status.Network = tenant.Status.Network
+			runtimeObj.Status.DedicatedEtcd = tenant.Status.DedicatedEtcd
+			runtimeObj.Status.ExternalCA = tenant.Status.ExternalCA
+			runtimeObj.Status.ExternalEndpoint = tenant.Status.ExternalEndpoint
+			runtimeObj.Status.Certificates = tenant.Status.Certificates
+			runtimeObj.Status.CARotation = tenant.Status.CARotation
+			runtimeObj.Status.CARotationTrigger = tenant.Status.CARotationTrigger
 			return nil
 		})
 		if err != nil {
@@ -105,7 +183,18 @@ func (c *TenantController) reconcileDelete(ctx context.Context, tenant *v1alpha1
 		return reconcile.Result{}, nil
 	}
 
+	if !isEtcdDataReleased(tenant) {
+		result, err := c.reconcileEtcdData(ctx, tenant)
+		if err != nil || result.Requeue || !isEtcdDataReleased(tenant) {
+			return result, err
+		}
+		// record the outcome before the finalizer is released and the tenant is gone
+		return reconcile.Result{Requeue: true}, nil
+	}
+
 	// secret、deployment、service delete by GC, OwnerReference
+	c.releaseNetwork(tenant.Name)
+	c.releaseEtcdBackend(tenant.Name)
 	controllerutil.RemoveFinalizer(tenant, tenantFinalizer)
 	return reconcile.Result{}, nil
 }
@@ -113,47 +202,127 @@ func (c *TenantController) reconcileDelete(ctx context.Context, tenant *v1alpha1
 func (c *TenantController) reconcileNormal(ctx context.Context, tenant *v1alpha1.Tenant) (reconcile.Result, error) {
 	klog.V(1).InfoS("reconcile for Tenant normal", "name", tenant.Name)
 
+	if errs := validateTenant(tenant); len(errs) != 0 {
+		klog.ErrorS(errs.ToAggregate(), "invalid spec for Tenant", "name", tenant.Name)
+		conditions.MarkFalse(tenant, v1alpha1.TenantConditionReady, "InvalidSpec", errs.ToAggregate().Error())
+		return reconcile.Result{}, nil
+	}
+
+	if tenant.Status.Version == "" {
+		// the spec is validated so the version always resolves
+		tenant.Status.Version, _ = version.Resolve(tenant.Spec.Version)
+	}
+
+	if tenant.Status.EtcdMode == "" {
+		tenant.Status.EtcdMode = tenant.EtcdMode()
+	}
+
+	if tenant.Status.Network == nil && conditions.Has(tenant, v1alpha1.TenantConditionProvisioned) {
+		// provisioned before the network was reported, which always ran the default network
+		tenant.Status.Network = &v1alpha1.NetworkStatus{
+			ServiceCIDRs: defaultServiceCIDRs,
+			PodCIDRs:     defaultPodCIDRs,
+		}
+	}
+
+	if !conditions.Has(tenant, v1alpha1.TenantConditionProvisioned) {
+		// a new tenant is issued a fresh ca, there is nothing to rotate
+		tenant.Status.CARotationTrigger = tenant.CARotationTrigger()
+
+		// a new tenant is allocated its network, it keeps it once provisioned
+		if tenant.Status.Network == nil {
+			network, err := c.allocateNetwork(ctx, tenant)
+			if errors.Is(err, ipam.ErrPoolExhausted) {
+				klog.V(1).InfoS("waiting for a free network", "name", tenant.Name)
+				conditions.MarkFalse(tenant, v1alpha1.TenantConditionReady, "NetworkUnavailable", err.Error())
+				return reconcile.Result{Requeue: true, RequeueAfter: 30 * time.Second}, nil
+			}
+			if err != nil {
+				klog.ErrorS(err, "unable to allocate network for Tenant", "name", tenant.Name)
+				return reconcile.Result{}, err
+			}
+			tenant.Status.Network = &network
+		}
+
+		// a new tenant is placed on an etcd backend, it stays there once provisioned
+		if tenant.EtcdMode() == v1alpha1.EtcdModeShared {
+			backend, err := c.placeEtcdBackend(ctx, tenant)
+			if errors.Is(err, errNoEtcdBackend) {
+				klog.V(1).InfoS("waiting for an etcd backend", "name", tenant.Name)
+				conditions.MarkFalse(tenant, v1alpha1.TenantConditionReady, "EtcdBackendUnavailable", err.Error())
+				return reconcile.Result{Requeue: true, RequeueAfter: 30 * time.Second}, nil
+			}
+			if err != nil {
+				klog.ErrorS(err, "unable to place Tenant on an etcd backend", "name", tenant.Name)
+				return reconcile.Result{}, err
+			}
+			tenant.Status.EtcdBackend = backend
+		}
+	}
+
 	// ensure namespace
 	ns := &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: tenant.ClusterNamespaceInHost(),
-			OwnerReferences: []metav1.OwnerReference{
-				{
-					APIVersion: tenant.APIVersion,
-					Kind:       tenant.Kind,
-					Name:       tenant.Name,
-					UID:        tenant.UID,
-				},
-			},
 		},
 	}
-	if _, err := util.CreateIfNotExists(ctx, c.Client, ns, func() error {
+	if _, err := util.CreateOrPatch(ctx, c.Client, ns, func() error {
+		ns.ObjectMeta.OwnerReferences = ownerReferences(tenant)
 		return nil
 	}); err != nil {
 		klog.ErrorS(err, "unable to create or update namespace")
 		return reconcile.Result{}, err
 	}
 
-	if !conditions.Has(tenant, v1alpha1.TenantConditionProvisioned) ||
-		conditions.IsFalse(tenant, v1alpha1.TenantConditionProvisioned) {
-		// handle for provisioning
-		phases := []func(context.Context, *v1alpha1.Tenant) error{
-			c.reconcileSecret,
-			c.reconcileKubeConfig,
-			c.reconcileAPIServer,
-			c.reconcileControllerManager,
-		}
+	// reconcile the desired state of every phase, so drift of the owned objects is restored
+	phases := []func(context.Context, *v1alpha1.Tenant) error{
+		c.reconcileEtcd,
+		c.reconcileExpose,
+		c.reconcileSecret,
+		c.reconcileKubeConfig,
+		c.reconcileAuthentication,
+		c.reconcileAuthorization,
+		c.reconcileAudit,
+		c.reconcileAPIServer,
+		c.reconcileControllerManager,
+		c.reconcileScheduler,
+	}
 
-		for _, fun := range phases {
-			err := fun(ctx, tenant)
-			if err != nil {
-				klog.ErrorS(err, "unable to handle for phase")
-				conditions.MarkFalse(tenant, v1alpha1.TenantConditionProvisioned, "Failed", "Failed to handle phase")
-				return reconcile.Result{}, err
-			}
+	for _, fun := range phases {
+		err := fun(ctx, tenant)
+		if errors.Is(err, errCertificatePending) {
+			klog.V(1).InfoS("waiting for certificates to be issued", "name", tenant.Name)
+			conditions.MarkFalse(tenant, v1alpha1.TenantConditionProvisioned, "CertificatePending", "Waiting for the issuer to issue the certificates")
+			return reconcile.Result{Requeue: true, RequeueAfter: 5 * time.Second}, nil
+		}
+		if err != nil {
+			klog.ErrorS(err, "unable to handle for phase")
+			conditions.MarkFalse(tenant, v1alpha1.TenantConditionProvisioned, "Failed", "Failed to handle phase")
+			return reconcile.Result{}, err
 		}
+	}
+
+	conditions.MarkTrue(tenant, v1alpha1.TenantConditionProvisioned, "Success", "Success to provision")
 
-		conditions.MarkTrue(tenant, v1alpha1.TenantConditionProvisioned, "Success", "Success to provision")
+	// report certificate expiry, and come back once the next certificate is to be renewed
+	renewIn, err := c.reconcileCertificates(ctx, tenant)
+	if err != nil {
+		klog.ErrorS(err, "unable to check certificates")
+		return reconcile.Result{}, err
+	}
+
+	// upgrade if the requested version changed
+	if result, err := c.reconcileUpgrade(ctx, tenant); err != nil {
+		return reconcile.Result{}, err
+	} else if result.Requeue {
+		return result, nil
+	}
+
+	// rotate the ca if requested
+	if result, err := c.reconcileCARotation(ctx, tenant); err != nil {
+		return reconcile.Result{}, err
+	} else if result.Requeue {
+		return result, nil
 	}
 
 	// check if ready
@@ -173,17 +342,37 @@ func (c *TenantController) reconcileNormal(ctx context.Context, tenant *v1alpha1
 		return reconcile.Result{}, nil
 	}
 
-	if result, err := checkDeploy(tenant.ClusterNamespaceInHost(), "kube-apiserver"); err != nil {
-		return reconcile.Result{}, err
-	} else if result.Requeue {
-		return result, nil
+	if tenant.EtcdMode() == v1alpha1.EtcdModeDedicated {
+		statefulSet := &appsv1.StatefulSet{}
+		if err := c.Client.Get(ctx, types.NamespacedName{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      etcdName,
+		}, statefulSet); err != nil {
+			klog.ErrorS(err, "unable to get statefulset", "namespace", tenant.ClusterNamespaceInHost(), "name", etcdName)
+			return reconcile.Result{}, err
+		}
+		if statefulSet.Status.ReadyReplicas != etcdReplicas(tenant) {
+			klog.Warningf("statefulset[%s] is not ready", etcdName)
+			return reconcile.Result{Requeue: true, RequeueAfter: 10 * time.Second}, nil
+		}
 	}
-	if result, err := checkDeploy(tenant.ClusterNamespaceInHost(), "kube-controller-manager"); err != nil {
-		return reconcile.Result{}, err
-	} else if result.Requeue {
-		return result, nil
+
+	for _, component := range controlPlaneComponents {
+		if result, err := checkDeploy(tenant.ClusterNamespaceInHost(), component.Name); err != nil {
+			return reconcile.Result{}, err
+		} else if result.Requeue {
+			return result, nil
+		}
 	}
 
 	conditions.MarkTrue(tenant, v1alpha1.TenantConditionReady, "Success", "Ready")
-	return reconcile.Result{}, nil
+	return reconcile.Result{RequeueAfter: renewIn}, nil
+}
+
+// ownerReferences returns the owner references of the objects managed for the tenant,
+// the tenant is the controller so changes of the objects trigger a reconcile.
+func ownerReferences(tenant *v1alpha1.Tenant) []metav1.OwnerReference {
+	return []metav1.OwnerReference{
+		*metav1.NewControllerRef(tenant, v1alpha1.SchemeGroupVersion.WithKind("Tenant")),
+	}
 }
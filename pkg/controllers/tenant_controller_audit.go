@@ -0,0 +1,256 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/audit"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/controllerutil"
+)
+
+const (
+	// auditSecretName is the secret holding the audit policy of the apiserver under
+	// audit-policy.yaml and the kubeconfig of the audit webhook under audit-webhook.conf.
+	auditSecretName = "audit"
+
+	// auditLogDir is the directory the apiserver writes the audit logs to.
+	auditLogDir = "/var/log/kubernetes/audit"
+)
+
+// reconcileAudit reconciles the secret holding the audit configuration of the apiserver, the
+// policy and the webhook kubeconfig are checked so an invalid one is not rolled out.
+func (c *TenantController) reconcileAudit(ctx context.Context, tenant *v1alpha1.Tenant) error {
+	secretObj := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      auditSecretName,
+		},
+	}
+	spec := tenant.Spec.Audit
+	if spec == nil {
+		if _, err := controllerutil.DeleteIfExists(ctx, c.Client, secretObj); err != nil {
+			klog.ErrorS(err, "unable to delete secret for audit")
+			return err
+		}
+		return nil
+	}
+
+	policy, err := c.auditPolicy(ctx, spec)
+	if err != nil {
+		klog.ErrorS(err, "unable to get audit policy")
+		return err
+	}
+	data := map[string][]byte{
+		"audit-policy.yaml": policy,
+	}
+	if webhook := spec.Webhook; webhook != nil {
+		ref := webhook.KubeConfigSecret
+		kubeConfig, err := c.secretData(ctx, &ref, "kubeconfig")
+		if err != nil {
+			klog.ErrorS(err, "unable to get kubeconfig for audit webhook")
+			return err
+		}
+		if err := validateWebhookKubeConfig(kubeConfig); err != nil {
+			return fmt.Errorf("invalid kubeconfig in secret %s/%s: %w", ref.Namespace, ref.Name, err)
+		}
+		if data["audit-webhook.conf"], err = audit.TagWebhookKubeConfig(kubeConfig, tenant.Name); err != nil {
+			klog.ErrorS(err, "unable to tag kubeconfig for audit webhook")
+			return err
+		}
+	}
+
+	if _, err := controllerutil.CreateOrPatch(ctx, c.Client, secretObj, func() error {
+		secretObj.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		secretObj.Data = data
+		return nil
+	}); err != nil {
+		klog.ErrorS(err, "unable to create secret for audit")
+		return err
+	}
+	return nil
+}
+
+// auditPolicy returns the audit policy of the tenant, from the referenced configmap or the preset.
+func (c *TenantController) auditPolicy(ctx context.Context, spec *v1alpha1.AuditSpec) ([]byte, error) {
+	ref := spec.PolicyConfigMap
+	if ref == nil {
+		preset := spec.Preset
+		if preset == "" {
+			preset = v1alpha1.AuditPolicyPresetMetadata
+		}
+		return audit.PresetPolicy(auditv1.Level(preset))
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := c.Client.Get(ctx, types.NamespacedName{
+		Namespace: ref.Namespace,
+		Name:      ref.Name,
+	}, configMap); err != nil {
+		return nil, err
+	}
+	policy := []byte(configMap.Data["policy.yaml"])
+	if err := audit.ValidatePolicy(policy); err != nil {
+		return nil, fmt.Errorf("invalid policy.yaml in configmap %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+	return policy, nil
+}
+
+// tenantsForConfigMap maps a ConfigMap to the tenants using it as their audit policy.
+func (c *TenantController) tenantsForConfigMap(obj client.Object) []reconcile.Request {
+	tenants := &v1alpha1.TenantList{}
+	if err := c.Client.List(context.Background(), tenants,
+		client.MatchingFields{configMapIndex: obj.GetNamespace() + "/" + obj.GetName()}); err != nil {
+		klog.ErrorS(err, "unable to list Tenants")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, tenant := range tenants.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: tenant.Name},
+		})
+	}
+	return requests
+}
+
+// tenantConfigMaps returns the ConfigMaps referenced by the Tenant obj, as <namespace>/<name>.
+func tenantConfigMaps(obj client.Object) []string {
+	tenant := obj.(*v1alpha1.Tenant)
+	if spec := tenant.Spec.Audit; spec != nil && spec.PolicyConfigMap != nil {
+		return []string{spec.PolicyConfigMap.Namespace + "/" + spec.PolicyConfigMap.Name}
+	}
+	return nil
+}
+
+// auditFlags returns the apiserver flags of the audit backends of the tenant. The log file of
+// every pod is named after it, so the replicas do not write to the same file.
+func auditFlags(tenant *v1alpha1.Tenant) []string {
+	spec := tenant.Spec.Audit
+	if spec == nil {
+		return nil
+	}
+
+	flags := []string{"--audit-policy-file=/etc/kubernetes/audit/audit-policy.yaml"}
+	if log := spec.Log; log != nil {
+		maxAge, maxBackups, maxSize := int32(7), int32(10), int32(100)
+		if log.MaxAge != nil {
+			maxAge = *log.MaxAge
+		}
+		if log.MaxBackups != nil {
+			maxBackups = *log.MaxBackups
+		}
+		if log.MaxSize != nil {
+			maxSize = *log.MaxSize
+		}
+		flags = append(flags,
+			fmt.Sprintf("--audit-log-path=%s/%s/$(POD_NAME).log", auditLogDir, tenant.Name),
+			"--audit-log-format=json",
+			fmt.Sprintf("--audit-log-maxage=%d", maxAge),
+			fmt.Sprintf("--audit-log-maxbackup=%d", maxBackups),
+			fmt.Sprintf("--audit-log-maxsize=%d", maxSize),
+		)
+	}
+	if spec.Webhook != nil {
+		flags = append(flags,
+			"--audit-webhook-config-file=/etc/kubernetes/audit/audit-webhook.conf",
+			"--audit-webhook-mode=batch",
+			"--audit-webhook-version=audit.k8s.io/v1",
+		)
+	}
+	return flags
+}
+
+// auditEnv returns the environment the audit flags of the tenant reference.
+func auditEnv(tenant *v1alpha1.Tenant) []corev1.EnvVar {
+	if tenant.Spec.Audit == nil || tenant.Spec.Audit.Log == nil {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{
+			Name: "POD_NAME",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+			},
+		},
+	}
+}
+
+// auditVolumes returns the volumes of the audit configuration and logs of the tenant.
+func auditVolumes(tenant *v1alpha1.Tenant) []corev1.Volume {
+	spec := tenant.Spec.Audit
+	if spec == nil {
+		return nil
+	}
+
+	volumes := []corev1.Volume{
+		{
+			Name: "audit",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: auditSecretName,
+				},
+			},
+		},
+	}
+	if log := spec.Log; log != nil {
+		source := corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+		if log.ClaimName != "" {
+			source = corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: log.ClaimName},
+			}
+		}
+		volumes = append(volumes, corev1.Volume{
+			Name:         "audit-log",
+			VolumeSource: source,
+		})
+	}
+	return volumes
+}
+
+// auditVolumeMounts returns the mounts of the volumes of auditVolumes.
+func auditVolumeMounts(tenant *v1alpha1.Tenant) []corev1.VolumeMount {
+	spec := tenant.Spec.Audit
+	if spec == nil {
+		return nil
+	}
+
+	mounts := []corev1.VolumeMount{
+		{
+			Name:      "audit",
+			MountPath: "/etc/kubernetes/audit",
+			ReadOnly:  true,
+		},
+	}
+	if spec.Log != nil {
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      "audit-log",
+			MountPath: auditLogDir,
+		})
+	}
+	return mounts
+}
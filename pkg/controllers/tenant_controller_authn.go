@@ -0,0 +1,263 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/controllerutil"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/kubeconfig"
+)
+
+const (
+	// oidcCASecretName is the secret holding the ca bundle of the oidc provider under
+	// oidc-ca.crt, copied from the referenced secret so it can be mounted into the apiserver.
+	oidcCASecretName = "oidc-ca"
+
+	// oidcKubeConfigSecretName is the secret holding the kubeconfig authenticating with the
+	// oidc provider under oidc.conf.
+	oidcKubeConfigSecretName = "kubeconfig-oidc"
+
+	// authnWebhookSecretName is the secret holding the kubeconfig of the token authentication
+	// webhook under authn-webhook.conf, copied from the referenced secret.
+	authnWebhookSecretName = "authn-webhook"
+)
+
+// reconcileAuthentication reconciles the secrets of the authenticators of the tenant apiserver,
+// deleting the ones no longer configured.
+func (c *TenantController) reconcileAuthentication(ctx context.Context, tenant *v1alpha1.Tenant) error {
+	oidc := tenant.Spec.Authentication.OIDC
+
+	var oidcCARef *v1alpha1.SecretReference
+	if oidc != nil {
+		oidcCARef = oidc.CASecret
+	}
+	if err := c.reconcileSecretCopy(ctx, tenant, oidcCARef, "ca.crt", oidcCASecretName, "oidc-ca.crt", nil); err != nil {
+		klog.ErrorS(err, "unable to create secret for oidc ca")
+		return err
+	}
+
+	if oidc != nil {
+		if err := c.reconcileOIDCKubeConfig(ctx, tenant); err != nil {
+			klog.ErrorS(err, "unable to create kubeconfig for oidc")
+			return err
+		}
+	} else if _, err := controllerutil.DeleteIfExists(ctx, c.Client, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      oidcKubeConfigSecretName,
+		},
+	}); err != nil {
+		klog.ErrorS(err, "unable to delete kubeconfig for oidc")
+		return err
+	}
+
+	var webhookRef *v1alpha1.SecretReference
+	if webhook := tenant.Spec.Authentication.Webhook; webhook != nil {
+		webhookRef = &webhook.KubeConfigSecret
+	}
+	if err := c.reconcileSecretCopy(ctx, tenant, webhookRef, "kubeconfig", authnWebhookSecretName, "authn-webhook.conf",
+		validateWebhookKubeConfig); err != nil {
+		klog.ErrorS(err, "unable to create secret for authentication webhook")
+		return err
+	}
+
+	return nil
+}
+
+// reconcileSecretCopy copies key of the referenced secret into the secret name in the namespace of
+// the tenant under target, so it can be mounted into the apiserver. The data is checked with
+// validate if set, the copy keeps the last valid data. The copy is deleted if ref is nil.
+func (c *TenantController) reconcileSecretCopy(ctx context.Context, tenant *v1alpha1.Tenant, ref *v1alpha1.SecretReference,
+	key, name, target string, validate func([]byte) error) error {
+	secretObj := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      name,
+		},
+	}
+	if ref == nil {
+		_, err := controllerutil.DeleteIfExists(ctx, c.Client, secretObj)
+		return err
+	}
+
+	data, err := c.secretData(ctx, ref, key)
+	if err != nil {
+		return err
+	}
+	if validate != nil {
+		if err := validate(data); err != nil {
+			return fmt.Errorf("invalid %s in secret %s/%s: %w", key, ref.Namespace, ref.Name, err)
+		}
+	}
+
+	_, err = controllerutil.CreateOrPatch(ctx, c.Client, secretObj, func() error {
+		secretObj.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		secretObj.Data = map[string][]byte{
+			target: data,
+		}
+		return nil
+	})
+	return err
+}
+
+// secretData returns key of the referenced secret, failing if it is missing or empty.
+func (c *TenantController) secretData(ctx context.Context, ref *v1alpha1.SecretReference, key string) ([]byte, error) {
+	source := &corev1.Secret{}
+	if err := c.Client.Get(ctx, types.NamespacedName{
+		Namespace: ref.Namespace,
+		Name:      ref.Name,
+	}, source); err != nil {
+		return nil, err
+	}
+	data := source.Data[key]
+	if len(data) == 0 {
+		return nil, fmt.Errorf("secret %s/%s holds no %s", ref.Namespace, ref.Name, key)
+	}
+	return data, nil
+}
+
+// validateWebhookKubeConfig checks the kubeconfig of a webhook is usable by the apiserver: its
+// current context is complete and references no files or plugins, which are missing in its pod.
+func validateWebhookKubeConfig(data []byte) error {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return err
+	}
+	if err := clientcmd.Validate(*config); err != nil {
+		return err
+	}
+	restConfig, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return err
+	}
+	if restConfig.CAFile != "" || restConfig.CertFile != "" || restConfig.KeyFile != "" || restConfig.BearerTokenFile != "" {
+		return errors.New("must embed the certificates and credentials instead of referencing files")
+	}
+	if restConfig.ExecProvider != nil || restConfig.AuthProvider != nil {
+		return errors.New("must not use exec or auth provider plugins")
+	}
+	return nil
+}
+
+// reconcileOIDCKubeConfig reconciles the kubeconfig of the users authenticating with the oidc
+// provider, for the external endpoint of the tenant if exposed.
+func (c *TenantController) reconcileOIDCKubeConfig(ctx context.Context, tenant *v1alpha1.Tenant) error {
+	caSecret := &corev1.Secret{}
+	if err := c.Client.Get(ctx, types.NamespacedName{
+		Namespace: tenant.ClusterNamespaceInHost(),
+		Name:      caSecretName,
+	}, caSecret); err != nil {
+		return err
+	}
+	endpoint := apiServerEndpoint(tenant)
+	if tenant.Status.ExternalEndpoint != "" {
+		endpoint = tenant.Status.ExternalEndpoint
+	}
+
+	oidc := tenant.Spec.Authentication.OIDC
+	config := kubeconfig.NewWithOIDC(tenant.Name, endpoint, caSecret.Data[caBundleKey], oidc.IssuerURL, oidc.ClientID, oidcExtraScopes(oidc))
+	kubeConfig, err := clientcmd.Write(*config)
+	if err != nil {
+		return err
+	}
+
+	secretObj := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      oidcKubeConfigSecretName,
+		},
+	}
+	_, err = controllerutil.CreateOrPatch(ctx, c.Client, secretObj, func() error {
+		secretObj.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		secretObj.Type = "kcp/kubeconfig"
+		secretObj.Data = map[string][]byte{
+			"oidc.conf": kubeConfig,
+		}
+		return nil
+	})
+	return err
+}
+
+// oidcExtraScopes returns the scopes requested by the OIDC kubeconfig in addition to openid, the
+// groups scope is requested by default when the groups claim is used, as most providers only
+// include the groups in the ID token then.
+func oidcExtraScopes(oidc *v1alpha1.OIDCSpec) []string {
+	if len(oidc.ExtraScopes) > 0 {
+		return oidc.ExtraScopes
+	}
+	if oidc.GroupsClaim != "" {
+		return []string{"groups"}
+	}
+	return nil
+}
+
+// authenticationProjections returns the projections of the secrets of the authenticators of the
+// tenant into the pki of the apiserver.
+func authenticationProjections(tenant *v1alpha1.Tenant) []corev1.VolumeProjection {
+	var projections []corev1.VolumeProjection
+	if oidc := tenant.Spec.Authentication.OIDC; oidc != nil && oidc.CASecret != nil {
+		projections = append(projections, secretProjection(oidcCASecretName, "oidc-ca.crt"))
+	}
+	if tenant.Spec.Authentication.Webhook != nil {
+		projections = append(projections, secretProjection(authnWebhookSecretName, "authn-webhook.conf"))
+	}
+	return projections
+}
+
+// authenticationFlags returns the apiserver flags of the authenticators of the tenant.
+func authenticationFlags(tenant *v1alpha1.Tenant) []string {
+	var flags []string
+	if oidc := tenant.Spec.Authentication.OIDC; oidc != nil {
+		flags = append(flags,
+			"--oidc-issuer-url="+oidc.IssuerURL,
+			"--oidc-client-id="+oidc.ClientID,
+		)
+		if oidc.CASecret != nil {
+			flags = append(flags, "--oidc-ca-file=/etc/kubernetes/pki/oidc-ca.crt")
+		}
+		for _, flag := range []struct {
+			name  string
+			value string
+		}{
+			{"oidc-username-claim", oidc.UsernameClaim},
+			{"oidc-username-prefix", oidc.UsernamePrefix},
+			{"oidc-groups-claim", oidc.GroupsClaim},
+			{"oidc-groups-prefix", oidc.GroupsPrefix},
+		} {
+			if flag.value != "" {
+				flags = append(flags, "--"+flag.name+"="+flag.value)
+			}
+		}
+	}
+	if tenant.Spec.Authentication.Webhook != nil {
+		flags = append(flags,
+			"--authentication-token-webhook-config-file=/etc/kubernetes/pki/authn-webhook.conf",
+			"--authentication-token-webhook-version=v1",
+		)
+	}
+	return flags
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestReconcileOIDCKubeConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		oidc       v1alpha1.OIDCSpec
+		wantScopes []string
+	}{
+		{
+			name: "no groups",
+		},
+		{
+			name:       "groups claim",
+			oidc:       v1alpha1.OIDCSpec{GroupsClaim: "groups"},
+			wantScopes: []string{"--oidc-extra-scope=groups"},
+		},
+		{
+			name: "extra scopes",
+			oidc: v1alpha1.OIDCSpec{GroupsClaim: "roles", ExtraScopes: []string{"roles", "email"}},
+			wantScopes: []string{
+				"--oidc-extra-scope=roles",
+				"--oidc-extra-scope=email",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+			tenant.Spec.Authentication.OIDC = &test.oidc
+			tenant.Spec.Authentication.OIDC.IssuerURL = "https://sso.example.com"
+			tenant.Spec.Authentication.OIDC.ClientID = "tenants"
+			caSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tenant.ClusterNamespaceInHost(), Name: caSecretName},
+				Data:       map[string][]byte{caBundleKey: []byte("ca")},
+			}
+			c := &TenantController{Client: newFakeClient(caSecret)}
+			assert.NoError(t, c.reconcileOIDCKubeConfig(context.Background(), tenant))
+
+			secret := &corev1.Secret{}
+			assert.NoError(t, c.Client.Get(context.Background(), types.NamespacedName{
+				Namespace: tenant.ClusterNamespaceInHost(),
+				Name:      oidcKubeConfigSecretName,
+			}, secret))
+			config, err := clientcmd.Load(secret.Data["oidc.conf"])
+			assert.NoError(t, err)
+			exec := config.AuthInfos["tenant-oidc"].Exec
+			if assert.NotNil(t, exec) {
+				assert.Equal(t, append([]string{
+					"oidc-login",
+					"get-token",
+					"--oidc-issuer-url=https://sso.example.com",
+					"--oidc-client-id=tenants",
+				}, test.wantScopes...), exec.Args)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+)
+
+// authzWebhookSecretName is the secret holding the kubeconfig of the authorization webhook under
+// authz-webhook.conf, copied from the referenced secret.
+const authzWebhookSecretName = "authz-webhook"
+
+// reconcileAuthorization reconciles the secrets of the authorizers of the tenant apiserver,
+// deleting the ones no longer configured.
+func (c *TenantController) reconcileAuthorization(ctx context.Context, tenant *v1alpha1.Tenant) error {
+	var webhookRef *v1alpha1.SecretReference
+	if webhook := tenant.Spec.Authorization.Webhook; webhook != nil {
+		webhookRef = &webhook.KubeConfigSecret
+	}
+	if err := c.reconcileSecretCopy(ctx, tenant, webhookRef, "kubeconfig", authzWebhookSecretName, "authz-webhook.conf",
+		validateWebhookKubeConfig); err != nil {
+		klog.ErrorS(err, "unable to create secret for authorization webhook")
+		return err
+	}
+	return nil
+}
+
+// authorizationProjections returns the projections of the secrets of the authorizers of the
+// tenant into the pki of the apiserver.
+func authorizationProjections(tenant *v1alpha1.Tenant) []corev1.VolumeProjection {
+	if tenant.Spec.Authorization.Webhook == nil {
+		return nil
+	}
+	return []corev1.VolumeProjection{secretProjection(authzWebhookSecretName, "authz-webhook.conf")}
+}
+
+// authorizationFlags returns the apiserver flags of the authorizers of the tenant. The webhook is
+// asked last, for the requests neither the Node nor the RBAC authorizer allows.
+func authorizationFlags(tenant *v1alpha1.Tenant) []string {
+	if tenant.Spec.Authorization.Webhook == nil {
+		return []string{"--authorization-mode=Node,RBAC"}
+	}
+	return []string{
+		"--authorization-mode=Node,RBAC,Webhook",
+		"--authorization-webhook-config-file=/etc/kubernetes/pki/authz-webhook.conf",
+		"--authorization-webhook-version=v1",
+	}
+}
+
+// secretReferences returns the secrets the authenticators, the authorizers and the audit
+// webhook of the tenant reference.
+func secretReferences(tenant *v1alpha1.Tenant) []*v1alpha1.SecretReference {
+	var refs []*v1alpha1.SecretReference
+	if oidc := tenant.Spec.Authentication.OIDC; oidc != nil && oidc.CASecret != nil {
+		refs = append(refs, oidc.CASecret)
+	}
+	if webhook := tenant.Spec.Authentication.Webhook; webhook != nil {
+		refs = append(refs, &webhook.KubeConfigSecret)
+	}
+	if webhook := tenant.Spec.Authorization.Webhook; webhook != nil {
+		refs = append(refs, &webhook.KubeConfigSecret)
+	}
+	if audit := tenant.Spec.Audit; audit != nil && audit.Webhook != nil {
+		refs = append(refs, &audit.Webhook.KubeConfigSecret)
+	}
+	return refs
+}
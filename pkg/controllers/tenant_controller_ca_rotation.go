@@ -0,0 +1,184 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/conditions"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+)
+
+const (
+	// caBundleKey is the key of the ca secret holding the cas trusted by the tenant, the
+	// control plane and the kubeconfigs trust the bundle rather than the signing ca so both cas
+	// are trusted during a rotation.
+	caBundleKey = "ca-bundle.crt"
+
+	defaultCARotationOverlap = time.Hour
+)
+
+// caRotationOverlap returns how long both cas are trusted once the leaves are signed by the new ca.
+func caRotationOverlap(tenant *v1alpha1.Tenant) time.Duration {
+	if tenant.Spec.Certificates.CARotationOverlap == nil {
+		return defaultCARotationOverlap
+	}
+	return tenant.Spec.Certificates.CARotationOverlap.Duration
+}
+
+// ensureServerCA makes sure data holds the signing tenant ca under ca.crt and ca.key, and the
+// cas trusted in the current stage of the rotation under ca-bundle.crt. The new ca is kept under
+// ca-new.crt and ca-new.key until it takes over signing, the old one under ca-old.crt until it
+// is dropped.
+func ensureServerCA(data map[string][]byte, rotation *v1alpha1.CARotationStatus, keyConfig secret.KeyConfig) (*x509.Certificate, crypto.Signer, error) {
+	var stage v1alpha1.CARotationStage
+	if rotation != nil {
+		stage = rotation.Stage
+	}
+
+	// the new ca takes over signing, the leaves signed by the old ca are reissued by ensureCert
+	if stage == v1alpha1.CARotationStageSignWithNew {
+		if _, _, err := decodeCertAndKey(data, "ca-new"); err == nil {
+			data["ca-old.crt"] = data["ca.crt"]
+			data["ca.crt"] = data["ca-new.crt"]
+			data["ca.key"] = data["ca-new.key"]
+		}
+	}
+
+	caCert, caKey, err := ensureCA(data, "ca", nil, keyConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	trusted := []*x509.Certificate{caCert}
+
+	switch stage {
+	case v1alpha1.CARotationStageTrustBoth:
+		newCACert, _, err := ensureCA(data, "ca-new", nil, keyConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		trusted = append(trusted, newCACert)
+	case v1alpha1.CARotationStageSignWithNew:
+		if oldCACert, err := secret.DecodeCertPEM(data["ca-old.crt"]); err == nil {
+			trusted = append(trusted, oldCACert)
+		}
+	}
+	if stage != v1alpha1.CARotationStageTrustBoth {
+		delete(data, "ca-new.crt")
+		delete(data, "ca-new.key")
+	}
+	if stage != v1alpha1.CARotationStageSignWithNew {
+		delete(data, "ca-old.crt")
+	}
+
+	data[caBundleKey] = secret.EncodeCertsPEM(trusted...)
+	return caCert, caKey, nil
+}
+
+// reconcileCARotation walks the tenant ca through the stages of a rotation once the trigger
+// changes. Every stage waits for the control plane to roll out with the secrets of the stage:
+// the new ca is issued and trusted next to the old one, then takes over signing while the old
+// one stays trusted for the overlap window, and finally the old ca is dropped.
+func (c *TenantController) reconcileCARotation(ctx context.Context, tenant *v1alpha1.Tenant) (reconcile.Result, error) {
+	rotation := tenant.Status.CARotation
+	if tenant.Spec.Certificates.CA != nil || tenant.Spec.Certificates.Issuer != nil {
+		if rotation != nil || tenant.CARotationTrigger() != tenant.Status.CARotationTrigger {
+			message := "The ca is managed in the referenced Secret, rotate it by updating the Secret"
+			if tenant.Spec.Certificates.Issuer != nil {
+				message = "The ca is managed by the referenced issuer, rotate it with the issuer"
+			}
+			conditions.MarkFalse(tenant, v1alpha1.TenantConditionCARotating, "ExternalCA", message)
+			tenant.Status.CARotation = nil
+			// the trigger is consumed, it does not rotate the ca once the reference is removed
+			tenant.Status.CARotationTrigger = tenant.CARotationTrigger()
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if rotation == nil {
+		trigger := tenant.CARotationTrigger()
+		if trigger == tenant.Status.CARotationTrigger {
+			return reconcile.Result{}, nil
+		}
+
+		klog.InfoS("rotate ca for Tenant", "name", tenant.Name, "trigger", trigger)
+		tenant.Status.CARotation = &v1alpha1.CARotationStatus{Trigger: trigger}
+		setCARotationStage(tenant, v1alpha1.CARotationStageTrustBoth, "Issued the new ca, trusting both cas")
+		// the secrets are rewritten for the stage by the next reconcile
+		return reconcile.Result{Requeue: true}, nil
+	}
+
+	// the phases have just patched the deployments with the secrets of the stage, they are read
+	// around the cache so a deployment not updated yet is not taken for rolled out
+	reader := c.APIReader
+	if reader == nil {
+		reader = c.Client
+	}
+	for _, component := range controlPlaneComponents {
+		deployment := &appsv1.Deployment{}
+		if err := reader.Get(ctx, types.NamespacedName{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      component.Name,
+		}, deployment); err != nil {
+			klog.ErrorS(err, "unable to get deployment", "name", component.Name)
+			return reconcile.Result{}, err
+		}
+		hash, err := secretsHash(ctx, reader, tenant.ClusterNamespaceInHost(), certificatesHashSecrets[component.Name]...)
+		if err != nil {
+			klog.ErrorS(err, "unable to hash secrets", "name", component.Name)
+			return reconcile.Result{}, err
+		}
+		if deployment.Spec.Template.Annotations[certificatesHashAnnotation] != hash || !isDeploymentRolledOut(deployment) {
+			klog.V(1).InfoS("waiting for deployment to roll out", "name", component.Name, "stage", rotation.Stage)
+			return reconcile.Result{Requeue: true, RequeueAfter: 10 * time.Second}, nil
+		}
+	}
+
+	switch rotation.Stage {
+	case v1alpha1.CARotationStageTrustBoth:
+		setCARotationStage(tenant, v1alpha1.CARotationStageSignWithNew, "Signing with the new ca, trusting both cas")
+	case v1alpha1.CARotationStageSignWithNew:
+		// give the clients the overlap window to pick up the new ca before the old one is dropped
+		if wait := time.Until(rotation.LastTransitionTime.Add(caRotationOverlap(tenant))); wait > 0 {
+			return reconcile.Result{Requeue: true, RequeueAfter: wait}, nil
+		}
+		setCARotationStage(tenant, v1alpha1.CARotationStageTrustNew, "Signing with the new ca, dropped the old ca")
+	default:
+		tenant.Status.CARotationTrigger = rotation.Trigger
+		tenant.Status.CARotation = nil
+		conditions.MarkFalse(tenant, v1alpha1.TenantConditionCARotating, "Completed", "Rotated the ca")
+		return reconcile.Result{}, nil
+	}
+	return reconcile.Result{Requeue: true}, nil
+}
+
+// setCARotationStage moves the ca rotation in flight to the stage.
+func setCARotationStage(tenant *v1alpha1.Tenant, stage v1alpha1.CARotationStage, message string) {
+	tenant.Status.CARotation.Stage = stage
+	tenant.Status.CARotation.LastTransitionTime = metav1.Now()
+	conditions.MarkTrue(tenant, v1alpha1.TenantConditionCARotating, string(stage), message)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/conditions"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+)
+
+func TestReconcileCARotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		trigger     string
+		rotation    *v1alpha1.CARotationStatus
+		external    bool
+		rolling     []string
+		outdated    []string
+		wantStage   v1alpha1.CARotationStage
+		wantTrigger string
+		wantResult  reconcile.Result
+	}{
+		{
+			name:        "trigger unchanged",
+			trigger:     "1",
+			wantTrigger: "1",
+		},
+		{
+			name:        "trigger changed",
+			trigger:     "2",
+			wantStage:   v1alpha1.CARotationStageTrustBoth,
+			wantTrigger: "1",
+			wantResult:  reconcile.Result{Requeue: true},
+		},
+		{
+			name:    "waiting for the rollout",
+			trigger: "2",
+			rotation: &v1alpha1.CARotationStatus{
+				Trigger: "2",
+				Stage:   v1alpha1.CARotationStageTrustBoth,
+			},
+			rolling:     []string{"kube-scheduler"},
+			wantStage:   v1alpha1.CARotationStageTrustBoth,
+			wantTrigger: "1",
+			wantResult:  reconcile.Result{Requeue: true, RequeueAfter: 10 * time.Second},
+		},
+		{
+			name:    "deployment not updated for the stage",
+			trigger: "2",
+			rotation: &v1alpha1.CARotationStatus{
+				Trigger: "2",
+				Stage:   v1alpha1.CARotationStageTrustBoth,
+			},
+			outdated:    []string{"kube-apiserver"},
+			wantStage:   v1alpha1.CARotationStageTrustBoth,
+			wantTrigger: "1",
+			wantResult:  reconcile.Result{Requeue: true, RequeueAfter: 10 * time.Second},
+		},
+		{
+			name:    "trust both rolled out",
+			trigger: "2",
+			rotation: &v1alpha1.CARotationStatus{
+				Trigger: "2",
+				Stage:   v1alpha1.CARotationStageTrustBoth,
+			},
+			wantStage:   v1alpha1.CARotationStageSignWithNew,
+			wantTrigger: "1",
+			wantResult:  reconcile.Result{Requeue: true},
+		},
+		{
+			name:    "sign with new in the overlap window",
+			trigger: "2",
+			rotation: &v1alpha1.CARotationStatus{
+				Trigger:            "2",
+				Stage:              v1alpha1.CARotationStageSignWithNew,
+				LastTransitionTime: metav1.Now(),
+			},
+			wantStage:   v1alpha1.CARotationStageSignWithNew,
+			wantTrigger: "1",
+			wantResult:  reconcile.Result{Requeue: true, RequeueAfter: defaultCARotationOverlap},
+		},
+		{
+			name:    "sign with new after the overlap window",
+			trigger: "2",
+			rotation: &v1alpha1.CARotationStatus{
+				Trigger:            "2",
+				Stage:              v1alpha1.CARotationStageSignWithNew,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-2 * defaultCARotationOverlap)),
+			},
+			wantStage:   v1alpha1.CARotationStageTrustNew,
+			wantTrigger: "1",
+			wantResult:  reconcile.Result{Requeue: true},
+		},
+		{
+			name:    "trust new rolled out",
+			trigger: "2",
+			rotation: &v1alpha1.CARotationStatus{
+				Trigger: "2",
+				Stage:   v1alpha1.CARotationStageTrustNew,
+			},
+			wantTrigger: "2",
+		},
+		{
+			name:    "external ca",
+			trigger: "2",
+			rotation: &v1alpha1.CARotationStatus{
+				Trigger: "2",
+				Stage:   v1alpha1.CARotationStageTrustBoth,
+			},
+			external:    true,
+			wantTrigger: "2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+			tenant.Spec.Certificates.CARotation = test.trigger
+			tenant.Status.CARotationTrigger = "1"
+			tenant.Status.CARotation = test.rotation
+			if test.external {
+				tenant.Spec.Certificates.CA = &v1alpha1.CASecretReference{Namespace: "default", Name: "ca"}
+			}
+			namespace := tenant.ClusterNamespaceInHost()
+			previous := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: caSecretName},
+				Data:       map[string][]byte{caBundleKey: []byte("previous")},
+			}
+			current := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: caSecretName},
+				Data:       map[string][]byte{caBundleKey: []byte("current")},
+			}
+			// controlPlane returns the deployments with the hash of the ca secret on their pod
+			// templates, the outdated ones with the hash of the previous secret
+			controlPlane := func(secretObj *corev1.Secret, rolling []string, outdated []string) []client.Object {
+				objs := newControlPlaneDeployments(tenant, rolling...)
+				for _, obj := range objs {
+					hashed := secretObj
+					if containsString(outdated, obj.GetName()) {
+						hashed = previous
+					}
+					hash, err := secretsHash(context.Background(), newFakeClient(hashed), namespace, certificatesHashSecrets[obj.GetName()]...)
+					assert.NoError(t, err)
+					obj.(*appsv1.Deployment).Spec.Template.Annotations = map[string]string{certificatesHashAnnotation: hash}
+				}
+				return append(objs, secretObj)
+			}
+			c := &TenantController{
+				// the cache still holds the rolled out deployments of the previous stage
+				Client:    newFakeClient(controlPlane(previous, nil, nil)...),
+				APIReader: newFakeClient(controlPlane(current, test.rolling, test.outdated)...),
+			}
+
+			result, err := c.reconcileCARotation(context.Background(), tenant)
+			assert.NoError(t, err)
+			if test.wantResult.RequeueAfter > time.Minute {
+				// the overlap window is counted from the transition of the stage
+				assert.InDelta(t, test.wantResult.RequeueAfter, result.RequeueAfter, float64(time.Minute))
+				result.RequeueAfter = test.wantResult.RequeueAfter
+			}
+			assert.Equal(t, test.wantResult, result)
+			var stage v1alpha1.CARotationStage
+			if tenant.Status.CARotation != nil {
+				stage = tenant.Status.CARotation.Stage
+			}
+			assert.Equal(t, test.wantStage, stage)
+			assert.Equal(t, test.wantTrigger, tenant.Status.CARotationTrigger)
+		})
+	}
+}
+
+func TestReconcileCARotationExternalCA(t *testing.T) {
+	tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+	tenant.Spec.Certificates.CA = &v1alpha1.CASecretReference{Namespace: "default", Name: "ca"}
+	tenant.Spec.Certificates.CARotation = "2"
+	tenant.Status.CARotationTrigger = "1"
+	c := &TenantController{Client: newFakeClient(newControlPlaneDeployments(tenant)...)}
+
+	// the trigger is consumed while the ca is external
+	result, err := c.reconcileCARotation(context.Background(), tenant)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, result)
+	assert.Equal(t, "ExternalCA", conditions.GetReason(tenant, v1alpha1.TenantConditionCARotating))
+	assert.Equal(t, "2", tenant.Status.CARotationTrigger)
+
+	// and does not rotate the ca once the reference is removed
+	tenant.Spec.Certificates.CA = nil
+	result, err = c.reconcileCARotation(context.Background(), tenant)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, result)
+	assert.Nil(t, tenant.Status.CARotation)
+	assert.Equal(t, "ExternalCA", conditions.GetReason(tenant, v1alpha1.TenantConditionCARotating))
+}
+
+func TestEnsureServerCA(t *testing.T) {
+	keyConfig := secret.KeyConfig{Algorithm: secret.KeyAlgorithmECDSA}
+	data := map[string][]byte{}
+
+	// bundle returns the subject key ids of the cas trusted in data
+	bundle := func() []string {
+		cas, err := secret.DecodeCertsPEM(data[caBundleKey])
+		assert.NoError(t, err)
+		var ids []string
+		for _, ca := range cas {
+			ids = append(ids, string(ca.SubjectKeyId))
+		}
+		return ids
+	}
+
+	oldCA, _, err := ensureServerCA(data, nil, keyConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{string(oldCA.SubjectKeyId)}, bundle())
+
+	rotation := &v1alpha1.CARotationStatus{Stage: v1alpha1.CARotationStageTrustBoth}
+	caCert, _, err := ensureServerCA(data, rotation, keyConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, oldCA.SubjectKeyId, caCert.SubjectKeyId)
+	newCA, err := secret.DecodeCertPEM(data["ca-new.crt"])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{string(oldCA.SubjectKeyId), string(newCA.SubjectKeyId)}, bundle())
+
+	rotation.Stage = v1alpha1.CARotationStageSignWithNew
+	for i := 0; i < 2; i++ {
+		// the new ca takes over once, the old one is kept on the next reconcile
+		caCert, _, err = ensureServerCA(data, rotation, keyConfig)
+		assert.NoError(t, err)
+		assert.Equal(t, newCA.SubjectKeyId, caCert.SubjectKeyId)
+		assert.NotContains(t, data, "ca-new.crt")
+		assert.NotContains(t, data, "ca-new.key")
+		assert.Equal(t, []string{string(newCA.SubjectKeyId), string(oldCA.SubjectKeyId)}, bundle())
+	}
+
+	rotation.Stage = v1alpha1.CARotationStageTrustNew
+	caCert, _, err = ensureServerCA(data, rotation, keyConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, newCA.SubjectKeyId, caCert.SubjectKeyId)
+	assert.NotContains(t, data, "ca-old.crt")
+	assert.Equal(t, []string{string(newCA.SubjectKeyId)}, bundle())
+}
@@ -0,0 +1,314 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/clientcmd"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/certmanager"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+)
+
+// ensureCA makes sure data holds a ca certificate and key under <name>.crt and <name>.key,
+// a new ca is issued with a key as selected by keyConfig if they are missing or invalid. An
+// existing ca keeps its key whatever its algorithm, changing it takes a ca rotation.
+func ensureCA(data map[string][]byte, name string, config *certutil.Config, keyConfig secret.KeyConfig) (*x509.Certificate, crypto.Signer, error) {
+	if caCert, caKey, err := decodeCertAndKey(data, name); err == nil && caCert.IsCA {
+		return caCert, caKey, nil
+	}
+
+	caCert, caKey, err := secret.NewCA(config, keyConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	encodedKey, err := secret.EncodePrivateKeyPEM(caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	data[name+".crt"] = secret.EncodeCertPEM(caCert)
+	data[name+".key"] = encodedKey
+	return caCert, caKey, nil
+}
+
+// loadCA returns the ca certificate and key of the referenced Secret, checked to belong together
+// and to be able to sign certificates.
+func (c *TenantController) loadCA(ctx context.Context, ref *v1alpha1.CASecretReference) (*x509.Certificate, crypto.Signer, error) {
+	secretObj := &corev1.Secret{}
+	if err := c.Client.Get(ctx, types.NamespacedName{
+		Namespace: ref.Namespace,
+		Name:      ref.Name,
+	}, secretObj); err != nil {
+		return nil, nil, err
+	}
+
+	caCert, err := secret.DecodeCertPEM(secretObj.Data[corev1.TLSCertKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to decode %s of secret %s/%s: %v", corev1.TLSCertKey, ref.Namespace, ref.Name, err)
+	}
+	caKey, err := secret.DecodePrivateKeyPEM(secretObj.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to decode %s of secret %s/%s: %v", corev1.TLSPrivateKeyKey, ref.Namespace, ref.Name, err)
+	}
+	if err := secret.ValidateCA(caCert, caKey); err != nil {
+		return nil, nil, fmt.Errorf("invalid ca in secret %s/%s: %v", ref.Namespace, ref.Name, err)
+	}
+	return caCert, caKey, nil
+}
+
+// tenantsForSecret maps a Secret to the tenants using it, so they pick up its changes: the tenants
+// referencing it as their ca or for their authenticators and authorizers, the tenant a Secret
+// issued by cert-manager is issued for, and the tenants in Shared mode for the client secret of
+// their etcd.
+func (c *TenantController) tenantsForSecret(obj client.Object) []reconcile.Request {
+	if _, ok := obj.GetAnnotations()[certmanager.CertificateNameAnnotation]; ok && strings.HasPrefix(obj.GetNamespace(), "tenant-") {
+		return []reconcile.Request{{
+			NamespacedName: types.NamespacedName{Name: strings.TrimPrefix(obj.GetNamespace(), "tenant-")},
+		}}
+	}
+
+	key := obj.GetNamespace() + "/" + obj.GetName()
+	tenants := &v1alpha1.TenantList{}
+	if err := c.Client.List(context.Background(), tenants, client.MatchingFields{secretIndex: key}); err != nil {
+		klog.ErrorS(err, "unable to list Tenants")
+		return nil
+	}
+	names := sets.NewString()
+	for _, tenant := range tenants.Items {
+		names.Insert(tenant.Name)
+	}
+
+	// the etcds using the secret for their clients, the etcd of the manager under the empty name
+	var etcds []string
+	if obj.GetNamespace() == c.EtcdSecret.Namespace && obj.GetName() == c.EtcdSecret.Name {
+		etcds = append(etcds, "")
+	}
+	backends := &v1alpha1.EtcdBackendList{}
+	if err := c.Client.List(context.Background(), backends, client.MatchingFields{secretIndex: key}); err != nil {
+		klog.ErrorS(err, "unable to list EtcdBackends")
+		return nil
+	}
+	for _, backend := range backends.Items {
+		etcds = append(etcds, backend.Name)
+	}
+	for _, etcd := range etcds {
+		tenants := &v1alpha1.TenantList{}
+		if err := c.Client.List(context.Background(), tenants, client.MatchingFields{etcdBackendIndex: etcd}); err != nil {
+			klog.ErrorS(err, "unable to list Tenants")
+			return nil
+		}
+		for _, tenant := range tenants.Items {
+			names.Insert(tenant.Name)
+		}
+	}
+
+	var requests []reconcile.Request
+	for _, name := range names.List() {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: name},
+		})
+	}
+	return requests
+}
+
+// tenantSecrets returns the Secrets referenced by the Tenant obj, as <namespace>/<name>.
+func tenantSecrets(obj client.Object) []string {
+	tenant := obj.(*v1alpha1.Tenant)
+	var keys []string
+	for _, ref := range []*v1alpha1.CASecretReference{tenant.Spec.Certificates.CA, tenant.Spec.Certificates.FrontProxyCA} {
+		if ref != nil {
+			keys = append(keys, ref.Namespace+"/"+ref.Name)
+		}
+	}
+	for _, ref := range secretReferences(tenant) {
+		keys = append(keys, ref.Namespace+"/"+ref.Name)
+	}
+	return keys
+}
+
+// useCA makes data hold the certificate of a referenced ca under <name>.crt. Its key is never
+// copied into the tenant, the leaves are signed with the key read from the referenced Secret.
+func useCA(data map[string][]byte, name string, caCert *x509.Certificate) {
+	data[name+".crt"] = secret.EncodeCertPEM(caCert)
+	delete(data, name+".key")
+}
+
+// ensureCert makes sure data holds a certificate and key under <name>.crt and <name>.key signed
+// by the given ca, the certificate is reissued if it is missing, invalid, signed by another ca,
+// its subject alternative names or key algorithm changed or it is due for renewal.
+func ensureCert(data map[string][]byte, name string, caCert *x509.Certificate, caKey crypto.Signer, config *certutil.Config, renewal certRenewal) error {
+	if cert, _, err := decodeCertAndKey(data, name); err == nil && cert.CheckSignatureFrom(caCert) == nil &&
+		secret.HasAltNames(cert, config.AltNames) && renewal.Key.Matches(cert.PublicKey) && !renewal.due(cert, caCert) {
+		return nil
+	}
+
+	cert, key, err := secret.NewCertAndKey(caCert, caKey, config, renewal.Key, renewal.Validity)
+	if err != nil {
+		return err
+	}
+	encodedKey, err := secret.EncodePrivateKeyPEM(key)
+	if err != nil {
+		return err
+	}
+	data[name+".crt"] = secret.EncodeCertPEM(cert)
+	data[name+".key"] = encodedKey
+	return nil
+}
+
+// apiServerAltNames returns the subject alternative names of the apiserver certificate, covering
+// the apiserver Service in the host cluster, the kubernetes Service inside the tenant, the external
+// endpoint and the extra names in the spec.
+func apiServerAltNames(tenant *v1alpha1.Tenant) (certutil.AltNames, error) {
+	namespace := tenant.ClusterNamespaceInHost()
+	altNames := certutil.AltNames{
+		DNSNames: []string{
+			"kube-apiserver",
+			"kube-apiserver." + namespace,
+			"kube-apiserver." + namespace + ".svc",
+			"kube-apiserver." + namespace + ".svc.cluster.local",
+			"kubernetes",
+			"kubernetes.default",
+			"kubernetes.default.svc",
+			"kubernetes.default.svc.cluster.local",
+			"localhost",
+		},
+		IPs: []net.IP{
+			net.ParseIP("127.0.0.1"),
+		},
+	}
+
+	serviceIP, err := kubernetesServiceIP(tenantNetwork(tenant).ServiceCIDRs[0])
+	if err != nil {
+		return certutil.AltNames{}, err
+	}
+	altNames.IPs = append(altNames.IPs, serviceIP)
+
+	names := tenant.Spec.CertSANs
+	if host := externalHost(tenant); host != "" {
+		names = append([]string{host}, names...)
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			altNames.IPs = append(altNames.IPs, ip)
+		} else {
+			altNames.DNSNames = append(altNames.DNSNames, name)
+		}
+	}
+	return altNames, nil
+}
+
+// kubernetesServiceIP returns the ip of the kubernetes Service inside the tenant, the first ip
+// of the service cidr.
+func kubernetesServiceIP(serviceCIDR string) (net.IP, error) {
+	_, cidr, err := net.ParseCIDR(serviceCIDR)
+	if err != nil {
+		return nil, err
+	}
+	return utilnet.GetIndexedIP(cidr, 1)
+}
+
+// ensureKeyPair makes sure data holds a key pair under <name>.pub and <name>.key, a new key
+// pair is generated as selected by keyConfig if they are missing or invalid. An existing key pair
+// is kept whatever its algorithm, replacing it invalidates the tokens signed with it.
+func ensureKeyPair(data map[string][]byte, name string, keyConfig secret.KeyConfig) error {
+	if key, err := secret.DecodePrivateKeyPEM(data[name+".key"]); err == nil {
+		if encodedPub, err := secret.EncodePublicKeyPEM(key.Public()); err == nil && bytes.Equal(encodedPub, data[name+".pub"]) {
+			return nil
+		}
+	}
+
+	pub, key, err := secret.NewPubAndKey(keyConfig)
+	if err != nil {
+		return err
+	}
+	encodedPub, err := secret.EncodePublicKeyPEM(pub)
+	if err != nil {
+		return err
+	}
+	encodedKey, err := secret.EncodePrivateKeyPEM(key)
+	if err != nil {
+		return err
+	}
+	data[name+".pub"] = encodedPub
+	data[name+".key"] = encodedKey
+	return nil
+}
+
+// decodeCertAndKey decodes the certificate and key under <name>.crt and <name>.key,
+// and checks that they belong together.
+func decodeCertAndKey(data map[string][]byte, name string) (*x509.Certificate, crypto.Signer, error) {
+	encodedCert, ok := data[name+".crt"]
+	if !ok {
+		return nil, nil, fmt.Errorf("empty %s.crt", name)
+	}
+	cert, err := secret.DecodeCertPEM(encodedCert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encodedKey, ok := data[name+".key"]
+	if !ok {
+		return nil, nil, fmt.Errorf("empty %s.key", name)
+	}
+	key, err := secret.DecodePrivateKeyPEM(encodedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pub, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(key.Public()) {
+		return nil, nil, fmt.Errorf("%s.key does not match %s.crt", name, name)
+	}
+	return cert, key, nil
+}
+
+// isKubeConfigValid returns true if the kubeconfig points to the endpoint, trusts the given ca
+// bundle and authenticates with the given client certificate.
+func isKubeConfigValid(data []byte, endpoint string, caBundle, clientCert []byte) bool {
+	config, err := clientcmd.Load(data)
+	if err != nil || len(config.Clusters) == 0 || len(config.AuthInfos) == 0 {
+		return false
+	}
+
+	for _, cluster := range config.Clusters {
+		if cluster.Server != endpoint || !bytes.Equal(cluster.CertificateAuthorityData, caBundle) {
+			return false
+		}
+	}
+	for _, authInfo := range config.AuthInfos {
+		if !bytes.Equal(authInfo.ClientCertificateData, clientCert) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	certutil "k8s.io/client-go/util/cert"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/certmanager"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+)
+
+func TestAPIServerAltNames(t *testing.T) {
+	tests := []struct {
+		name         string
+		tenant       func(*v1alpha1.Tenant)
+		wantDNSNames []string
+		wantIPs      []string
+	}{
+		{
+			name:    "default network",
+			tenant:  func(*v1alpha1.Tenant) {},
+			wantIPs: []string{"127.0.0.1", "10.101.0.1"},
+		},
+		{
+			name: "allocated network",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Status.Network = &v1alpha1.NetworkStatus{
+					ServiceCIDRs: []string{"fd00::/108", "10.96.0.0/16"},
+					PodCIDRs:     []string{"fd01::/48", "10.244.0.0/16"},
+				}
+			},
+			wantIPs: []string{"127.0.0.1", "fd00::1"},
+		},
+		{
+			name: "external endpoint and cert sans",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.CertSANs = []string{"192.0.2.10", "*.example.com"}
+				tenant.Status.ExternalEndpoint = "https://api.example.com:443"
+			},
+			wantDNSNames: []string{"api.example.com", "*.example.com"},
+			wantIPs:      []string{"127.0.0.1", "10.101.0.1", "192.0.2.10"},
+		},
+		{
+			name: "external ip",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Status.ExternalEndpoint = "https://[fd00::10]:6443"
+			},
+			wantIPs: []string{"127.0.0.1", "10.101.0.1", "fd00::10"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+			test.tenant(tenant)
+
+			altNames, err := apiServerAltNames(tenant)
+			assert.NoError(t, err)
+			wantDNSNames := append([]string{
+				"kube-apiserver",
+				"kube-apiserver.tenant-tenant",
+				"kube-apiserver.tenant-tenant.svc",
+				"kube-apiserver.tenant-tenant.svc.cluster.local",
+				"kubernetes",
+				"kubernetes.default",
+				"kubernetes.default.svc",
+				"kubernetes.default.svc.cluster.local",
+				"localhost",
+			}, test.wantDNSNames...)
+			assert.Equal(t, wantDNSNames, altNames.DNSNames)
+			var ips []string
+			for _, ip := range altNames.IPs {
+				ips = append(ips, ip.String())
+			}
+			assert.Equal(t, test.wantIPs, ips)
+		})
+	}
+}
+
+func TestKubernetesServiceIP(t *testing.T) {
+	ip, err := kubernetesServiceIP("10.96.0.0/12")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.96.0.1", ip.String())
+
+	_, err = kubernetesServiceIP("10.96.0.0")
+	assert.Error(t, err)
+}
+
+func TestLoadCA(t *testing.T) {
+	keyConfig := secret.KeyConfig{Algorithm: secret.KeyAlgorithmECDSA}
+	caCert, caKey, err := secret.NewCA(nil, keyConfig)
+	assert.NoError(t, err)
+	_, otherCAKey, err := secret.NewCA(nil, keyConfig)
+	assert.NoError(t, err)
+	leafCert, leafKey, err := secret.NewCertAndKey(caCert, caKey, &certutil.Config{CommonName: "leaf"}, keyConfig, 0)
+	assert.NoError(t, err)
+
+	newCASecret := func(cert []byte, key crypto.Signer) *corev1.Secret {
+		encodedKey, err := secret.EncodePrivateKeyPEM(key)
+		assert.NoError(t, err)
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "pki", Name: "ca"},
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       cert,
+				corev1.TLSPrivateKeyKey: encodedKey,
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		objs    []client.Object
+		wantErr string
+	}{
+		{
+			name: "valid",
+			objs: []client.Object{newCASecret(secret.EncodeCertPEM(caCert), caKey)},
+		},
+		{
+			name:    "missing",
+			wantErr: `secrets "ca" not found`,
+		},
+		{
+			name:    "invalid certificate",
+			objs:    []client.Object{newCASecret([]byte("invalid"), caKey)},
+			wantErr: "unable to decode tls.crt of secret pki/ca",
+		},
+		{
+			name:    "not a ca",
+			objs:    []client.Object{newCASecret(secret.EncodeCertPEM(leafCert), leafKey)},
+			wantErr: "invalid ca in secret pki/ca: certificate is not a certificate authority",
+		},
+		{
+			name:    "key of another ca",
+			objs:    []client.Object{newCASecret(secret.EncodeCertPEM(caCert), otherCAKey)},
+			wantErr: "invalid ca in secret pki/ca: key does not match the certificate authority",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &TenantController{Client: newFakeClient(test.objs...)}
+			got, _, err := c.loadCA(context.Background(), &v1alpha1.CASecretReference{Namespace: "pki", Name: "ca"})
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, caCert.Raw, got.Raw)
+		})
+	}
+}
+
+func TestReconcileSecretReferencedCA(t *testing.T) {
+	keyConfig := secret.KeyConfig{Algorithm: secret.KeyAlgorithmECDSA}
+	newCASecret := func(namespace, name string) (*x509.Certificate, *corev1.Secret) {
+		caCert, caKey, err := secret.NewCA(&certutil.Config{CommonName: name}, keyConfig)
+		assert.NoError(t, err)
+		encodedKey, err := secret.EncodePrivateKeyPEM(caKey)
+		assert.NoError(t, err)
+		return caCert, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data: map[string][]byte{
+				"ca.crt":                secret.EncodeCertPEM(caCert),
+				"ca.key":                encodedKey,
+				corev1.TLSCertKey:       secret.EncodeCertPEM(caCert),
+				corev1.TLSPrivateKeyKey: encodedKey,
+			},
+		}
+	}
+	tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+	tenant.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+	tenant.Spec.Certificates.CA = &v1alpha1.CASecretReference{Namespace: "pki", Name: "ca"}
+	tenant.Spec.Certificates.FrontProxyCA = &v1alpha1.CASecretReference{Namespace: "pki", Name: "front-proxy-ca"}
+	caCert, caSecret := newCASecret("pki", "ca")
+	frontProxyCACert, frontProxyCASecret := newCASecret("pki", "front-proxy-ca")
+	_, etcdCertSecret := newCASecret(tenant.ClusterNamespaceInHost(), etcdCertSecretName)
+	c := &TenantController{Client: newFakeClient(caSecret, frontProxyCASecret, etcdCertSecret)}
+
+	assert.NoError(t, c.reconcileSecret(context.Background(), tenant))
+	assert.NoError(t, c.reconcileKubeConfig(context.Background(), tenant))
+
+	// getData returns the data of the secret name in the namespace of the tenant
+	getData := func(name string) map[string][]byte {
+		secretObj := &corev1.Secret{}
+		assert.NoError(t, c.Client.Get(context.Background(), types.NamespacedName{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      name,
+		}, secretObj))
+		return secretObj.Data
+	}
+	// assertSignedBy asserts the PEM-encoded certificate is signed by the ca
+	assertSignedBy := func(data []byte, ca *x509.Certificate) {
+		cert, err := secret.DecodeCertPEM(data)
+		if assert.NoError(t, err) {
+			assert.NoError(t, cert.CheckSignatureFrom(ca))
+		}
+	}
+
+	data := getData(caSecretName)
+	assert.Equal(t, secret.EncodeCertPEM(caCert), data["ca.crt"])
+	assert.Equal(t, secret.EncodeCertPEM(caCert), data[caBundleKey])
+	assert.NotContains(t, data, "ca.key")
+	// without the ca key the reference can not be removed
+	assert.True(t, tenant.Status.ExternalCA)
+	data = getData(frontProxyCASecretName)
+	assert.Equal(t, secret.EncodeCertPEM(frontProxyCACert), data["front-proxy-ca.crt"])
+	assert.NotContains(t, data, "front-proxy-ca.key")
+
+	data = getData(apiServerCertSecretName)
+	assertSignedBy(data["apiserver.crt"], caCert)
+	assertSignedBy(data["apiserver-kubelet-client.crt"], caCert)
+	assertSignedBy(data["front-proxy-client.crt"], frontProxyCACert)
+	config, err := clientcmd.Load(getData("kubeconfig-admin")["admin.conf"])
+	if assert.NoError(t, err) {
+		for _, authInfo := range config.AuthInfos {
+			assertSignedBy(authInfo.ClientCertificateData, caCert)
+		}
+	}
+}
+
+func TestTenantsForSecret(t *testing.T) {
+	shared := newPlacedTenant("shared", "")
+	placed := newPlacedTenant("placed", "b")
+	dedicated := newPlacedTenant("dedicated", "")
+	dedicated.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+	dedicated.Spec.Certificates.CA = &v1alpha1.CASecretReference{Namespace: "pki", Name: "ca"}
+	authn := newPlacedTenant("authn", "")
+	authn.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+	authn.Spec.Authentication.Webhook = &v1alpha1.WebhookSpec{
+		KubeConfigSecret: v1alpha1.SecretReference{Namespace: "auth", Name: "webhook"},
+	}
+	backend := newEtcdBackend("b", nil, nil)
+	backend.Spec.CredentialsSecret = v1alpha1.SecretReference{Namespace: "kube-system", Name: "etcd-b"}
+
+	c := &TenantController{
+		Client:     newIndexedFakeClient(shared, placed, dedicated, authn, backend),
+		EtcdSecret: types.NamespacedName{Namespace: "kube-system", Name: "etcd-client"},
+	}
+	tests := []struct {
+		name   string
+		secret *corev1.Secret
+		want   []string
+	}{
+		{
+			name:   "etcd of the manager",
+			secret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "etcd-client"}},
+			want:   []string{"shared"},
+		},
+		{
+			name:   "etcd backend",
+			secret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "etcd-b"}},
+			want:   []string{"placed"},
+		},
+		{
+			name:   "referenced ca",
+			secret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "pki", Name: "ca"}},
+			want:   []string{"dedicated"},
+		},
+		{
+			name:   "authentication webhook",
+			secret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "auth", Name: "webhook"}},
+			want:   []string{"authn"},
+		},
+		{
+			name: "issued by cert-manager",
+			secret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "tenant-other",
+				Name:        "apiserver-issued",
+				Annotations: map[string]string{certmanager.CertificateNameAnnotation: "apiserver"},
+			}},
+			want: []string{"other"},
+		},
+		{
+			name:   "unrelated",
+			secret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ca"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var want []reconcile.Request
+			for _, name := range test.want {
+				want = append(want, reconcile.Request{NamespacedName: types.NamespacedName{Name: name}})
+			}
+			assert.ElementsMatch(t, want, c.tenantsForSecret(test.secret))
+		})
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/args"
+)
+
+// componentSizes are the resources of the control-plane components by size preset. The memory is
+// limited so a tenant can not exhaust its host node, the cpu is not so the components are not
+// throttled while they have room.
+var componentSizes = map[v1alpha1.ControlPlaneSize]map[string]corev1.ResourceRequirements{
+	v1alpha1.ControlPlaneSizeSmall: {
+		"kube-apiserver":          resources("250m", "512Mi", "1Gi"),
+		"kube-controller-manager": resources("100m", "256Mi", "512Mi"),
+		"kube-scheduler":          resources("50m", "128Mi", "256Mi"),
+	},
+	v1alpha1.ControlPlaneSizeMedium: {
+		"kube-apiserver":          resources("500m", "1Gi", "2Gi"),
+		"kube-controller-manager": resources("200m", "512Mi", "1Gi"),
+		"kube-scheduler":          resources("100m", "256Mi", "512Mi"),
+	},
+	v1alpha1.ControlPlaneSizeLarge: {
+		"kube-apiserver":          resources("1", "2Gi", "4Gi"),
+		"kube-controller-manager": resources("500m", "1Gi", "2Gi"),
+		"kube-scheduler":          resources("200m", "512Mi", "1Gi"),
+	},
+}
+
+func resources(cpu, memory, memoryLimit string) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse(memoryLimit),
+		},
+	}
+}
+
+// componentSpec returns the configuration of the pods of the control-plane component app.
+func componentSpec(tenant *v1alpha1.Tenant, app string) v1alpha1.ComponentSpec {
+	switch app {
+	case "kube-apiserver":
+		return tenant.Spec.ControlPlane.APIServer
+	case "kube-controller-manager":
+		return tenant.Spec.ControlPlane.ControllerManager
+	case "kube-scheduler":
+		return tenant.Spec.ControlPlane.Scheduler
+	}
+	return v1alpha1.ComponentSpec{}
+}
+
+// componentResources returns the resources of the container of the control-plane component app,
+// sized by the preset of the tenant unless overridden.
+func componentResources(tenant *v1alpha1.Tenant, app string) corev1.ResourceRequirements {
+	if spec := componentSpec(tenant, app); spec.Resources != nil {
+		return *spec.Resources
+	}
+	size := tenant.Spec.ControlPlane.Size
+	if size == "" {
+		size = v1alpha1.ControlPlaneSizeSmall
+	}
+	return componentSizes[size][app]
+}
+
+// platformFlagPrefixes are the prefixes of the flag families of the control-plane components
+// owned by the controller, of which only some flags are emitted depending on the tenant, e.g. the
+// oidc flags once an issuer is configured.
+var platformFlagPrefixes = map[string][]string{
+	"kube-apiserver": {
+		"audit-",
+		"authentication-token-webhook-",
+		"authorization-",
+		"etcd-",
+		"kubelet-client-",
+		"oidc-",
+		"proxy-client-",
+		"requestheader-",
+		"service-account-",
+		"tls-",
+	},
+	"kube-controller-manager": {
+		"cluster-signing-",
+		"node-cidr-mask-size",
+	},
+}
+
+// reservedVolumes are the names of the volumes the controller mounts into the control-plane
+// components.
+var reservedVolumes = []string{"pki", "kubeconfig", "audit", "audit-log"}
+
+// platformCommand returns the command of the control-plane component app of the tenant as wired
+// by the controller, before the extra args and the feature gates are merged in.
+func platformCommand(tenant *v1alpha1.Tenant, app, etcdServers string) []string {
+	switch app {
+	case "kube-apiserver":
+		return apiServerCommand(tenant, etcdServers)
+	case "kube-controller-manager":
+		return controllerManagerCommand(tenant)
+	case "kube-scheduler":
+		return schedulerCommand()
+	}
+	return nil
+}
+
+// isPlatformFlag returns whether the flag name of the control-plane component app of the tenant
+// is owned by the controller, that is emitted by its platform command or of a family of flags the
+// controller wires.
+func isPlatformFlag(tenant *v1alpha1.Tenant, app, name string) bool {
+	for _, arg := range platformCommand(tenant, app, "") {
+		if args.Name(arg) == name {
+			return true
+		}
+	}
+	for _, prefix := range platformFlagPrefixes[app] {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// componentCommand returns the command of the control-plane component with the extra args and
+// the feature gates of the tenant merged in.
+func componentCommand(component v1alpha1.ComponentSpec, command []string) []string {
+	overrides := make(map[string]string, len(component.ExtraArgs)+1)
+	for name, value := range component.ExtraArgs {
+		overrides[name] = value
+	}
+	if len(component.FeatureGates) > 0 {
+		overrides["feature-gates"] = args.FeatureGates(component.FeatureGates)
+	}
+	return args.Merge(command, overrides)
+}
+
+// componentVolumes returns the extra volumes of the control-plane component.
+func componentVolumes(component v1alpha1.ComponentSpec) []corev1.Volume {
+	volumes := make([]corev1.Volume, 0, len(component.ExtraVolumes))
+	for _, volume := range component.ExtraVolumes {
+		volumes = append(volumes, corev1.Volume{
+			Name: volume.Name,
+			VolumeSource: corev1.VolumeSource{
+				Secret:    volume.Secret,
+				ConfigMap: volume.ConfigMap,
+			},
+		})
+	}
+	return volumes
+}
+
+// componentVolumeMounts returns the mounts of the extra volumes of the control-plane component,
+// always read-only.
+func componentVolumeMounts(component v1alpha1.ComponentSpec) []corev1.VolumeMount {
+	mounts := make([]corev1.VolumeMount, 0, len(component.ExtraVolumes))
+	for _, volume := range component.ExtraVolumes {
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      volume.Name,
+			MountPath: volume.MountPath,
+			ReadOnly:  true,
+		})
+	}
+	return mounts
+}
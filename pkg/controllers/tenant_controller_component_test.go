@@ -0,0 +1,214 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/args"
+)
+
+func TestComponentCommand(t *testing.T) {
+	command := []string{"kube-scheduler", "--kubeconfig=/etc/kubernetes/scheduler.conf", "--leader-elect=true"}
+	tests := []struct {
+		name      string
+		component v1alpha1.ComponentSpec
+		want      []string
+	}{
+		{
+			name: "unchanged",
+			want: command,
+		},
+		{
+			name: "extra args",
+			component: v1alpha1.ComponentSpec{
+				ExtraArgs: map[string]string{"leader-elect": "false", "v": "4", "profiling": "false"},
+			},
+			want: []string{
+				"kube-scheduler",
+				"--kubeconfig=/etc/kubernetes/scheduler.conf",
+				"--leader-elect=false",
+				"--profiling=false",
+				"--v=4",
+			},
+		},
+		{
+			name: "feature gates",
+			component: v1alpha1.ComponentSpec{
+				FeatureGates: map[string]bool{"B": false, "A": true},
+			},
+			want: append(command, "--feature-gates=A=true,B=false"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, componentCommand(test.component, command))
+		})
+	}
+}
+
+func TestIsPlatformFlag(t *testing.T) {
+	tests := []struct {
+		app  string
+		name string
+		want bool
+	}{
+		{app: "kube-apiserver", name: "secure-port", want: true},
+		{app: "kube-apiserver", name: "etcd-servers", want: true},
+		{app: "kube-apiserver", name: "etcd", want: false},
+		{app: "kube-apiserver", name: "max-requests-inflight", want: false},
+		{app: "kube-apiserver", name: "requestheader-allowed-names", want: true},
+		{app: "kube-apiserver", name: "enable-bootstrap-token-auth", want: true},
+		{app: "kube-apiserver", name: "allow-privileged", want: true},
+		{app: "kube-apiserver", name: "oidc-issuer-url", want: true},
+		{app: "kube-controller-manager", name: "controllers", want: true},
+		{app: "kube-controller-manager", name: "use-service-account-credentials", want: true},
+		{app: "kube-controller-manager", name: "node-cidr-mask-size-ipv4", want: true},
+		{app: "kube-controller-manager", name: "node-monitor-period", want: false},
+		{app: "kube-scheduler", name: "etcd-servers", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.app+"/"+test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+			assert.Equal(t, test.want, isPlatformFlag(tenant, test.app, test.name))
+		})
+	}
+}
+
+func TestPlatformCommandFlagsRejected(t *testing.T) {
+	tenants := map[string]func(*v1alpha1.Tenant){
+		"defaults": func(*v1alpha1.Tenant) {},
+		"wired": func(tenant *v1alpha1.Tenant) {
+			tenant.Spec.Certificates.Issuer = &v1alpha1.IssuerReference{Name: "issuer"}
+			tenant.Spec.Network.PodCIDRs = []string{"10.244.0.0/16", "fd00::/48"}
+			tenant.Spec.Network.ServiceCIDRs = []string{"10.96.0.0/12", "fd01::/108"}
+			tenant.Spec.Authentication.OIDC = &v1alpha1.OIDCSpec{
+				IssuerURL:   "https://issuer.example.com",
+				ClientID:    "tenant",
+				GroupsClaim: "groups",
+				CASecret:    &v1alpha1.SecretReference{Namespace: "default", Name: "issuer"},
+			}
+			tenant.Spec.Authentication.Webhook = &v1alpha1.WebhookSpec{
+				KubeConfigSecret: v1alpha1.SecretReference{Namespace: "default", Name: "authn"},
+			}
+			tenant.Spec.Authorization.Webhook = &v1alpha1.WebhookSpec{
+				KubeConfigSecret: v1alpha1.SecretReference{Namespace: "default", Name: "authz"},
+			}
+			tenant.Spec.Audit = &v1alpha1.AuditSpec{Log: &v1alpha1.AuditLogSpec{}}
+		},
+	}
+	components := map[string]func(*v1alpha1.Tenant) *v1alpha1.ComponentSpec{
+		"apiServer": func(tenant *v1alpha1.Tenant) *v1alpha1.ComponentSpec { return &tenant.Spec.ControlPlane.APIServer },
+		"controllerManager": func(tenant *v1alpha1.Tenant) *v1alpha1.ComponentSpec {
+			return &tenant.Spec.ControlPlane.ControllerManager
+		},
+		"scheduler": func(tenant *v1alpha1.Tenant) *v1alpha1.ComponentSpec { return &tenant.Spec.ControlPlane.Scheduler },
+	}
+	apps := map[string]string{
+		"apiServer":         "kube-apiserver",
+		"controllerManager": "kube-controller-manager",
+		"scheduler":         "kube-scheduler",
+	}
+
+	for tenantName, mutate := range tenants {
+		for componentName, component := range components {
+			tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+			mutate(tenant)
+			assert.Empty(t, validateTenant(tenant), tenantName)
+			for _, arg := range platformCommand(tenant, apps[componentName], "https://etcd:2379")[1:] {
+				name := args.Name(arg)
+				t.Run(tenantName+"/"+componentName+"/"+name, func(t *testing.T) {
+					tenant := tenant.DeepCopy()
+					component(tenant).ExtraArgs = map[string]string{name: "value"}
+					assert.Contains(t, errorFields(validateTenant(tenant)),
+						"spec.controlPlane."+componentName+".extraArgs["+name+"]: Forbidden")
+				})
+			}
+		}
+	}
+}
+
+func TestComponentResources(t *testing.T) {
+	override := resources("2", "4Gi", "8Gi")
+	tests := []struct {
+		name    string
+		tenant  func(*v1alpha1.Tenant)
+		app     string
+		wantCPU string
+	}{
+		{
+			name:    "small by default",
+			tenant:  func(*v1alpha1.Tenant) {},
+			app:     "kube-apiserver",
+			wantCPU: "250m",
+		},
+		{
+			name: "size preset",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.ControlPlane.Size = v1alpha1.ControlPlaneSizeLarge
+			},
+			app:     "kube-scheduler",
+			wantCPU: "200m",
+		},
+		{
+			name: "overridden",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.ControlPlane.Size = v1alpha1.ControlPlaneSizeLarge
+				tenant.Spec.ControlPlane.ControllerManager.Resources = &override
+			},
+			app:     "kube-controller-manager",
+			wantCPU: "2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{}
+			test.tenant(tenant)
+			got := componentResources(tenant, test.app)
+			assert.Equal(t, resource.MustParse(test.wantCPU), got.Requests[corev1.ResourceCPU])
+		})
+	}
+}
+
+func TestComponentVolumes(t *testing.T) {
+	component := v1alpha1.ComponentSpec{
+		ExtraVolumes: []v1alpha1.ComponentVolume{
+			{Name: "policy", MountPath: "/etc/policy", ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "policy"},
+			}},
+			{Name: "token", MountPath: "/etc/token", Secret: &corev1.SecretVolumeSource{SecretName: "token"}},
+		},
+	}
+
+	assert.Equal(t, []corev1.Volume{
+		{Name: "policy", VolumeSource: corev1.VolumeSource{ConfigMap: component.ExtraVolumes[0].ConfigMap}},
+		{Name: "token", VolumeSource: corev1.VolumeSource{Secret: component.ExtraVolumes[1].Secret}},
+	}, componentVolumes(component))
+	assert.Equal(t, []corev1.VolumeMount{
+		{Name: "policy", MountPath: "/etc/policy", ReadOnly: true},
+		{Name: "token", MountPath: "/etc/token", ReadOnly: true},
+	}, componentVolumeMounts(component))
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/conditions"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/etcd"
+)
+
+const (
+	// etcdPurgeTimeout bounds a single attempt to purge the tenant data from etcd.
+	etcdPurgeTimeout = 30 * time.Second
+
+	// etcdPurgeRetryInterval is the wait between the attempts to purge the tenant data, the
+	// deletion is held until the purge succeeds or the data is orphaned.
+	etcdPurgeRetryInterval = time.Minute
+)
+
+// isEtcdDataReleased returns true once the tenant data in etcd is deleted or orphaned
+// by the deletion policy, so the finalizer may be released.
+func isEtcdDataReleased(tenant *v1alpha1.Tenant) bool {
+	return conditions.IsTrue(tenant, v1alpha1.TenantConditionDataDeleted) ||
+		conditions.GetReason(tenant, v1alpha1.TenantConditionDataDeleted) == "Orphaned"
+}
+
+// reconcileEtcdData deletes the tenant data from the shared etcd according to the deletion
+// policy, the apiserver is stopped first so it can not write the data back once purged.
+func (c *TenantController) reconcileEtcdData(ctx context.Context, tenant *v1alpha1.Tenant) (reconcile.Result, error) {
+	mode := tenant.Status.EtcdMode
+	if mode == "" {
+		mode = tenant.EtcdMode()
+	}
+	if mode == v1alpha1.EtcdModeDedicated {
+		conditions.MarkTrue(tenant, v1alpha1.TenantConditionDataDeleted, "Dedicated", "Data is deleted with the dedicated etcd")
+		return reconcile.Result{}, nil
+	}
+
+	if tenant.Status.Version == "" || !conditions.Has(tenant, v1alpha1.TenantConditionProvisioned) {
+		// never provisioned, the apiserver never ran so no data was written
+		conditions.MarkTrue(tenant, v1alpha1.TenantConditionDataDeleted, "NotProvisioned", "No data was written to etcd")
+		return reconcile.Result{}, nil
+	}
+
+	prefix := etcdPrefix(tenant)
+	if tenant.EtcdDeletionPolicy() == v1alpha1.EtcdDeletionPolicyOrphan {
+		conditions.MarkFalse(tenant, v1alpha1.TenantConditionDataDeleted, "Orphaned",
+			fmt.Sprintf("Data is kept in etcd under %s", prefix))
+		return reconcile.Result{}, nil
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      "kube-apiserver",
+		},
+	}
+	if err := c.Client.Delete(ctx, deployment, client.PropagationPolicy(metav1.DeletePropagationForeground)); err == nil {
+		// the deployment is gone only after its pods are
+		conditions.MarkFalse(tenant, v1alpha1.TenantConditionDataDeleted, "StoppingAPIServer", "Waiting for kube-apiserver to stop")
+		return reconcile.Result{Requeue: true, RequeueAfter: 5 * time.Second}, nil
+	} else if !apierrors.IsNotFound(err) {
+		klog.ErrorS(err, "unable to delete deployment for apiserver", "name", tenant.Name)
+		return reconcile.Result{}, err
+	}
+
+	conditions.MarkFalse(tenant, v1alpha1.TenantConditionDataDeleted, "Purging", fmt.Sprintf("Purging data under %s", prefix))
+	// the purge is retried until it succeeds, an unreachable etcd is opted out of by orphaning
+	// the data
+	purgeFailed := func(err error) (reconcile.Result, error) {
+		conditions.MarkFalse(tenant, v1alpha1.TenantConditionDataDeleted, "PurgeFailed",
+			fmt.Sprintf("%v, set spec.etcd.deletionPolicy to Orphan to keep the data and delete the tenant", err))
+		return reconcile.Result{Requeue: true, RequeueAfter: etcdPurgeRetryInterval}, nil
+	}
+	etcdServers, etcdSecret, err := c.sharedEtcd(ctx, tenant)
+	if err != nil {
+		klog.ErrorS(err, "unable to get shared etcd", "name", tenant.Name)
+		return purgeFailed(err)
+	}
+	etcdClient, err := etcd.NewClient(etcdServers, etcdSecret)
+	if err != nil {
+		klog.ErrorS(err, "unable to create etcd client", "name", tenant.Name)
+		return purgeFailed(err)
+	}
+	defer etcdClient.Close()
+
+	purgeCtx, cancel := context.WithTimeout(ctx, etcdPurgeTimeout)
+	defer cancel()
+	// the trailing slash keeps the prefix from matching the data of other tenants
+	deleted, err := etcd.DeletePrefix(purgeCtx, etcdClient, prefix+"/")
+	if err != nil {
+		klog.ErrorS(err, "unable to purge etcd data", "name", tenant.Name, "prefix", prefix)
+		return purgeFailed(err)
+	}
+
+	klog.InfoS("purged etcd data for Tenant", "name", tenant.Name, "prefix", prefix, "deleted", deleted)
+	conditions.MarkTrue(tenant, v1alpha1.TenantConditionDataDeleted, "Purged",
+		fmt.Sprintf("Deleted %d keys under %s", deleted, prefix))
+	return reconcile.Result{}, nil
+}
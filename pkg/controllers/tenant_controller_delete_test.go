@@ -0,0 +1,121 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/conditions"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/version"
+)
+
+func TestReconcileEtcdData(t *testing.T) {
+	apiServer := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "tenant-tenant",
+			Name:      "kube-apiserver",
+		},
+	}
+	tests := []struct {
+		name   string
+		mode   v1alpha1.EtcdMode
+		policy v1alpha1.EtcdDeletionPolicy
+		objs   []client.Object
+		// unprovisioned is whether the tenant is deleted before it was provisioned
+		unprovisioned bool
+		wantReason    string
+		wantReleased  bool
+		wantResult    reconcile.Result
+		wantErr       bool
+		// wantAPIServer is whether the apiserver is kept, it is only stopped to purge the data
+		wantAPIServer bool
+	}{
+		{
+			name:         "dedicated",
+			mode:         v1alpha1.EtcdModeDedicated,
+			wantReason:   "Dedicated",
+			wantReleased: true,
+		},
+		{
+			name:          "orphan",
+			policy:        v1alpha1.EtcdDeletionPolicyOrphan,
+			objs:          []client.Object{apiServer.DeepCopy()},
+			wantReason:    "Orphaned",
+			wantReleased:  true,
+			wantAPIServer: true,
+		},
+		{
+			name:       "apiserver stopped first",
+			objs:       []client.Object{apiServer.DeepCopy()},
+			wantReason: "StoppingAPIServer",
+			wantResult: reconcile.Result{Requeue: true, RequeueAfter: 5 * time.Second},
+		},
+		{
+			name:          "never provisioned",
+			objs:          []client.Object{apiServer.DeepCopy()},
+			unprovisioned: true,
+			wantReason:    "NotProvisioned",
+			wantReleased:  true,
+			wantAPIServer: true,
+		},
+		{
+			name:       "etcd secret missing",
+			wantReason: "PurgeFailed",
+			wantResult: reconcile.Result{Requeue: true, RequeueAfter: etcdPurgeRetryInterval},
+		},
+		{
+			name:         "etcd secret missing orphaned",
+			policy:       v1alpha1.EtcdDeletionPolicyOrphan,
+			wantReason:   "Orphaned",
+			wantReleased: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+			tenant.Status.EtcdMode = test.mode
+			tenant.Spec.Etcd.DeletionPolicy = test.policy
+			if !test.unprovisioned {
+				tenant.Status.Version = version.DefaultVersion
+				conditions.MarkTrue(tenant, v1alpha1.TenantConditionProvisioned, "Success", "Success to provision")
+			}
+			c := &TenantController{
+				Client:      newFakeClient(test.objs...),
+				EtcdServers: "https://etcd:2379",
+			}
+
+			result, err := c.reconcileEtcdData(context.Background(), tenant)
+			assert.Equal(t, test.wantErr, err != nil)
+			assert.Equal(t, test.wantResult, result)
+			assert.Equal(t, test.wantReason, conditions.GetReason(tenant, v1alpha1.TenantConditionDataDeleted))
+			assert.Equal(t, test.wantReleased, isEtcdDataReleased(tenant))
+			err = c.Client.Get(context.Background(), client.ObjectKeyFromObject(apiServer), &appsv1.Deployment{})
+			assert.Equal(t, test.wantAPIServer, !apierrors.IsNotFound(err))
+		})
+	}
+}
@@ -0,0 +1,420 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/klog/v2"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/controllerutil"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/version"
+)
+
+const (
+	// etcdName is the name of the headless Service and the StatefulSet of a dedicated etcd.
+	etcdName = "etcd"
+	// etcdCertSecretName is the name of the Secret holding the ca and member certificates
+	// of a dedicated etcd.
+	etcdCertSecretName = "etcd-cert"
+)
+
+// etcdMemberSecretKeys are the keys of the etcd-cert Secret mounted into the members, the ca key
+// stays with the controller.
+var etcdMemberSecretKeys = []string{"ca.crt", "server.crt", "server.key", "peer.crt", "peer.key"}
+
+// defaultEtcdStorage is the size of the volume of every member of a dedicated etcd if not set.
+// The members keep their data on a PersistentVolumeClaim, they can not rejoin the cluster once
+// their data is lost.
+var defaultEtcdStorage = resource.MustParse("8Gi")
+
+// reconcileEtcd provisions the etcd cluster dedicated to the tenant, it does nothing
+// for tenants storing their data in the shared etcd.
+func (c *TenantController) reconcileEtcd(ctx context.Context, tenant *v1alpha1.Tenant) error {
+	if tenant.EtcdMode() != v1alpha1.EtcdModeDedicated {
+		return nil
+	}
+
+	// the size and storage of the cluster are fixed at creation, later changes are rejected
+	if tenant.Status.DedicatedEtcd == nil {
+		tenant.Status.DedicatedEtcd = &v1alpha1.DedicatedEtcdStatus{
+			Replicas: etcdReplicas(tenant),
+			Storage:  etcdStorage(tenant).DeepCopy(),
+		}
+	}
+
+	namespace := tenant.ClusterNamespaceInHost()
+	secretObj := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      etcdCertSecretName,
+		},
+	}
+	renewal := tenantCertRenewal(tenant)
+	if _, err := controllerutil.CreateOrPatch(ctx, c.Client, secretObj, func() error {
+		secretObj.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		secretObj.Type = "kcp/etcd-secret"
+		if secretObj.Data == nil {
+			secretObj.Data = make(map[string][]byte, 6)
+		}
+
+		// etcd ca
+		etcdCA, etcdCAKey, err := ensureCA(secretObj.Data, "ca", &certutil.Config{
+			CommonName: "etcd-ca",
+		}, renewal.Key)
+		if err != nil {
+			klog.ErrorS(err, "unable to new ca for etcd")
+			return err
+		}
+		// members serve clients and peers, and dial the other members as clients
+		altNames := certutil.AltNames{
+			DNSNames: []string{
+				etcdName,
+				etcdName + "." + namespace,
+				etcdName + "." + namespace + ".svc",
+				"*." + etcdName + "." + namespace + ".svc",
+				"*." + etcdName + "." + namespace + ".svc.cluster.local",
+				"localhost",
+			},
+			IPs: []net.IP{
+				net.ParseIP("127.0.0.1"),
+			},
+		}
+		// server
+		if err := ensureCert(secretObj.Data, "server", etcdCA, etcdCAKey, &certutil.Config{
+			CommonName: "etcd-server",
+			AltNames:   altNames,
+			Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}, renewal); err != nil {
+			klog.ErrorS(err, "unable to cert secret for etcd server")
+			return err
+		}
+		// peer
+		if err := ensureCert(secretObj.Data, "peer", etcdCA, etcdCAKey, &certutil.Config{
+			CommonName: "etcd-peer",
+			AltNames:   altNames,
+			Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}, renewal); err != nil {
+			klog.ErrorS(err, "unable to cert secret for etcd peer")
+			return err
+		}
+		return nil
+	}); err != nil {
+		klog.ErrorS(err, "unable to create secret for etcd-cert")
+		return err
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      etcdName,
+		},
+	}
+	if _, err := controllerutil.CreateOrPatch(ctx, c.Client, service, func() error {
+		service.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		// headless so every member gets a stable DNS name, published before it is ready
+		// so the members can find each other while bootstrapping
+		service.Spec.ClusterIP = corev1.ClusterIPNone
+		service.Spec.PublishNotReadyAddresses = true
+		service.Spec.Selector = map[string]string{
+			"app":    etcdName,
+			"tenant": tenant.Name,
+		}
+		service.Spec.Ports = []corev1.ServicePort{
+			{
+				Name:       "client",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       2379,
+				TargetPort: intstr.FromInt(2379),
+			},
+			{
+				Name:       "peer",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       2380,
+				TargetPort: intstr.FromInt(2380),
+			},
+		}
+		return nil
+	}); err != nil {
+		klog.ErrorS(err, "unable to create service for etcd")
+		return err
+	}
+
+	certificatesHash, err := secretsHash(ctx, c.Client, namespace, etcdCertSecretName)
+	if err != nil {
+		klog.ErrorS(err, "unable to hash secrets for etcd")
+		return err
+	}
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      etcdName,
+		},
+	}
+	if _, err := controllerutil.CreateOrPatch(ctx, c.Client, statefulSet, func() error {
+		statefulSet.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		desired := etcdStatefulSetSpec(tenant, certificatesHash)
+		if statefulSet.CreationTimestamp.IsZero() {
+			statefulSet.Spec = desired
+			return nil
+		}
+		// everything but the pod template is immutable or fixed at creation
+		if controllerutil.PodTemplateChanged(desired.Template, statefulSet.Spec.Template) {
+			statefulSet.Spec.Template = desired.Template
+		}
+		return nil
+	}); err != nil {
+		klog.ErrorS(err, "unable to create statefulset for etcd")
+		return err
+	}
+
+	if err := c.reconcilePodDisruptionBudget(ctx, tenant, etcdName, etcdReplicas(tenant)); err != nil {
+		klog.ErrorS(err, "unable to create pod disruption budget for etcd")
+		return err
+	}
+
+	return nil
+}
+
+// etcdStatefulSetSpec returns the desired spec of the dedicated etcd StatefulSet, the pods are
+// rolled when the certificates hash changes.
+func etcdStatefulSetSpec(tenant *v1alpha1.Tenant, certificatesHash string) appsv1.StatefulSetSpec {
+	namespace := tenant.ClusterNamespaceInHost()
+	dedicated := tenant.Spec.Etcd.Dedicated
+	if dedicated == nil {
+		dedicated = &v1alpha1.DedicatedEtcdSpec{}
+	}
+	replicas := etcdReplicas(tenant)
+	image := dedicated.Image
+	if image == "" {
+		image = version.EtcdImage(tenant.Spec.ImageRepository)
+	}
+
+	initialCluster := make([]string, 0, replicas)
+	for i := int32(0); i < replicas; i++ {
+		member := fmt.Sprintf("%s-%d", etcdName, i)
+		initialCluster = append(initialCluster, fmt.Sprintf("%s=https://%s.%s.%s.svc:2380", member, member, etcdName, namespace))
+	}
+	memberHost := "$(POD_NAME)." + etcdName + "." + namespace + ".svc"
+
+	spec := appsv1.StatefulSetSpec{
+		Replicas:            &replicas,
+		ServiceName:         etcdName,
+		PodManagementPolicy: appsv1.ParallelPodManagement,
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"app":    etcdName,
+				"tenant": tenant.Name,
+			},
+		},
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{
+					"app":    etcdName,
+					"tenant": tenant.Name,
+				},
+				Annotations: map[string]string{
+					certificatesHashAnnotation: certificatesHash,
+				},
+			},
+			Spec: corev1.PodSpec{
+				TopologySpreadConstraints: topologySpreadConstraints(tenant, etcdName),
+				Containers: []corev1.Container{
+					{
+						Name:            "etcd",
+						Image:           image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Command: []string{
+							"etcd",
+							"--name=$(POD_NAME)",
+							"--data-dir=/var/lib/etcd",
+							"--advertise-client-urls=https://" + memberHost + ":2379",
+							"--initial-advertise-peer-urls=https://" + memberHost + ":2380",
+							"--initial-cluster=" + strings.Join(initialCluster, ","),
+							"--initial-cluster-state=new",
+							"--initial-cluster-token=" + tenant.Name,
+							"--listen-client-urls=https://0.0.0.0:2379",
+							"--listen-metrics-urls=http://0.0.0.0:2381",
+							"--listen-peer-urls=https://0.0.0.0:2380",
+							"--client-cert-auth=true",
+							"--cert-file=/etc/etcd/pki/server.crt",
+							"--key-file=/etc/etcd/pki/server.key",
+							"--trusted-ca-file=/etc/etcd/pki/ca.crt",
+							"--peer-client-cert-auth=true",
+							"--peer-cert-file=/etc/etcd/pki/peer.crt",
+							"--peer-key-file=/etc/etcd/pki/peer.key",
+							"--peer-trusted-ca-file=/etc/etcd/pki/ca.crt",
+							"--snapshot-count=10000",
+						},
+						Env: []corev1.EnvVar{
+							{
+								Name: "POD_NAME",
+								ValueFrom: &corev1.EnvVarSource{
+									FieldRef: &corev1.ObjectFieldSelector{
+										FieldPath: "metadata.name",
+									},
+								},
+							},
+						},
+						Ports: []corev1.ContainerPort{
+							{
+								Name:          "client",
+								ContainerPort: 2379,
+								Protocol:      corev1.ProtocolTCP,
+							},
+							{
+								Name:          "peer",
+								ContainerPort: 2380,
+								Protocol:      corev1.ProtocolTCP,
+							},
+						},
+						VolumeMounts: []corev1.VolumeMount{
+							{
+								Name:      "data",
+								MountPath: "/var/lib/etcd",
+							},
+							{
+								Name:      etcdCertSecretName,
+								MountPath: "/etc/etcd/pki",
+								ReadOnly:  true,
+							},
+						},
+						LivenessProbe:  livenessProbe("etcd", nil),
+						ReadinessProbe: readinessProbe("etcd", nil),
+						StartupProbe:   startupProbe("etcd", nil),
+					},
+				},
+				Volumes: []corev1.Volume{
+					{
+						Name: etcdCertSecretName,
+						VolumeSource: corev1.VolumeSource{
+							Projected: &corev1.ProjectedVolumeSource{
+								Sources: []corev1.VolumeProjection{
+									secretProjection(etcdCertSecretName, etcdMemberSecretKeys...),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "data",
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				StorageClassName: dedicated.StorageClassName,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: etcdStorage(tenant),
+					},
+				},
+			},
+		},
+	}
+	return spec
+}
+
+// etcdReplicas returns the number of members of the dedicated etcd, the one recorded in the status
+// once created, 1 if not set.
+func etcdReplicas(tenant *v1alpha1.Tenant) int32 {
+	if status := tenant.Status.DedicatedEtcd; status != nil {
+		return status.Replicas
+	}
+	if tenant.Spec.Etcd.Dedicated == nil || tenant.Spec.Etcd.Dedicated.Replicas == nil {
+		return 1
+	}
+	return *tenant.Spec.Etcd.Dedicated.Replicas
+}
+
+// etcdStorage returns the size of the volume of every member of the dedicated etcd, the one
+// recorded in the status once created, 8Gi if not set.
+func etcdStorage(tenant *v1alpha1.Tenant) resource.Quantity {
+	if status := tenant.Status.DedicatedEtcd; status != nil {
+		return status.Storage
+	}
+	if tenant.Spec.Etcd.Dedicated == nil || tenant.Spec.Etcd.Dedicated.Storage == nil {
+		return defaultEtcdStorage
+	}
+	return *tenant.Spec.Etcd.Dedicated.Storage
+}
+
+// etcdServers returns the etcd servers the tenant apiserver stores its data in.
+func (c *TenantController) etcdServers(ctx context.Context, tenant *v1alpha1.Tenant) (string, error) {
+	if tenant.EtcdMode() != v1alpha1.EtcdModeDedicated {
+		servers, _, err := c.sharedEtcd(ctx, tenant)
+		return servers, err
+	}
+
+	replicas := etcdReplicas(tenant)
+	servers := make([]string, 0, replicas)
+	for i := int32(0); i < replicas; i++ {
+		servers = append(servers, fmt.Sprintf("https://%s-%d.%s.%s.svc:2379", etcdName, i, etcdName, tenant.ClusterNamespaceInHost()))
+	}
+	return strings.Join(servers, ","), nil
+}
+
+// etcdPrefix returns the key prefix the tenant apiserver stores its data with.
+func etcdPrefix(tenant *v1alpha1.Tenant) string {
+	if tenant.EtcdMode() != v1alpha1.EtcdModeDedicated {
+		return "/" + tenant.Name + "/registry"
+	}
+	return "/registry"
+}
+
+// ensureEtcdClient makes sure data holds the etcd ca under etcd-ca.crt and the client certificate
+// of the apiserver under apiserver-etcd-client.crt and apiserver-etcd-client.key.
+func (c *TenantController) ensureEtcdClient(ctx context.Context, tenant *v1alpha1.Tenant, data map[string][]byte, renewal certRenewal) error {
+	if tenant.EtcdMode() != v1alpha1.EtcdModeDedicated {
+		_, etcdSecret, err := c.sharedEtcd(ctx, tenant)
+		if err != nil {
+			klog.ErrorS(err, "unable to get secret for shared etcd")
+			return err
+		}
+		for k, v := range etcdSecret {
+			data[k] = v
+		}
+		return nil
+	}
+
+	etcdCA, etcdCAKey, err := c.parseCASecret(ctx, tenant.ClusterNamespaceInHost(), etcdCertSecretName)
+	if err != nil {
+		klog.ErrorS(err, "unable to parse ca secret for etcd")
+		return err
+	}
+	data["etcd-ca.crt"] = secret.EncodeCertPEM(etcdCA)
+	return ensureCert(data, "apiserver-etcd-client", etcdCA, etcdCAKey, &certutil.Config{
+		CommonName: "kube-apiserver-etcd-client",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, renewal)
+}
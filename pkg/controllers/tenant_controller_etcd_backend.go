@@ -0,0 +1,181 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+)
+
+// errNoEtcdBackend is returned when no EtcdBackend matches the placement of the tenant.
+var errNoEtcdBackend = errors.New("no EtcdBackend with free capacity matches the placement")
+
+// placeEtcdBackend returns the name of the EtcdBackend the tenant is placed on by its placement
+// policy, empty for the etcd of the manager as long as no EtcdBackend exists.
+func (c *TenantController) placeEtcdBackend(ctx context.Context, tenant *v1alpha1.Tenant) (string, error) {
+	// the placements are recorded in the status only after the reconcile, so they are
+	// serialized and remembered until then
+	c.etcdBackendLock.Lock()
+	defer c.etcdBackendLock.Unlock()
+
+	backends := &v1alpha1.EtcdBackendList{}
+	if err := c.Client.List(ctx, backends); err != nil {
+		return "", err
+	}
+	policy := tenant.EtcdPlacementPolicy()
+	if len(backends.Items) == 0 && policy == v1alpha1.EtcdPlacementPolicyLeastLoaded {
+		return "", nil
+	}
+
+	var selector labels.Selector
+	if policy == v1alpha1.EtcdPlacementPolicySelector {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(tenant.Spec.Etcd.Placement.Selector); err != nil {
+			return "", err
+		}
+	}
+
+	// the load of a backend is the number of tenants placed on it
+	tenants := &v1alpha1.TenantList{}
+	if err := c.Client.List(ctx, tenants); err != nil {
+		return "", err
+	}
+	placements := make(map[string]string, len(tenants.Items)+len(c.etcdBackends))
+	for _, t := range tenants.Items {
+		placements[t.Name] = t.Status.EtcdBackend
+	}
+	for name, backend := range c.etcdBackends {
+		placements[name] = backend
+	}
+	load := make(map[string]int32, len(backends.Items))
+	for name, backend := range placements {
+		if name != tenant.Name && backend != "" {
+			load[backend]++
+		}
+	}
+
+	var candidates []v1alpha1.EtcdBackend
+	for _, backend := range backends.Items {
+		switch policy {
+		case v1alpha1.EtcdPlacementPolicyReference:
+			if backend.Name != tenant.Spec.Etcd.Placement.Backend {
+				continue
+			}
+		case v1alpha1.EtcdPlacementPolicySelector:
+			if !selector.Matches(labels.Set(backend.Labels)) {
+				continue
+			}
+		}
+		if capacity := backend.Spec.Capacity; capacity != nil && load[backend.Name] >= *capacity {
+			continue
+		}
+		candidates = append(candidates, backend)
+	}
+	if len(candidates) == 0 {
+		return "", errNoEtcdBackend
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if load[candidates[i].Name] != load[candidates[j].Name] {
+			return load[candidates[i].Name] < load[candidates[j].Name]
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+
+	if c.etcdBackends == nil {
+		c.etcdBackends = map[string]string{}
+	}
+	c.etcdBackends[tenant.Name] = candidates[0].Name
+	return candidates[0].Name, nil
+}
+
+// releaseEtcdBackend forgets the EtcdBackend the deleted tenant is placed on.
+func (c *TenantController) releaseEtcdBackend(name string) {
+	c.etcdBackendLock.Lock()
+	defer c.etcdBackendLock.Unlock()
+	delete(c.etcdBackends, name)
+}
+
+// sharedEtcd returns the servers and the client secret of the etcd the tenant in Shared mode is
+// placed on, the EtcdBackend recorded in its status or the etcd of the manager.
+func (c *TenantController) sharedEtcd(ctx context.Context, tenant *v1alpha1.Tenant) (string, map[string][]byte, error) {
+	servers, secretRef := c.EtcdServers, c.EtcdSecret
+	if name := tenant.Status.EtcdBackend; name != "" {
+		backend := &v1alpha1.EtcdBackend{}
+		if err := c.Client.Get(ctx, types.NamespacedName{Name: name}, backend); err != nil {
+			return "", nil, fmt.Errorf("unable to get EtcdBackend %s: %w", name, err)
+		}
+		servers = strings.Join(backend.Spec.Endpoints, ",")
+		secretRef = types.NamespacedName{
+			Namespace: backend.Spec.CredentialsSecret.Namespace,
+			Name:      backend.Spec.CredentialsSecret.Name,
+		}
+	}
+
+	etcdSecret := &corev1.Secret{}
+	if err := c.Client.Get(ctx, secretRef, etcdSecret); err != nil {
+		return "", nil, err
+	}
+	return servers, etcdSecret.Data, nil
+}
+
+// tenantsForEtcdBackend maps an EtcdBackend to the tenants placed on it, so they pick up its
+// changed endpoints and credentials.
+func (c *TenantController) tenantsForEtcdBackend(obj client.Object) []reconcile.Request {
+	tenants := &v1alpha1.TenantList{}
+	if err := c.Client.List(context.Background(), tenants, client.MatchingFields{etcdBackendIndex: obj.GetName()}); err != nil {
+		klog.ErrorS(err, "unable to list Tenants")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, tenant := range tenants.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: tenant.Name},
+		})
+	}
+	return requests
+}
+
+// tenantEtcdBackend returns the EtcdBackend the Tenant obj is placed on in Shared mode, the empty
+// name for the etcd of the manager.
+func tenantEtcdBackend(obj client.Object) []string {
+	tenant := obj.(*v1alpha1.Tenant)
+	if tenant.EtcdMode() == v1alpha1.EtcdModeDedicated {
+		return nil
+	}
+	return []string{tenant.Status.EtcdBackend}
+}
+
+// etcdBackendSecrets returns the credentials Secret of the EtcdBackend obj, as <namespace>/<name>.
+func etcdBackendSecrets(obj client.Object) []string {
+	ref := obj.(*v1alpha1.EtcdBackend).Spec.CredentialsSecret
+	return []string{ref.Namespace + "/" + ref.Name}
+}
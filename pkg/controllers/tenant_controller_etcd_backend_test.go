@@ -0,0 +1,215 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+)
+
+func newEtcdBackend(name string, labels map[string]string, capacity *int32) *v1alpha1.EtcdBackend {
+	return &v1alpha1.EtcdBackend{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec: v1alpha1.EtcdBackendSpec{
+			Endpoints: []string{"https://" + name + ":2379"},
+			CredentialsSecret: v1alpha1.SecretReference{
+				Namespace: "kube-system",
+				Name:      name,
+			},
+			Capacity: capacity,
+		},
+	}
+}
+
+func newPlacedTenant(name, backend string) *v1alpha1.Tenant {
+	return &v1alpha1.Tenant{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     v1alpha1.TenantStatus{EtcdBackend: backend},
+	}
+}
+
+func TestPlaceEtcdBackend(t *testing.T) {
+	tests := []struct {
+		name      string
+		objs      []client.Object
+		placement *v1alpha1.EtcdPlacement
+		want      string
+		wantErr   error
+	}{
+		{
+			name: "manager etcd without backends",
+		},
+		{
+			name: "least loaded",
+			objs: []client.Object{
+				newEtcdBackend("a", nil, nil),
+				newEtcdBackend("b", nil, nil),
+				newPlacedTenant("t1", "a"),
+			},
+			want: "b",
+		},
+		{
+			name: "least loaded by name on a tie",
+			objs: []client.Object{
+				newEtcdBackend("b", nil, nil),
+				newEtcdBackend("a", nil, nil),
+			},
+			want: "a",
+		},
+		{
+			name: "backend at capacity skipped",
+			objs: []client.Object{
+				newEtcdBackend("a", nil, pointer.Int32(1)),
+				newEtcdBackend("b", nil, nil),
+				newPlacedTenant("t1", "a"),
+				newPlacedTenant("t2", "b"),
+				newPlacedTenant("t3", "b"),
+			},
+			want: "b",
+		},
+		{
+			name: "all backends at capacity",
+			objs: []client.Object{
+				newEtcdBackend("a", nil, pointer.Int32(1)),
+				newPlacedTenant("t1", "a"),
+			},
+			wantErr: errNoEtcdBackend,
+		},
+		{
+			name: "selector",
+			objs: []client.Object{
+				newEtcdBackend("a", nil, nil),
+				newEtcdBackend("b", map[string]string{"tier": "ssd"}, nil),
+				newEtcdBackend("c", map[string]string{"tier": "ssd"}, nil),
+				newPlacedTenant("t1", "b"),
+			},
+			placement: &v1alpha1.EtcdPlacement{
+				Policy:   v1alpha1.EtcdPlacementPolicySelector,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "ssd"}},
+			},
+			want: "c",
+		},
+		{
+			name: "selector without backends",
+			placement: &v1alpha1.EtcdPlacement{
+				Policy:   v1alpha1.EtcdPlacementPolicySelector,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "ssd"}},
+			},
+			wantErr: errNoEtcdBackend,
+		},
+		{
+			name: "reference",
+			objs: []client.Object{
+				newEtcdBackend("a", nil, nil),
+				newEtcdBackend("b", nil, nil),
+				newPlacedTenant("t1", "b"),
+			},
+			placement: &v1alpha1.EtcdPlacement{
+				Policy:  v1alpha1.EtcdPlacementPolicyReference,
+				Backend: "b",
+			},
+			want: "b",
+		},
+		{
+			name: "reference missing",
+			objs: []client.Object{
+				newEtcdBackend("a", nil, nil),
+			},
+			placement: &v1alpha1.EtcdPlacement{
+				Policy:  v1alpha1.EtcdPlacementPolicyReference,
+				Backend: "b",
+			},
+			wantErr: errNoEtcdBackend,
+		},
+		{
+			name: "own placement not counted",
+			objs: []client.Object{
+				newEtcdBackend("a", nil, pointer.Int32(1)),
+				newPlacedTenant("tenant", "a"),
+			},
+			want: "a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &TenantController{Client: newFakeClient(test.objs...)}
+			tenant := newPlacedTenant("tenant", "")
+			tenant.Spec.Etcd.Placement = test.placement
+
+			got, err := c.placeEtcdBackend(context.Background(), tenant)
+			assert.ErrorIs(t, err, test.wantErr)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestPlaceEtcdBackendReservation(t *testing.T) {
+	c := &TenantController{Client: newFakeClient(
+		newEtcdBackend("a", nil, pointer.Int32(5)),
+		newEtcdBackend("b", nil, pointer.Int32(5)),
+	)}
+
+	// the tenants are placed concurrently before any placement is recorded in a status
+	var wg sync.WaitGroup
+	placed := make([]string, 10)
+	for i := range placed {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tenant := newPlacedTenant(string(rune('a'+i)), "")
+			placed[i], _ = c.placeEtcdBackend(context.Background(), tenant)
+		}(i)
+	}
+	wg.Wait()
+
+	load := map[string]int{}
+	for _, backend := range placed {
+		load[backend]++
+	}
+	assert.Equal(t, map[string]int{"a": 5, "b": 5}, load)
+
+	_, err := c.placeEtcdBackend(context.Background(), newPlacedTenant("k", ""))
+	assert.ErrorIs(t, err, errNoEtcdBackend)
+
+	c.releaseEtcdBackend("a")
+	got, err := c.placeEtcdBackend(context.Background(), newPlacedTenant("k", ""))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, got)
+}
+
+func TestTenantsForEtcdBackend(t *testing.T) {
+	dedicated := newPlacedTenant("dedicated", "")
+	dedicated.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+	c := &TenantController{
+		Client: newIndexedFakeClient(newPlacedTenant("t1", "a"), newPlacedTenant("t2", "b"), newPlacedTenant("t3", ""), dedicated),
+	}
+
+	assert.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "t2"}}},
+		c.tenantsForEtcdBackend(newEtcdBackend("b", nil, nil)))
+	assert.Empty(t, c.tenantsForEtcdBackend(newEtcdBackend("c", nil, nil)))
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestDedicatedEtcdStatus(t *testing.T) {
+	storage := resource.MustParse("20Gi")
+	tests := []struct {
+		name      string
+		dedicated *v1alpha1.DedicatedEtcdSpec
+		status    *v1alpha1.DedicatedEtcdStatus
+		want      v1alpha1.DedicatedEtcdStatus
+	}{
+		{
+			name: "defaults",
+			want: v1alpha1.DedicatedEtcdStatus{Replicas: 1, Storage: defaultEtcdStorage},
+		},
+		{
+			name:      "spec",
+			dedicated: &v1alpha1.DedicatedEtcdSpec{Replicas: pointer.Int32(3), Storage: &storage},
+			want:      v1alpha1.DedicatedEtcdStatus{Replicas: 3, Storage: storage},
+		},
+		{
+			name:      "created",
+			dedicated: &v1alpha1.DedicatedEtcdSpec{Replicas: pointer.Int32(5)},
+			status:    &v1alpha1.DedicatedEtcdStatus{Replicas: 3, Storage: storage},
+			want:      v1alpha1.DedicatedEtcdStatus{Replicas: 3, Storage: storage},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+			tenant.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+			tenant.Spec.Etcd.Dedicated = test.dedicated
+			tenant.Status.DedicatedEtcd = test.status
+			c := &TenantController{Client: newFakeClient()}
+
+			assert.NoError(t, c.reconcileEtcd(context.Background(), tenant))
+			got := tenant.Status.DedicatedEtcd
+			assert.Equal(t, test.want.Replicas, got.Replicas)
+			assert.Equal(t, test.want.Storage.String(), got.Storage.String())
+		})
+	}
+}
+
+func TestEtcdStatefulSetSpec(t *testing.T) {
+	storage := resource.MustParse("20Gi")
+	tests := []struct {
+		name        string
+		dedicated   *v1alpha1.DedicatedEtcdSpec
+		status      *v1alpha1.DedicatedEtcdStatus
+		wantMembers int32
+		// wantStorage is the size of the claim of every member
+		wantStorage string
+	}{
+		{
+			name:        "defaults",
+			wantMembers: 1,
+			wantStorage: "8Gi",
+		},
+		{
+			name:        "spec",
+			dedicated:   &v1alpha1.DedicatedEtcdSpec{Replicas: pointer.Int32(3), Storage: &storage},
+			wantMembers: 3,
+			wantStorage: "20Gi",
+		},
+		{
+			name:        "status wins over the spec",
+			dedicated:   &v1alpha1.DedicatedEtcdSpec{Replicas: pointer.Int32(5), Storage: &storage},
+			status:      &v1alpha1.DedicatedEtcdStatus{Replicas: 3, Storage: defaultEtcdStorage},
+			wantMembers: 3,
+			wantStorage: "8Gi",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+			tenant.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+			tenant.Spec.Etcd.Dedicated = test.dedicated
+			tenant.Status.DedicatedEtcd = test.status
+
+			spec := etcdStatefulSetSpec(tenant, "hash")
+			assert.Equal(t, test.wantMembers, *spec.Replicas)
+			var storage string
+			for _, claim := range spec.VolumeClaimTemplates {
+				if claim.Name == "data" {
+					quantity := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+					storage = quantity.String()
+				}
+			}
+			assert.Equal(t, test.wantStorage, storage)
+		})
+	}
+}
+
+func TestEtcdStatefulSetSpecCertificates(t *testing.T) {
+	tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+	tenant.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+
+	spec := etcdStatefulSetSpec(tenant, "hash")
+	var keys []string
+	for _, volume := range spec.Template.Spec.Volumes {
+		if volume.Name != etcdCertSecretName {
+			continue
+		}
+		assert.Nil(t, volume.Secret)
+		if assert.NotNil(t, volume.Projected) {
+			for _, source := range volume.Projected.Sources {
+				assert.Equal(t, etcdCertSecretName, source.Secret.Name)
+				for _, item := range source.Secret.Items {
+					keys = append(keys, item.Key)
+				}
+			}
+		}
+	}
+	assert.Equal(t, []string{"ca.crt", "server.crt", "server.key", "peer.crt", "peer.key"}, keys)
+}
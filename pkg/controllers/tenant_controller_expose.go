@@ -0,0 +1,238 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/controllerutil"
+)
+
+// managedAnnotationsAnnotation lists the annotations of the Service and the Ingress set by the
+// controller, so the ones no longer set are removed.
+const managedAnnotationsAnnotation = "tenancy.kcp.io/managed-annotations"
+
+// ingressPassthroughAnnotations makes ingress-nginx pass the TLS connection through to the
+// apiserver, which terminates TLS itself to authenticate client certificates.
+var ingressPassthroughAnnotations = map[string]string{
+	"nginx.ingress.kubernetes.io/ssl-passthrough":  "true",
+	"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS",
+}
+
+// reconcileExpose reconciles the apiserver Service and the Ingress exposing it, and reports
+// the external endpoint of the apiserver.
+func (c *TenantController) reconcileExpose(ctx context.Context, tenant *v1alpha1.Tenant) error {
+	expose := tenant.Spec.Expose
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      "kube-apiserver",
+		},
+	}
+	if _, err := controllerutil.CreateOrPatch(ctx, c.Client, service, func() error {
+		service.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		var annotations map[string]string
+		service.Spec.Selector = map[string]string{
+			"app":    "kube-apiserver",
+			"tenant": tenant.Name,
+		}
+
+		// keep the allocated node port, it would be reallocated otherwise
+		var nodePort int32
+		if len(service.Spec.Ports) > 0 {
+			nodePort = service.Spec.Ports[0].NodePort
+		}
+		service.Spec.Type = corev1.ServiceTypeClusterIP
+		if expose != nil && (expose.Type == v1alpha1.ExposeTypeNodePort || expose.Type == v1alpha1.ExposeTypeLoadBalancer) {
+			service.Spec.Type = corev1.ServiceType(expose.Type)
+			if expose.NodePort != 0 {
+				nodePort = expose.NodePort
+			}
+			annotations = expose.Annotations
+		}
+		setManagedAnnotations(&service.ObjectMeta, annotations)
+		// fields only allowed for the types exposing the service outside the host cluster
+		if service.Spec.Type == corev1.ServiceTypeClusterIP {
+			nodePort = 0
+			service.Spec.ExternalTrafficPolicy = ""
+		}
+		if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			service.Spec.AllocateLoadBalancerNodePorts = nil
+		}
+
+		service.Spec.Ports = []corev1.ServicePort{
+			{
+				Name:       "https",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       6443,
+				TargetPort: intstr.FromInt(6443),
+				NodePort:   nodePort,
+			},
+		}
+		return nil
+	}); err != nil {
+		klog.ErrorS(err, "unable to create service for apiserver")
+		return err
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      "kube-apiserver",
+		},
+	}
+	if expose != nil && expose.Type == v1alpha1.ExposeTypeIngress {
+		if _, err := controllerutil.CreateOrPatch(ctx, c.Client, ingress, func() error {
+			ingress.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+			annotations := make(map[string]string, len(ingressPassthroughAnnotations)+len(expose.Annotations))
+			for k, v := range ingressPassthroughAnnotations {
+				annotations[k] = v
+			}
+			for k, v := range expose.Annotations {
+				annotations[k] = v
+			}
+			setManagedAnnotations(&ingress.ObjectMeta, annotations)
+
+			pathType := networkingv1.PathTypePrefix
+			ingress.Spec.IngressClassName = expose.IngressClassName
+			ingress.Spec.Rules = []networkingv1.IngressRule{
+				{
+					Host: expose.Host,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     "/",
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: service.Name,
+											Port: networkingv1.ServiceBackendPort{
+												Number: 6443,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+			return nil
+		}); err != nil {
+			klog.ErrorS(err, "unable to create ingress for apiserver")
+			return err
+		}
+	} else if _, err := controllerutil.DeleteIfExists(ctx, c.Client, ingress); err != nil {
+		klog.ErrorS(err, "unable to delete ingress for apiserver")
+		return err
+	}
+
+	tenant.Status.ExternalEndpoint = externalEndpoint(tenant, service)
+	return nil
+}
+
+// setManagedAnnotations sets annotations on the object, and removes the ones set before but no
+// longer in annotations. The annotations set by others are kept.
+func setManagedAnnotations(meta *metav1.ObjectMeta, annotations map[string]string) {
+	if managed := meta.Annotations[managedAnnotationsAnnotation]; managed != "" {
+		for _, k := range strings.Split(managed, ",") {
+			if _, ok := annotations[k]; !ok {
+				delete(meta.Annotations, k)
+			}
+		}
+	}
+	delete(meta.Annotations, managedAnnotationsAnnotation)
+	if len(annotations) == 0 {
+		return
+	}
+
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string, len(annotations)+1)
+	}
+	for k, v := range annotations {
+		meta.Annotations[k] = v
+	}
+	meta.Annotations[managedAnnotationsAnnotation] = strings.Join(sets.StringKeySet(annotations).List(), ",")
+}
+
+// apiServerEndpoint returns the URL the apiserver is reachable at inside the host cluster.
+func apiServerEndpoint(tenant *v1alpha1.Tenant) string {
+	return "https://kube-apiserver." + tenant.ClusterNamespaceInHost() + ".svc:6443"
+}
+
+// externalEndpoint returns the URL the apiserver exposed by the service is reachable at from
+// outside the host cluster, empty if not exposed or the address is not assigned yet.
+func externalEndpoint(tenant *v1alpha1.Tenant, service *corev1.Service) string {
+	expose := tenant.Spec.Expose
+	if expose == nil {
+		return ""
+	}
+
+	host := expose.Host
+	var port int32
+	switch expose.Type {
+	case v1alpha1.ExposeTypeNodePort:
+		if len(service.Spec.Ports) > 0 {
+			port = service.Spec.Ports[0].NodePort
+		}
+	case v1alpha1.ExposeTypeLoadBalancer:
+		port = 6443
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if host != "" {
+				break
+			}
+			if ingress.IP != "" {
+				host = ingress.IP
+			} else {
+				host = ingress.Hostname
+			}
+		}
+	case v1alpha1.ExposeTypeIngress:
+		port = 443
+	}
+
+	if host == "" || port == 0 {
+		return ""
+	}
+	return "https://" + net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
+
+// externalHost returns the host of the external endpoint of the apiserver, empty if not exposed.
+func externalHost(tenant *v1alpha1.Tenant) string {
+	if tenant.Status.ExternalEndpoint == "" {
+		return ""
+	}
+	u, err := url.Parse(tenant.Status.ExternalEndpoint)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestExternalEndpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		expose  *v1alpha1.ExposeSpec
+		service corev1.Service
+		want    string
+	}{
+		{
+			name: "not exposed",
+		},
+		{
+			name:   "node port",
+			expose: &v1alpha1.ExposeSpec{Type: v1alpha1.ExposeTypeNodePort, Host: "10.0.0.1"},
+			service: corev1.Service{
+				Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 6443, NodePort: 30443}}},
+			},
+			want: "https://10.0.0.1:30443",
+		},
+		{
+			name:   "node port not assigned",
+			expose: &v1alpha1.ExposeSpec{Type: v1alpha1.ExposeTypeNodePort, Host: "10.0.0.1"},
+			service: corev1.Service{
+				Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 6443}}},
+			},
+		},
+		{
+			name:   "load balancer ip",
+			expose: &v1alpha1.ExposeSpec{Type: v1alpha1.ExposeTypeLoadBalancer},
+			service: corev1.Service{
+				Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{IP: "fd00::1"}, {IP: "192.0.2.1"}},
+				}},
+			},
+			want: "https://[fd00::1]:6443",
+		},
+		{
+			name:   "load balancer hostname",
+			expose: &v1alpha1.ExposeSpec{Type: v1alpha1.ExposeTypeLoadBalancer},
+			service: corev1.Service{
+				Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{Hostname: "lb.example.com"}},
+				}},
+			},
+			want: "https://lb.example.com:6443",
+		},
+		{
+			name:   "load balancer host",
+			expose: &v1alpha1.ExposeSpec{Type: v1alpha1.ExposeTypeLoadBalancer, Host: "api.example.com"},
+			service: corev1.Service{
+				Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{IP: "192.0.2.1"}},
+				}},
+			},
+			want: "https://api.example.com:6443",
+		},
+		{
+			name:   "load balancer not assigned",
+			expose: &v1alpha1.ExposeSpec{Type: v1alpha1.ExposeTypeLoadBalancer},
+		},
+		{
+			name:   "ingress",
+			expose: &v1alpha1.ExposeSpec{Type: v1alpha1.ExposeTypeIngress, Host: "api.example.com"},
+			want:   "https://api.example.com:443",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{}
+			tenant.Spec.Expose = test.expose
+			assert.Equal(t, test.want, externalEndpoint(tenant, &test.service))
+		})
+	}
+}
+
+func TestSetManagedAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     map[string]string
+		annotations map[string]string
+		want        map[string]string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:        "set",
+			current:     map[string]string{"other": "1"},
+			annotations: map[string]string{"b": "2", "a": "1"},
+			want:        map[string]string{"other": "1", "a": "1", "b": "2", managedAnnotationsAnnotation: "a,b"},
+		},
+		{
+			name:        "removed from the spec",
+			current:     map[string]string{"other": "1", "a": "1", "b": "2", managedAnnotationsAnnotation: "a,b"},
+			annotations: map[string]string{"b": "3"},
+			want:        map[string]string{"other": "1", "b": "3", managedAnnotationsAnnotation: "b"},
+		},
+		{
+			name:    "all removed from the spec",
+			current: map[string]string{"other": "1", "a": "1", managedAnnotationsAnnotation: "a"},
+			want:    map[string]string{"other": "1"},
+		},
+		{
+			name:        "set by others before",
+			current:     map[string]string{"a": "0"},
+			annotations: map[string]string{"a": "1"},
+			want:        map[string]string{"a": "1", managedAnnotationsAnnotation: "a"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meta := &metav1.ObjectMeta{Annotations: test.current}
+			setManagedAnnotations(meta, test.annotations)
+			assert.Equal(t, test.want, meta.Annotations)
+		})
+	}
+}
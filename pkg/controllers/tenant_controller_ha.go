@@ -0,0 +1,112 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/controllerutil"
+)
+
+// controlPlaneReplicas returns the number of replicas of every control-plane component, 1 if
+// not set.
+func controlPlaneReplicas(tenant *v1alpha1.Tenant) int32 {
+	if tenant.Spec.ControlPlane.Replicas == nil {
+		return 1
+	}
+	return *tenant.Spec.ControlPlane.Replicas
+}
+
+// controlPlaneStrategy returns the rollout strategy of the control-plane components. A single
+// replica is surged so the component stays up, multiple replicas are replaced one at a time so
+// the rollout is not blocked by the spread across host nodes.
+func controlPlaneStrategy(tenant *v1alpha1.Tenant) appsv1.DeploymentStrategy {
+	maxSurge, maxUnavailable := intstr.FromInt(1), intstr.FromInt(0)
+	if controlPlaneReplicas(tenant) > 1 {
+		maxSurge, maxUnavailable = intstr.FromInt(0), intstr.FromInt(1)
+	}
+	return appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxSurge:       &maxSurge,
+			MaxUnavailable: &maxUnavailable,
+		},
+	}
+}
+
+// topologySpreadConstraints spreads the replicas of the control-plane component or the etcd app
+// across host nodes, and across zones where the nodes are labelled with one.
+func topologySpreadConstraints(tenant *v1alpha1.Tenant, app string) []corev1.TopologySpreadConstraint {
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"app":    app,
+			"tenant": tenant.Name,
+		},
+	}
+	return []corev1.TopologySpreadConstraint{
+		{
+			MaxSkew:           1,
+			TopologyKey:       corev1.LabelHostname,
+			WhenUnsatisfiable: corev1.DoNotSchedule,
+			LabelSelector:     selector,
+		},
+		{
+			MaxSkew:           1,
+			TopologyKey:       corev1.LabelTopologyZone,
+			WhenUnsatisfiable: corev1.ScheduleAnyway,
+			LabelSelector:     selector,
+		},
+	}
+}
+
+// reconcilePodDisruptionBudget keeps voluntary disruptions, e.g. node drains, from evicting more
+// than one of the replicas of the control-plane component or the etcd app at a time. A single
+// replica has no budget, it could only block the drains without keeping the app up.
+func (c *TenantController) reconcilePodDisruptionBudget(ctx context.Context, tenant *v1alpha1.Tenant, app string, replicas int32) error {
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      app,
+		},
+	}
+	if replicas < 2 {
+		_, err := controllerutil.DeleteIfExists(ctx, c.Client, pdb)
+		return err
+	}
+	_, err := controllerutil.CreateOrPatch(ctx, c.Client, pdb, func() error {
+		pdb.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		maxUnavailable := intstr.FromInt(1)
+		pdb.Spec = policyv1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app":    app,
+					"tenant": tenant.Name,
+				},
+			},
+		}
+		return nil
+	})
+	return err
+}
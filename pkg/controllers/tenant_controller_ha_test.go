@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestReconcilePodDisruptionBudget(t *testing.T) {
+	tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+	existing := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: tenant.ClusterNamespaceInHost(), Name: "kube-apiserver"},
+	}
+	tests := []struct {
+		name     string
+		replicas int32
+		objs     []client.Object
+		want     *intstr.IntOrString
+	}{
+		{
+			name:     "single replica",
+			replicas: 1,
+		},
+		{
+			name:     "scaled down to a single replica",
+			replicas: 1,
+			objs:     []client.Object{existing},
+		},
+		{
+			name:     "replicas",
+			replicas: 3,
+			want:     &intstr.IntOrString{IntVal: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &TenantController{Client: newFakeClient(test.objs...)}
+			assert.NoError(t, c.reconcilePodDisruptionBudget(context.Background(), tenant, "kube-apiserver", test.replicas))
+
+			pdb := &policyv1.PodDisruptionBudget{}
+			err := c.Client.Get(context.Background(), types.NamespacedName{
+				Namespace: tenant.ClusterNamespaceInHost(),
+				Name:      "kube-apiserver",
+			}, pdb)
+			if test.want == nil {
+				assert.True(t, apierrors.IsNotFound(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, pdb.Spec.MaxUnavailable)
+			assert.Nil(t, pdb.Spec.MinAvailable)
+		})
+	}
+}
+
+func TestEtcdStatefulSetSpread(t *testing.T) {
+	tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+	tenant.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+
+	spec := etcdStatefulSetSpec(tenant, "hash")
+	constraints := spec.Template.Spec.TopologySpreadConstraints
+	if assert.Len(t, constraints, 2) {
+		for _, constraint := range constraints {
+			assert.Equal(t, spec.Selector, constraint.LabelSelector)
+		}
+	}
+}
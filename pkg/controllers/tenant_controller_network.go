@@ -0,0 +1,166 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	utilnet "k8s.io/utils/net"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/ipam"
+)
+
+var (
+	// defaultServiceCIDRs are the service ranges of the tenant clusters without a pool.
+	defaultServiceCIDRs = []string{"10.101.0.0/16"}
+
+	// defaultPodCIDRs are the pod ranges of the tenant clusters without a pool.
+	defaultPodCIDRs = []string{"10.100.0.0/16"}
+)
+
+// tenantNetwork returns the network of the tenant, the one recorded in its status once
+// allocated.
+func tenantNetwork(tenant *v1alpha1.Tenant) v1alpha1.NetworkStatus {
+	if tenant.Status.Network != nil {
+		return *tenant.Status.Network
+	}
+	network := v1alpha1.NetworkStatus{
+		ServiceCIDRs: tenant.Spec.Network.ServiceCIDRs,
+		PodCIDRs:     tenant.Spec.Network.PodCIDRs,
+	}
+	if len(network.ServiceCIDRs) == 0 {
+		network.ServiceCIDRs = defaultServiceCIDRs
+	}
+	if len(network.PodCIDRs) == 0 {
+		network.PodCIDRs = defaultPodCIDRs
+	}
+	return network
+}
+
+// allocateNetwork returns the network of a new tenant, the ranges not set in its spec are
+// allocated from the pools so they overlap no range of another tenant.
+func (c *TenantController) allocateNetwork(ctx context.Context, tenant *v1alpha1.Tenant) (v1alpha1.NetworkStatus, error) {
+	// the allocations are recorded in the status only after the reconcile, so they are
+	// serialized and remembered until then
+	c.networkLock.Lock()
+	defer c.networkLock.Unlock()
+
+	network := tenantNetwork(tenant)
+	if (c.ServiceCIDRPool != nil && len(tenant.Spec.Network.ServiceCIDRs) == 0) ||
+		(c.PodCIDRPool != nil && len(tenant.Spec.Network.PodCIDRs) == 0) {
+		tenants := &v1alpha1.TenantList{}
+		if err := c.Client.List(ctx, tenants); err != nil {
+			return v1alpha1.NetworkStatus{}, err
+		}
+		used := make([]v1alpha1.NetworkStatus, 0, len(tenants.Items)+len(c.networks))
+		for i := range tenants.Items {
+			if tenants.Items[i].Name != tenant.Name {
+				used = append(used, tenantNetwork(&tenants.Items[i]))
+			}
+		}
+		for name, network := range c.networks {
+			if name != tenant.Name {
+				used = append(used, network)
+			}
+		}
+		usedCIDRs := append(parseCIDRs(tenant.Spec.Network.ServiceCIDRs), parseCIDRs(tenant.Spec.Network.PodCIDRs)...)
+		for _, network := range used {
+			usedCIDRs = append(usedCIDRs, parseCIDRs(network.ServiceCIDRs)...)
+			usedCIDRs = append(usedCIDRs, parseCIDRs(network.PodCIDRs)...)
+		}
+
+		if c.ServiceCIDRPool != nil && len(tenant.Spec.Network.ServiceCIDRs) == 0 {
+			cidr, err := ipam.Allocate(c.ServiceCIDRPool, c.ServiceCIDRMaskSize, usedCIDRs)
+			if err != nil {
+				return v1alpha1.NetworkStatus{}, fmt.Errorf("unable to allocate service cidr: %w", err)
+			}
+			network.ServiceCIDRs = []string{cidr.String()}
+			usedCIDRs = append(usedCIDRs, cidr)
+		}
+		if c.PodCIDRPool != nil && len(tenant.Spec.Network.PodCIDRs) == 0 {
+			cidr, err := ipam.Allocate(c.PodCIDRPool, c.PodCIDRMaskSize, usedCIDRs)
+			if err != nil {
+				return v1alpha1.NetworkStatus{}, fmt.Errorf("unable to allocate pod cidr: %w", err)
+			}
+			network.PodCIDRs = []string{cidr.String()}
+		}
+	}
+
+	// a default range may overlap the one set in the spec
+	for _, serviceCIDR := range parseCIDRs(network.ServiceCIDRs) {
+		for _, podCIDR := range parseCIDRs(network.PodCIDRs) {
+			if ipam.Overlaps(serviceCIDR, podCIDR) {
+				return v1alpha1.NetworkStatus{}, fmt.Errorf("service cidr %s overlaps pod cidr %s", serviceCIDR, podCIDR)
+			}
+		}
+	}
+
+	if c.networks == nil {
+		c.networks = map[string]v1alpha1.NetworkStatus{}
+	}
+	c.networks[tenant.Name] = network
+	return network, nil
+}
+
+// releaseNetwork forgets the network allocated to the deleted tenant.
+func (c *TenantController) releaseNetwork(name string) {
+	c.networkLock.Lock()
+	defer c.networkLock.Unlock()
+	delete(c.networks, name)
+}
+
+// parseCIDRs returns the ranges of cidrs, skipping the invalid ones.
+func parseCIDRs(cidrs []string) []*net.IPNet {
+	parsed := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+			parsed = append(parsed, ipNet)
+		}
+	}
+	return parsed
+}
+
+// nodeCIDRMaskSizes returns the prefix lengths of the ipv4 and ipv6 pod ranges of every node.
+func nodeCIDRMaskSizes(tenant *v1alpha1.Tenant) (int32, int32) {
+	ipv4, ipv6 := int32(24), int32(64)
+	if size := tenant.Spec.Network.NodeCIDRMaskSizeIPv4; size != nil {
+		ipv4 = *size
+	}
+	if size := tenant.Spec.Network.NodeCIDRMaskSizeIPv6; size != nil {
+		ipv6 = *size
+	}
+	return ipv4, ipv6
+}
+
+// nodeCIDRMaskSizeFlags returns the controller-manager flags sizing the pod range of every node,
+// the single-stack flag is not allowed for dual-stack and the other way round.
+func nodeCIDRMaskSizeFlags(tenant *v1alpha1.Tenant, podCIDRs []string) []string {
+	ipv4, ipv6 := nodeCIDRMaskSizes(tenant)
+	if len(podCIDRs) > 1 {
+		return []string{
+			fmt.Sprintf("--node-cidr-mask-size-ipv4=%d", ipv4),
+			fmt.Sprintf("--node-cidr-mask-size-ipv6=%d", ipv6),
+		}
+	}
+	if len(podCIDRs) == 1 && utilnet.IsIPv6CIDRString(podCIDRs[0]) {
+		return []string{fmt.Sprintf("--node-cidr-mask-size=%d", ipv6)}
+	}
+	return []string{fmt.Sprintf("--node-cidr-mask-size=%d", ipv4)}
+}
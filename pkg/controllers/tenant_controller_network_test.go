@@ -0,0 +1,176 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/ipam"
+)
+
+func newNetworkTenant(name string, serviceCIDRs, podCIDRs []string) *v1alpha1.Tenant {
+	return &v1alpha1.Tenant{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1alpha1.TenantStatus{
+			Network: &v1alpha1.NetworkStatus{ServiceCIDRs: serviceCIDRs, PodCIDRs: podCIDRs},
+		},
+	}
+}
+
+func newNetworkController(objs ...client.Object) *TenantController {
+	_, servicePool, _ := net.ParseCIDR("10.96.0.0/15")
+	_, podPool, _ := net.ParseCIDR("172.16.0.0/15")
+	return &TenantController{
+		Client:              newFakeClient(objs...),
+		ServiceCIDRPool:     servicePool,
+		ServiceCIDRMaskSize: 16,
+		PodCIDRPool:         podPool,
+		PodCIDRMaskSize:     16,
+	}
+}
+
+func TestAllocateNetwork(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       *TenantController
+		network v1alpha1.NetworkSpec
+		want    v1alpha1.NetworkStatus
+		wantErr string
+	}{
+		{
+			name: "defaults without pools",
+			c:    &TenantController{Client: newFakeClient()},
+			want: v1alpha1.NetworkStatus{ServiceCIDRs: defaultServiceCIDRs, PodCIDRs: defaultPodCIDRs},
+		},
+		{
+			name: "first ranges of the pools",
+			c:    newNetworkController(),
+			want: v1alpha1.NetworkStatus{ServiceCIDRs: []string{"10.96.0.0/16"}, PodCIDRs: []string{"172.16.0.0/16"}},
+		},
+		{
+			name: "ranges of other tenants skipped",
+			c: newNetworkController(
+				newNetworkTenant("other", []string{"10.96.0.0/16"}, []string{"172.16.0.0/16"}),
+			),
+			want: v1alpha1.NetworkStatus{ServiceCIDRs: []string{"10.97.0.0/16"}, PodCIDRs: []string{"172.17.0.0/16"}},
+		},
+		{
+			name: "own range recorded in the status reused",
+			c: newNetworkController(
+				newNetworkTenant("tenant", []string{"10.96.0.0/16"}, []string{"172.16.0.0/16"}),
+			),
+			want: v1alpha1.NetworkStatus{ServiceCIDRs: []string{"10.96.0.0/16"}, PodCIDRs: []string{"172.16.0.0/16"}},
+		},
+		{
+			name:    "ranges of the spec kept",
+			c:       newNetworkController(),
+			network: v1alpha1.NetworkSpec{ServiceCIDRs: []string{"172.16.0.0/16"}},
+			want:    v1alpha1.NetworkStatus{ServiceCIDRs: []string{"172.16.0.0/16"}, PodCIDRs: []string{"172.17.0.0/16"}},
+		},
+		{
+			name: "pool exhausted",
+			c: newNetworkController(
+				newNetworkTenant("a", []string{"10.96.0.0/16"}, []string{"172.16.0.0/16"}),
+				newNetworkTenant("b", []string{"10.97.0.0/16"}, []string{"172.17.0.0/16"}),
+			),
+			wantErr: "unable to allocate service cidr: " + ipam.ErrPoolExhausted.Error(),
+		},
+		{
+			name:    "spec range overlapping a default range",
+			c:       &TenantController{Client: newFakeClient()},
+			network: v1alpha1.NetworkSpec{ServiceCIDRs: []string{"10.100.0.0/24"}},
+			wantErr: "service cidr 10.100.0.0/24 overlaps pod cidr 10.100.0.0/16",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+			tenant.Spec.Network = test.network
+
+			got, err := test.c.allocateNetwork(context.Background(), tenant)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestAllocateNetworkReservation(t *testing.T) {
+	c := newNetworkController()
+
+	// the networks are allocated before any of them is recorded in a status
+	a, err := c.allocateNetwork(context.Background(), &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "a"}})
+	assert.NoError(t, err)
+	b, err := c.allocateNetwork(context.Background(), &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "b"}})
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, b)
+
+	_, err = c.allocateNetwork(context.Background(), &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "c"}})
+	assert.ErrorIs(t, err, ipam.ErrPoolExhausted)
+
+	c.releaseNetwork("a")
+	got, err := c.allocateNetwork(context.Background(), &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "c"}})
+	assert.NoError(t, err)
+	assert.Equal(t, a, got)
+}
+
+func TestNodeCIDRMaskSizeFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  v1alpha1.NetworkSpec
+		podCIDRs []string
+		want     []string
+	}{
+		{
+			name:     "ipv4",
+			podCIDRs: []string{"10.100.0.0/16"},
+			want:     []string{"--node-cidr-mask-size=24"},
+		},
+		{
+			name:     "ipv6",
+			network:  v1alpha1.NetworkSpec{NodeCIDRMaskSizeIPv6: pointer.Int32(80)},
+			podCIDRs: []string{"fd00::/48"},
+			want:     []string{"--node-cidr-mask-size=80"},
+		},
+		{
+			name:     "dual-stack",
+			network:  v1alpha1.NetworkSpec{NodeCIDRMaskSizeIPv4: pointer.Int32(26)},
+			podCIDRs: []string{"10.100.0.0/16", "fd00::/48"},
+			want:     []string{"--node-cidr-mask-size-ipv4=26", "--node-cidr-mask-size-ipv6=64"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{}
+			tenant.Spec.Network = test.network
+			assert.Equal(t, test.want, nodeCIDRMaskSizeFlags(tenant, test.podCIDRs))
+		})
+	}
+}
@@ -20,15 +20,14 @@ import (
 	"context"
 	"crypto"
 	"crypto/x509"
-	"errors"
-	"net"
+	"fmt"
+	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/tools/clientcmd"
 	certutil "k8s.io/client-go/util/cert"
 	"k8s.io/klog/v2"
@@ -38,6 +37,7 @@ import (
 	"github.com/k8s-cloud-platform/multi-tenants/pkg/controllerutil"
 	"github.com/k8s-cloud-platform/multi-tenants/pkg/kubeconfig"
 	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/version"
 )
 
 func (c *TenantController) reconcilePhase(tenant *v1alpha1.Tenant) {
@@ -61,117 +61,163 @@ func (c *TenantController) reconcilePhase(tenant *v1alpha1.Tenant) {
 		tenant.Status.SetPhase(v1alpha1.TenantPhaseReady)
 	}
 
+	if meta.IsStatusConditionTrue(tenant.Status.Conditions, v1alpha1.TenantConditionUpgrading) {
+		tenant.Status.SetPhase(v1alpha1.TenantPhaseUpgrading)
+	}
+
 	if !tenant.DeletionTimestamp.IsZero() {
 		tenant.Status.SetPhase(v1alpha1.TenantPhaseTerminating)
 	}
 }
 
+// reconcileSecret reconciles the secrets holding the pki of the tenant, split by the components
+// using them.
 func (c *TenantController) reconcileSecret(ctx context.Context, tenant *v1alpha1.Tenant) error {
-	secretObj := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: tenant.ClusterNamespaceInHost(),
-			Name:      "server-cert",
-		},
+	renewal := tenantCertRenewal(tenant)
+
+	// etcd client
+	if err := c.reconcilePKISecret(ctx, tenant, apiServerEtcdClientSecretName, apiServerEtcdClientSecretKeys, func(data map[string][]byte) error {
+		return c.ensureEtcdClient(ctx, tenant, data, renewal)
+	}); err != nil {
+		klog.ErrorS(err, "unable to cert secret for apiserver-etcd-client")
+		return err
 	}
-	if _, err := controllerutil.CreateIfNotExists(ctx, c.Client, secretObj, func() error {
-		// server ca
-		serverCA, serverCAKey, err := secret.NewCA(nil)
-		if err != nil {
+
+	// server ca, and the cas trusted during a rotation, the ca stays with the issuer if any
+	if tenant.Spec.Certificates.Issuer != nil || tenant.Spec.Certificates.CA != nil {
+		// the ca key is not kept in the tenant, it can not go back to a generated ca
+		tenant.Status.ExternalCA = true
+	}
+	var caData map[string][]byte
+	if tenant.Spec.Certificates.Issuer == nil {
+		if err := c.reconcilePKISecret(ctx, tenant, caSecretName, caSecretKeys, func(data map[string][]byte) error {
+			caData = data
+			if ref := tenant.Spec.Certificates.CA; ref != nil {
+				caCert, _, err := c.loadCA(ctx, ref)
+				if err != nil {
+					klog.ErrorS(err, "unable to load ca for server")
+					return err
+				}
+				// an external ca is rotated by updating its secret
+				useCA(data, "ca", caCert)
+				data[caBundleKey] = data["ca.crt"]
+				for _, key := range []string{"ca-new.crt", "ca-new.key", "ca-old.crt"} {
+					delete(data, key)
+				}
+				return nil
+			}
+			_, _, err := ensureServerCA(data, tenant.Status.CARotation, renewal.Key)
+			return err
+		}); err != nil {
 			klog.ErrorS(err, "unable to new ca for server")
 			return err
 		}
-		// apiserver
-		serverCert, serverKey, err := secret.NewCertAndKey(serverCA, serverCAKey, &certutil.Config{
-			CommonName: "kube-apiserver",
+	}
+
+	// front proxy ca
+	var frontCA *x509.Certificate
+	var frontCAKey crypto.Signer
+	if err := c.reconcilePKISecret(ctx, tenant, frontProxyCASecretName, frontProxyCASecretKeys, func(data map[string][]byte) error {
+		var err error
+		if ref := tenant.Spec.Certificates.FrontProxyCA; ref != nil {
+			frontCA, frontCAKey, err = c.loadCA(ctx, ref)
+			if err != nil {
+				klog.ErrorS(err, "unable to load ca for front proxy")
+				return err
+			}
+			useCA(data, "front-proxy-ca", frontCA)
+			return nil
+		}
+		frontCA, frontCAKey, err = ensureCA(data, "front-proxy-ca", &certutil.Config{
+			CommonName: "front-proxy-ca",
 			AltNames: certutil.AltNames{
-				DNSNames: []string{
-					"kube-apiserver." + tenant.Name + ".svc",
-					"localhost",
-				},
-				IPs: []net.IP{
-					net.ParseIP("127.0.0.1"),
-				},
+				DNSNames: []string{"front-proxy-ca"},
 			},
-			Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		})
+		}, renewal.Key)
+		return err
+	}); err != nil {
+		klog.ErrorS(err, "unable to new ca for front proxy")
+		return err
+	}
+
+	provider, err := c.certProvider(ctx, tenant, caData)
+	if err != nil {
+		klog.ErrorS(err, "unable to get certificate provider for server")
+		return err
+	}
+	if err := c.reconcilePKISecret(ctx, tenant, apiServerCertSecretName, apiServerCertSecretKeys, func(data map[string][]byte) error {
+		// apiserver
+		altNames, err := apiServerAltNames(tenant)
 		if err != nil {
+			klog.ErrorS(err, "unable to build alt names for kube-apiserver")
+			return err
+		}
+		if err := provider.EnsureCert(ctx, data, "apiserver", &certutil.Config{
+			CommonName: "kube-apiserver",
+			AltNames:   altNames,
+			Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}); err != nil {
 			klog.ErrorS(err, "unable to cert secret for kube-apiserver")
 			return err
 		}
 		// apiserver-kubelet-client
-		kubeletCert, kubeletKey, err := secret.NewCertAndKey(serverCA, serverCAKey, &certutil.Config{
+		if err := provider.EnsureCert(ctx, data, "apiserver-kubelet-client", &certutil.Config{
 			CommonName:   "kube-apiserver-kubelet-client",
 			Organization: []string{"system:masters"},
 			Usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-		})
-		if err != nil {
+		}); err != nil {
 			klog.ErrorS(err, "unable to cert secret for apiserver-kubelet-client")
 			return err
 		}
-
-		// front proxy ca
-		frontCA, frontCAKey, err := secret.NewCA(&certutil.Config{
-			AltNames: certutil.AltNames{
-				DNSNames: []string{"front-proxy-ca"},
-			},
-		})
-		if err != nil {
-			klog.ErrorS(err, "unable to new ca for front proxy")
-			return err
-		}
 		// front-proxy-client
-		frontCert, frontKey, err := secret.NewCertAndKey(frontCA, frontCAKey, &certutil.Config{
+		if err := ensureCert(data, "front-proxy-client", frontCA, frontCAKey, &certutil.Config{
 			CommonName: "front-proxy-client",
 			Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-		})
-		if err != nil {
+		}, renewal); err != nil {
 			klog.ErrorS(err, "unable to cert secret for front-proxy-client")
 			return err
 		}
+		return nil
+	}); err != nil {
+		klog.ErrorS(err, "unable to create secret for apiserver-cert")
+		return err
+	}
 
-		// sa.pub
-		pub, pubKey, err := secret.NewPubAndKey()
-		if err != nil {
-			klog.ErrorS(err, "unable to new pub and key for sa")
-			return err
-		}
-		encodedPub, err := secret.EncodePublicKeyPEM(pub)
-		if err != nil {
-			klog.Error(err, "unable to encode public key pem for sa")
+	// the ca of the issuer, published with the apiserver certificate
+	if tenant.Spec.Certificates.Issuer != nil {
+		if err := c.reconcilePKISecret(ctx, tenant, caSecretName, caSecretKeys, func(data map[string][]byte) error {
+			caBundle, err := c.issuerCABundle(ctx, tenant)
+			if err != nil {
+				return err
+			}
+			for key := range data {
+				delete(data, key)
+			}
+			data["ca.crt"] = caBundle
+			data[caBundleKey] = caBundle
+			return nil
+		}); err != nil {
+			klog.ErrorS(err, "unable to get ca of the issuer")
 			return err
 		}
+	}
 
-		// update addon secret num if modified
-		result := make(map[string][]byte, len(c.EtcdSecret)+12)
-		for k, v := range c.EtcdSecret {
-			result[k] = v
-		}
-		result["ca.crt"] = secret.EncodeCertPEM(serverCA)
-		result["ca.key"] = secret.EncodePrivateKeyPEM(serverCAKey)
-		result["apiserver.crt"] = secret.EncodeCertPEM(serverCert)
-		result["apiserver.key"] = secret.EncodePrivateKeyPEM(serverKey)
-		result["apiserver-kubelet-client.crt"] = secret.EncodeCertPEM(kubeletCert)
-		result["apiserver-kubelet-client.key"] = secret.EncodePrivateKeyPEM(kubeletKey)
-		result["front-proxy-ca.crt"] = secret.EncodeCertPEM(frontCA)
-		result["front-proxy-ca.key"] = secret.EncodePrivateKeyPEM(frontCAKey)
-		result["front-proxy-client.crt"] = secret.EncodeCertPEM(frontCert)
-		result["front-proxy-client.key"] = secret.EncodePrivateKeyPEM(frontKey)
-		result["sa.pub"] = encodedPub
-		result["sa.key"] = secret.EncodePrivateKeyPEM(pubKey)
-
-		secretObj.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
-			{
-				APIVersion: tenant.APIVersion,
-				Kind:       tenant.Kind,
-				Name:       tenant.Name,
-				UID:        tenant.UID,
-			},
-		}
-		secretObj.Type = "kcp/kube-secret"
-		secretObj.Data = result
-		return nil
+	// sa.pub
+	if err := c.reconcilePKISecret(ctx, tenant, serviceAccountSecretName, serviceAccountSecretKeys, func(data map[string][]byte) error {
+		return ensureKeyPair(data, "sa", secret.ServiceAccountKeyConfig(renewal.Key))
+	}); err != nil {
+		klog.ErrorS(err, "unable to new pub and key for sa")
+		return err
+	}
+
+	// the split secrets are seeded, the legacy secret is no longer mounted
+	if _, err := controllerutil.DeleteIfExists(ctx, c.Client, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      legacyServerCertSecretName,
+		},
 	}); err != nil {
-		klog.ErrorS(err, "unable to create secret for server-cert")
+		klog.ErrorS(err, "unable to delete secret for server-cert")
 		return err
 	}
 
@@ -179,112 +225,155 @@ func (c *TenantController) reconcileSecret(ctx context.Context, tenant *v1alpha1
 }
 
 func (c *TenantController) reconcileKubeConfig(ctx context.Context, tenant *v1alpha1.Tenant) error {
-	secretObj := &corev1.Secret{
+	endpoint := apiServerEndpoint(tenant)
+	adminConfig := &certutil.Config{
+		CommonName:   "kubernetes-admin",
+		Organization: []string{"system:masters"},
+		Usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if err := c.reconcileKubeConfigSecret(ctx, tenant, "kubeconfig-admin", "admin.conf", endpoint, adminConfig); err != nil {
+		klog.ErrorS(err, "unable to create kubeconfig for admin")
+		return err
+	}
+
+	// admin kubeconfig for clients outside the host cluster
+	if tenant.Status.ExternalEndpoint != "" {
+		if err := c.reconcileKubeConfigSecret(ctx, tenant, "kubeconfig-admin-external", "admin.conf", tenant.Status.ExternalEndpoint, adminConfig); err != nil {
+			klog.ErrorS(err, "unable to create external kubeconfig for admin")
+			return err
+		}
+	} else if _, err := controllerutil.DeleteIfExists(ctx, c.Client, &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: tenant.ClusterNamespaceInHost(),
-			Name:      "kubeconfig-admin",
+			Name:      "kubeconfig-admin-external",
 		},
+	}); err != nil {
+		klog.ErrorS(err, "unable to delete external kubeconfig for admin")
+		return err
 	}
-	if _, err := controllerutil.CreateIfNotExists(ctx, c.Client, secretObj, func() error {
-		caCert, caKey, err := c.parseCASecret(ctx, tenant.ClusterNamespaceInHost(), "server-cert")
-		if err != nil {
-			klog.ErrorS(err, "unable to parse ca secret")
-			return err
-		}
 
-		config, err := kubeconfig.NewWithSecret(
-			tenant.Name,
-			"https://kube-apiserver."+tenant.Name+".svc:6443",
-			caCert,
-			caKey,
-			&certutil.Config{
-				CommonName:   "kubernetes-admin",
-				Organization: []string{"system:masters"},
-				Usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-			},
-		)
-		if err != nil {
-			klog.ErrorS(err, "unable to generate secret for admin.conf")
-			return err
-		}
-		adminConfig, err := clientcmd.Write(*config)
-		if err != nil {
-			klog.ErrorS(err, "unable to decode to kubeconfig for admin.conf")
-			return err
-		}
+	if err := c.reconcileKubeConfigSecret(ctx, tenant, "kubeconfig-controller-manager", "controller-manager.conf", endpoint, &certutil.Config{
+		CommonName: "system:kube-controller-manager",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		klog.ErrorS(err, "unable to create kubeconfig for controller-manager")
+		return err
+	}
 
-		secretObj.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
-			{
-				APIVersion: tenant.APIVersion,
-				Kind:       tenant.Kind,
-				Name:       tenant.Name,
-				UID:        tenant.UID,
-			},
-		}
-		secretObj.Type = "kcp/kubeconfig"
-		secretObj.Data = map[string][]byte{
-			"admin.conf": adminConfig,
-		}
-		return nil
+	if err := c.reconcileKubeConfigSecret(ctx, tenant, "kubeconfig-scheduler", "scheduler.conf", endpoint, &certutil.Config{
+		CommonName: "system:kube-scheduler",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
 	}); err != nil {
-		klog.ErrorS(err, "unable to create kubeconfig for admin")
+		klog.ErrorS(err, "unable to create kubeconfig for scheduler")
 		return err
 	}
 
-	secretObj = &corev1.Secret{
+	return nil
+}
+
+// reconcileKubeConfigSecret reconciles the secret name holding a kubeconfig for endpoint under key,
+// trusting the ca bundle and authenticated with a client certificate signed by the tenant ca. The
+// client certificate is issued by the certificate provider of the tenant under name.
+func (c *TenantController) reconcileKubeConfigSecret(ctx context.Context, tenant *v1alpha1.Tenant, name, key, endpoint string, certConfig *certutil.Config) error {
+	secretObj := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: tenant.ClusterNamespaceInHost(),
-			Name:      "kubeconfig-controller-manager",
+			Name:      name,
 		},
 	}
-	if _, err := controllerutil.CreateIfNotExists(ctx, c.Client, secretObj, func() error {
-		caCert, caKey, err := c.parseCASecret(ctx, tenant.ClusterNamespaceInHost(), "server-cert")
-		if err != nil {
-			klog.ErrorS(err, "unable to parse ca secret")
+	if _, err := controllerutil.CreateOrPatch(ctx, c.Client, secretObj, func() error {
+		secretObj.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		secretObj.Type = "kcp/kubeconfig"
+
+		caSecret := &corev1.Secret{}
+		if err := c.Client.Get(ctx, types.NamespacedName{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      caSecretName,
+		}, caSecret); err != nil {
+			klog.ErrorS(err, "unable to get secret for ca")
 			return err
 		}
-
-		config, err := kubeconfig.NewWithSecret(
-			tenant.Name,
-			"https://kube-apiserver."+tenant.Name+".svc:6443",
-			caCert,
-			caKey,
-			&certutil.Config{
-				CommonName: "system:kube-controller-manager",
-				Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-			},
-		)
+		provider, err := c.certProvider(ctx, tenant, caSecret.Data)
 		if err != nil {
-			klog.ErrorS(err, "unable to generate secret for admin.conf")
+			klog.ErrorS(err, "unable to get certificate provider", "name", key)
 			return err
 		}
-		adminConfig, err := clientcmd.Write(*config)
-		if err != nil {
-			klog.ErrorS(err, "unable to decode to kubeconfig for admin.conf")
+		caBundle := caSecret.Data[caBundleKey]
+
+		// start from the client certificate of the kubeconfig, so it is only reissued when needed
+		certs := map[string][]byte{}
+		if config, err := clientcmd.Load(secretObj.Data[key]); err == nil {
+			for _, authInfo := range config.AuthInfos {
+				certs[name+".crt"] = authInfo.ClientCertificateData
+				certs[name+".key"] = authInfo.ClientKeyData
+			}
+		}
+		if err := provider.EnsureCert(ctx, certs, name, certConfig); err != nil {
+			klog.ErrorS(err, "unable to issue client certificate", "name", key)
 			return err
 		}
+		if isKubeConfigValid(secretObj.Data[key], endpoint, caBundle, certs[name+".crt"]) {
+			return nil
+		}
 
-		secretObj.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
-			{
-				APIVersion: tenant.APIVersion,
-				Kind:       tenant.Kind,
-				Name:       tenant.Name,
-				UID:        tenant.UID,
-			},
+		config := kubeconfig.NewWithCertificate(tenant.Name, endpoint, certConfig.CommonName, caBundle, certs[name+".crt"], certs[name+".key"])
+		kubeConfig, err := clientcmd.Write(*config)
+		if err != nil {
+			klog.ErrorS(err, "unable to decode to kubeconfig", "name", key)
+			return err
 		}
-		secretObj.Type = "kcp/kubeconfig"
+
 		secretObj.Data = map[string][]byte{
-			"controller-manager.conf": adminConfig,
+			key: kubeConfig,
 		}
 		return nil
 	}); err != nil {
-		klog.ErrorS(err, "unable to create kubeconfig for controller-manager")
 		return err
 	}
 
 	return nil
 }
 
+// apiServerCommand returns the command of the apiserver of the tenant as wired by the controller,
+// before the extra args and the feature gates of the tenant are merged in.
+func apiServerCommand(tenant *v1alpha1.Tenant, etcdServers string) []string {
+	network := tenantNetwork(tenant)
+	command := append([]string{
+		"kube-apiserver",
+		"--advertise-address=0.0.0.0",
+		"--allow-privileged=true",
+		"--client-ca-file=/etc/kubernetes/pki/ca-bundle.crt",
+		"--enable-admission-plugins=NodeRestriction",
+		"--enable-bootstrap-token-auth=true",
+		"--etcd-cafile=/etc/kubernetes/pki/etcd-ca.crt",
+		"--etcd-certfile=/etc/kubernetes/pki/apiserver-etcd-client.crt",
+		"--etcd-keyfile=/etc/kubernetes/pki/apiserver-etcd-client.key",
+		"--etcd-servers=" + etcdServers,
+		"--etcd-prefix=" + etcdPrefix(tenant),
+		"--insecure-port=0",
+		"--kubelet-client-certificate=/etc/kubernetes/pki/apiserver-kubelet-client.crt",
+		"--kubelet-client-key=/etc/kubernetes/pki/apiserver-kubelet-client.key",
+		"--kubelet-preferred-address-types=InternalIP,ExternalIP,Hostname",
+		"--proxy-client-cert-file=/etc/kubernetes/pki/front-proxy-client.crt",
+		"--proxy-client-key-file=/etc/kubernetes/pki/front-proxy-client.key",
+		"--requestheader-allowed-names=front-proxy-client",
+		"--requestheader-client-ca-file=/etc/kubernetes/pki/front-proxy-ca.crt",
+		"--requestheader-extra-headers-prefix=X-Remote-Extra-",
+		"--requestheader-group-headers=X-Remote-Group",
+		"--requestheader-username-headers=X-Remote-User",
+		"--secure-port=6443",
+		"--service-account-issuer=https://kubernetes.default.svc.cluster.local",
+		"--service-account-key-file=/etc/kubernetes/pki/sa.pub",
+		"--service-account-signing-key-file=/etc/kubernetes/pki/sa.key",
+		"--service-cluster-ip-range=" + strings.Join(network.ServiceCIDRs, ","),
+		"--tls-cert-file=/etc/kubernetes/pki/apiserver.crt",
+		"--tls-private-key-file=/etc/kubernetes/pki/apiserver.key",
+	}, authenticationFlags(tenant)...)
+	command = append(command, authorizationFlags(tenant)...)
+	command = append(command, auditFlags(tenant)...)
+	return command
+}
+
 func (c *TenantController) reconcileAPIServer(ctx context.Context, tenant *v1alpha1.Tenant) error {
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -292,17 +381,49 @@ func (c *TenantController) reconcileAPIServer(ctx context.Context, tenant *v1alp
 			Name:      "kube-apiserver",
 		},
 	}
-	if _, err := controllerutil.CreateIfNotExists(ctx, c.Client, deployment, func() error {
-		deployment.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
-			{
-				APIVersion: tenant.APIVersion,
-				Kind:       tenant.Kind,
-				Name:       tenant.Name,
-				UID:        tenant.UID,
+	certificatesHash, err := secretsHash(ctx, c.Client, tenant.ClusterNamespaceInHost(), certificatesHashSecrets["kube-apiserver"]...)
+	if err != nil {
+		klog.ErrorS(err, "unable to hash secrets for apiserver")
+		return err
+	}
+	etcdServers, err := c.etcdServers(ctx, tenant)
+	if err != nil {
+		klog.ErrorS(err, "unable to get etcd servers for apiserver")
+		return err
+	}
+	pki := append([]corev1.VolumeProjection{
+		secretProjection(caSecretName, caBundleKey),
+		secretProjection(frontProxyCASecretName, "front-proxy-ca.crt"),
+		secretProjection(serviceAccountSecretName, serviceAccountSecretKeys...),
+		secretProjection(apiServerCertSecretName, apiServerCertSecretKeys...),
+		secretProjection(apiServerEtcdClientSecretName, apiServerEtcdClientSecretKeys...),
+	}, authenticationProjections(tenant)...)
+	pki = append(pki, authorizationProjections(tenant)...)
+	component := componentSpec(tenant, "kube-apiserver")
+	volumeMounts := append([]corev1.VolumeMount{
+		{
+			Name:      "pki",
+			MountPath: "/etc/kubernetes/pki",
+			ReadOnly:  true,
+		},
+	}, auditVolumeMounts(tenant)...)
+	volumeMounts = append(volumeMounts, componentVolumeMounts(component)...)
+	volumes := append([]corev1.Volume{
+		{
+			Name: "pki",
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: pki,
+				},
 			},
-		}
-		deployment.Spec = appsv1.DeploymentSpec{
-			Replicas: pointer.Int32(1),
+		},
+	}, auditVolumes(tenant)...)
+	volumes = append(volumes, componentVolumes(component)...)
+	if _, err := controllerutil.CreateOrPatch(ctx, c.Client, deployment, func() error {
+		deployment.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		desired := appsv1.DeploymentSpec{
+			Replicas: pointer.Int32(controlPlaneReplicas(tenant)),
+			Strategy: controlPlaneStrategy(tenant),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
 					"app":    "kube-apiserver",
@@ -315,155 +436,89 @@ func (c *TenantController) reconcileAPIServer(ctx context.Context, tenant *v1alp
 						"app":    "kube-apiserver",
 						"tenant": tenant.Name,
 					},
+					Annotations: map[string]string{
+						certificatesHashAnnotation: certificatesHash,
+					},
 				},
 				Spec: corev1.PodSpec{
+					TopologySpreadConstraints: topologySpreadConstraints(tenant, "kube-apiserver"),
+					NodeSelector:              component.NodeSelector,
+					Tolerations:               component.Tolerations,
+					Affinity:                  component.Affinity,
+					PriorityClassName:         component.PriorityClassName,
 					Containers: []corev1.Container{
 						{
 							Name:            "apiserver",
-							Image:           "k8s.gcr.io/kube-apiserver:v1.23.4",
+							Image:           version.Image(tenant.Spec.ImageRepository, "kube-apiserver", componentVersion(tenant, "kube-apiserver")),
 							ImagePullPolicy: corev1.PullIfNotPresent,
-							Command: []string{
-								"kube-apiserver",
-								"--advertise-address=0.0.0.0",
-								"--allow-privileged=true",
-								"--authorization-mode=Node,RBAC",
-								"--client-ca-file=/etc/kubernetes/pki/ca.crt",
-								"--enable-admission-plugins=NodeRestriction",
-								"--enable-bootstrap-token-auth=true",
-								"--etcd-cafile=/etc/kubernetes/pki/etcd-ca.crt",
-								"--etcd-certfile=/etc/kubernetes/pki/apiserver-etcd-client.crt",
-								"--etcd-keyfile=/etc/kubernetes/pki/apiserver-etcd-client.key",
-								"--etcd-servers=" + c.EtcdServers,
-								"--etcd-prefix=/" + tenant.Name + "/registry",
-								"--insecure-port=0",
-								"--kubelet-client-certificate=/etc/kubernetes/pki/apiserver-kubelet-client.crt",
-								"--kubelet-client-key=/etc/kubernetes/pki/apiserver-kubelet-client.key",
-								"--kubelet-preferred-address-types=InternalIP,ExternalIP,Hostname",
-								"--proxy-client-cert-file=/etc/kubernetes/pki/front-proxy-client.crt",
-								"--proxy-client-key-file=/etc/kubernetes/pki/front-proxy-client.key",
-								"--requestheader-allowed-names=front-proxy-client",
-								"--requestheader-client-ca-file=/etc/kubernetes/pki/front-proxy-ca.crt",
-								"--requestheader-extra-headers-prefix=X-Remote-Extra-",
-								"--requestheader-group-headers=X-Remote-Group",
-								"--requestheader-username-headers=X-Remote-User",
-								"--secure-port=6443",
-								"--service-account-issuer=https://kubernetes.default.svc.cluster.local",
-								"--service-account-key-file=/etc/kubernetes/pki/sa.pub",
-								"--service-account-signing-key-file=/etc/kubernetes/pki/sa.key",
-								"--service-cluster-ip-range=10.101.0.0/16",
-								"--tls-cert-file=/etc/kubernetes/pki/apiserver.crt",
-								"--tls-private-key-file=/etc/kubernetes/pki/apiserver.key",
-							},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "server-cert",
-									MountPath: "/etc/kubernetes/pki",
-									ReadOnly:  true,
-								},
-							},
-							LivenessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Host:   "127.0.0.1",
-										Path:   "/livez",
-										Port:   intstr.FromInt(6443),
-										Scheme: corev1.URISchemeHTTPS,
-									},
-								},
-								InitialDelaySeconds: 10,
-								PeriodSeconds:       10,
-								TimeoutSeconds:      15,
-								SuccessThreshold:    1,
-								FailureThreshold:    8,
-							},
-							ReadinessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Host:   "127.0.0.1",
-										Path:   "/readyz",
-										Port:   intstr.FromInt(6443),
-										Scheme: corev1.URISchemeHTTPS,
-									},
-								},
-								PeriodSeconds:    1,
-								TimeoutSeconds:   15,
-								SuccessThreshold: 1,
-								FailureThreshold: 3,
-							},
-							StartupProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Host:   "127.0.0.1",
-										Path:   "/livez",
-										Port:   intstr.FromInt(6443),
-										Scheme: corev1.URISchemeHTTPS,
-									},
-								},
-								InitialDelaySeconds: 10,
-								PeriodSeconds:       10,
-								TimeoutSeconds:      15,
-								SuccessThreshold:    1,
-								FailureThreshold:    24,
-							},
-						},
-					},
-					Volumes: []corev1.Volume{
-						{
-							Name: "server-cert",
-							VolumeSource: corev1.VolumeSource{
-								Secret: &corev1.SecretVolumeSource{
-									SecretName: "server-cert",
-								},
-							},
+							Resources:       componentResources(tenant, "kube-apiserver"),
+							Env:             append(auditEnv(tenant), component.Env...),
+							Command:         componentCommand(component, apiServerCommand(tenant, etcdServers)),
+							VolumeMounts:    volumeMounts,
+							LivenessProbe:   livenessProbe("kube-apiserver", component.Probes.Liveness),
+							ReadinessProbe:  readinessProbe("kube-apiserver", component.Probes.Readiness),
+							StartupProbe:    startupProbe("kube-apiserver", component.Probes.Startup),
 						},
 					},
+					Volumes: volumes,
 				},
 			},
 		}
+		if controllerutil.DeploymentSpecChanged(desired, deployment.Spec) {
+			deployment.Spec = desired
+		}
 		return nil
 	}); err != nil {
 		klog.ErrorS(err, "unable to create deployment for apiserver")
 		return err
 	}
 
-	service := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: tenant.ClusterNamespaceInHost(),
-			Name:      "kube-apiserver",
-		},
-	}
-	if _, err := controllerutil.CreateIfNotExists(ctx, c.Client, service, func() error {
-		service.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
-			{
-				APIVersion: tenant.APIVersion,
-				Kind:       tenant.Kind,
-				Name:       tenant.Name,
-				UID:        tenant.UID,
-			},
-		}
-		service.Spec = corev1.ServiceSpec{
-			Selector: map[string]string{
-				"app":    "kube-apiserver",
-				"tenant": tenant.Name,
-			},
-			Ports: []corev1.ServicePort{
-				{
-					Name:       "https",
-					Protocol:   corev1.ProtocolTCP,
-					Port:       6443,
-					TargetPort: intstr.FromInt(6443),
-				},
-			},
-		}
-		return nil
-	}); err != nil {
-		klog.ErrorS(err, "unable to create service for apiserver")
+	if err := c.reconcilePodDisruptionBudget(ctx, tenant, "kube-apiserver", controlPlaneReplicas(tenant)); err != nil {
+		klog.ErrorS(err, "unable to create pod disruption budget for apiserver")
 		return err
 	}
 
 	return nil
 }
 
+// controllerManagerCommand returns the command of the controller-manager of the tenant as wired
+// by the controller, before the extra args and the feature gates of the tenant are merged in.
+func controllerManagerCommand(tenant *v1alpha1.Tenant) []string {
+	network := tenantNetwork(tenant)
+	signing := []string{
+		"--cluster-signing-cert-file=/etc/kubernetes/pki/ca.crt",
+		"--cluster-signing-key-file=/etc/kubernetes/pki/ca.key",
+		"--controllers=*,bootstrapsigner,tokencleaner",
+	}
+	if tenant.Spec.Certificates.Issuer != nil || tenant.Spec.Certificates.CA != nil {
+		// the ca key stays with the issuer or in the referenced Secret, so csrs can not be signed
+		// in the tenant
+		signing = []string{"--controllers=*,bootstrapsigner,tokencleaner,-csrsigning"}
+	}
+	command := append([]string{
+		"kube-controller-manager",
+		"--allocate-node-cidrs=true",
+		"--authentication-kubeconfig=/etc/kubernetes/kubeconfig/controller-manager.conf",
+		"--authorization-kubeconfig=/etc/kubernetes/kubeconfig/controller-manager.conf",
+		"--bind-address=0.0.0.0",
+		"--client-ca-file=/etc/kubernetes/pki/ca-bundle.crt",
+		"--cluster-cidr=" + strings.Join(network.PodCIDRs, ","),
+	}, signing...)
+	command = append(command,
+		"--kubeconfig=/etc/kubernetes/kubeconfig/controller-manager.conf",
+		"--leader-elect=true",
+	)
+	command = append(command, nodeCIDRMaskSizeFlags(tenant, network.PodCIDRs)...)
+	command = append(command,
+		"--requestheader-client-ca-file=/etc/kubernetes/pki/front-proxy-ca.crt",
+		"--root-ca-file=/etc/kubernetes/pki/ca-bundle.crt",
+		"--secure-port=10257",
+		"--service-account-private-key-file=/etc/kubernetes/pki/sa.key",
+		"--use-service-account-credentials=true",
+	)
+	return command
+}
+
 func (c *TenantController) reconcileControllerManager(ctx context.Context, tenant *v1alpha1.Tenant) error {
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -471,17 +526,22 @@ func (c *TenantController) reconcileControllerManager(ctx context.Context, tenan
 			Name:      "kube-controller-manager",
 		},
 	}
-	if _, err := controllerutil.CreateIfNotExists(ctx, c.Client, deployment, func() error {
-		deployment.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
-			{
-				APIVersion: tenant.APIVersion,
-				Kind:       tenant.Kind,
-				Name:       tenant.Name,
-				UID:        tenant.UID,
-			},
-		}
-		deployment.Spec = appsv1.DeploymentSpec{
-			Replicas: pointer.Int32(1),
+	certificatesHash, err := secretsHash(ctx, c.Client, tenant.ClusterNamespaceInHost(), certificatesHashSecrets["kube-controller-manager"]...)
+	if err != nil {
+		klog.ErrorS(err, "unable to hash secrets for controller-manager")
+		return err
+	}
+	caKeys := []string{caBundleKey, "ca.crt", "ca.key"}
+	if tenant.Spec.Certificates.Issuer != nil || tenant.Spec.Certificates.CA != nil {
+		// the ca key stays with the issuer or in the referenced Secret
+		caKeys = []string{caBundleKey}
+	}
+	component := componentSpec(tenant, "kube-controller-manager")
+	if _, err := controllerutil.CreateOrPatch(ctx, c.Client, deployment, func() error {
+		deployment.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		desired := appsv1.DeploymentSpec{
+			Replicas: pointer.Int32(controlPlaneReplicas(tenant)),
+			Strategy: controlPlaneStrategy(tenant),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
 					"app":    "kube-controller-manager",
@@ -494,35 +554,27 @@ func (c *TenantController) reconcileControllerManager(ctx context.Context, tenan
 						"app":    "kube-controller-manager",
 						"tenant": tenant.Name,
 					},
+					Annotations: map[string]string{
+						certificatesHashAnnotation: certificatesHash,
+					},
 				},
 				Spec: corev1.PodSpec{
+					TopologySpreadConstraints: topologySpreadConstraints(tenant, "kube-controller-manager"),
+					NodeSelector:              component.NodeSelector,
+					Tolerations:               component.Tolerations,
+					Affinity:                  component.Affinity,
+					PriorityClassName:         component.PriorityClassName,
 					Containers: []corev1.Container{
 						{
 							Name:            "controller-manager",
-							Image:           "k8s.gcr.io/kube-controller-manager:v1.23.4",
+							Image:           version.Image(tenant.Spec.ImageRepository, "kube-controller-manager", componentVersion(tenant, "kube-controller-manager")),
 							ImagePullPolicy: corev1.PullIfNotPresent,
-							Command: []string{
-								"kube-controller-manager",
-								"--allocate-node-cidrs=true",
-								"--authentication-kubeconfig=/etc/kubernetes/kubeconfig/controller-manager.conf",
-								"--authorization-kubeconfig=/etc/kubernetes/kubeconfig/controller-manager.conf",
-								"--bind-address=0.0.0.0",
-								"--client-ca-file=/etc/kubernetes/pki/ca.crt",
-								"--cluster-cidr=10.100.0.0/16",
-								"--cluster-signing-cert-file=/etc/kubernetes/pki/ca.crt",
-								"--cluster-signing-key-file=/etc/kubernetes/pki/ca.key",
-								"--controllers=*,bootstrapsigner,tokencleaner",
-								"--kubeconfig=/etc/kubernetes/kubeconfig/controller-manager.conf",
-								"--leader-elect=true",
-								"--node-cidr-mask-size=24",
-								"--requestheader-client-ca-file=/etc/kubernetes/pki/front-proxy-ca.crt",
-								"--root-ca-file=/etc/kubernetes/pki/ca.crt",
-								"--service-account-private-key-file=/etc/kubernetes/pki/sa.key",
-								"--use-service-account-credentials=true",
-							},
-							VolumeMounts: []corev1.VolumeMount{
+							Resources:       componentResources(tenant, "kube-controller-manager"),
+							Env:             component.Env,
+							Command:         componentCommand(component, controllerManagerCommand(tenant)),
+							VolumeMounts: append([]corev1.VolumeMount{
 								{
-									Name:      "server-cert",
+									Name:      "pki",
 									MountPath: "/etc/kubernetes/pki",
 									ReadOnly:  true,
 								},
@@ -531,77 +583,152 @@ func (c *TenantController) reconcileControllerManager(ctx context.Context, tenan
 									MountPath: "/etc/kubernetes/kubeconfig",
 									ReadOnly:  true,
 								},
-							},
-							LivenessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Host:   "127.0.0.1",
-										Path:   "/livez",
-										Port:   intstr.FromInt(6443),
-										Scheme: corev1.URISchemeHTTPS,
-									},
-								},
-								InitialDelaySeconds: 10,
-								PeriodSeconds:       10,
-								TimeoutSeconds:      15,
-								SuccessThreshold:    1,
-								FailureThreshold:    8,
-							},
-							ReadinessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Host:   "127.0.0.1",
-										Path:   "/readyz",
-										Port:   intstr.FromInt(6443),
-										Scheme: corev1.URISchemeHTTPS,
-									},
-								},
-								PeriodSeconds:    1,
-								TimeoutSeconds:   15,
-								SuccessThreshold: 1,
-								FailureThreshold: 3,
-							},
-							StartupProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Host:   "127.0.0.1",
-										Path:   "/livez",
-										Port:   intstr.FromInt(6443),
-										Scheme: corev1.URISchemeHTTPS,
+							}, componentVolumeMounts(component)...),
+							LivenessProbe:  livenessProbe("kube-controller-manager", component.Probes.Liveness),
+							ReadinessProbe: readinessProbe("kube-controller-manager", component.Probes.Readiness),
+							StartupProbe:   startupProbe("kube-controller-manager", component.Probes.Startup),
+						},
+					},
+					Volumes: append([]corev1.Volume{
+						{
+							Name: "pki",
+							VolumeSource: corev1.VolumeSource{
+								Projected: &corev1.ProjectedVolumeSource{
+									Sources: []corev1.VolumeProjection{
+										secretProjection(caSecretName, caKeys...),
+										secretProjection(frontProxyCASecretName, "front-proxy-ca.crt"),
+										secretProjection(serviceAccountSecretName, "sa.key"),
 									},
 								},
-								InitialDelaySeconds: 10,
-								PeriodSeconds:       10,
-								TimeoutSeconds:      15,
-								SuccessThreshold:    1,
-								FailureThreshold:    24,
 							},
 						},
-					},
-					Volumes: []corev1.Volume{
 						{
-							Name: "server-cert",
+							Name: "kubeconfig",
 							VolumeSource: corev1.VolumeSource{
 								Secret: &corev1.SecretVolumeSource{
-									SecretName: "server-cert",
+									SecretName: "kubeconfig-controller-manager",
 								},
 							},
 						},
+					}, componentVolumes(component)...),
+				},
+			},
+		}
+		if controllerutil.DeploymentSpecChanged(desired, deployment.Spec) {
+			deployment.Spec = desired
+		}
+		return nil
+	}); err != nil {
+		klog.ErrorS(err, "unable to create deployment for controller-manager")
+		return err
+	}
+
+	if err := c.reconcilePodDisruptionBudget(ctx, tenant, "kube-controller-manager", controlPlaneReplicas(tenant)); err != nil {
+		klog.ErrorS(err, "unable to create pod disruption budget for controller-manager")
+		return err
+	}
+
+	return nil
+}
+
+// schedulerCommand returns the command of the scheduler as wired by the controller, before the
+// extra args and the feature gates of the tenant are merged in.
+func schedulerCommand() []string {
+	return []string{
+		"kube-scheduler",
+		"--authentication-kubeconfig=/etc/kubernetes/kubeconfig/scheduler.conf",
+		"--authorization-kubeconfig=/etc/kubernetes/kubeconfig/scheduler.conf",
+		"--bind-address=0.0.0.0",
+		"--kubeconfig=/etc/kubernetes/kubeconfig/scheduler.conf",
+		"--leader-elect=true",
+		"--secure-port=10259",
+	}
+}
+
+func (c *TenantController) reconcileScheduler(ctx context.Context, tenant *v1alpha1.Tenant) error {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      "kube-scheduler",
+		},
+	}
+	certificatesHash, err := secretsHash(ctx, c.Client, tenant.ClusterNamespaceInHost(), certificatesHashSecrets["kube-scheduler"]...)
+	if err != nil {
+		klog.ErrorS(err, "unable to hash secrets for scheduler")
+		return err
+	}
+	component := componentSpec(tenant, "kube-scheduler")
+	if _, err := controllerutil.CreateOrPatch(ctx, c.Client, deployment, func() error {
+		deployment.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		desired := appsv1.DeploymentSpec{
+			Replicas: pointer.Int32(controlPlaneReplicas(tenant)),
+			Strategy: controlPlaneStrategy(tenant),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app":    "kube-scheduler",
+					"tenant": tenant.Name,
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app":    "kube-scheduler",
+						"tenant": tenant.Name,
+					},
+					Annotations: map[string]string{
+						certificatesHashAnnotation: certificatesHash,
+					},
+				},
+				Spec: corev1.PodSpec{
+					TopologySpreadConstraints: topologySpreadConstraints(tenant, "kube-scheduler"),
+					NodeSelector:              component.NodeSelector,
+					Tolerations:               component.Tolerations,
+					Affinity:                  component.Affinity,
+					PriorityClassName:         component.PriorityClassName,
+					Containers: []corev1.Container{
+						{
+							Name:            "scheduler",
+							Image:           version.Image(tenant.Spec.ImageRepository, "kube-scheduler", componentVersion(tenant, "kube-scheduler")),
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Resources:       componentResources(tenant, "kube-scheduler"),
+							Env:             component.Env,
+							Command:         componentCommand(component, schedulerCommand()),
+							VolumeMounts: append([]corev1.VolumeMount{
+								{
+									Name:      "kubeconfig",
+									MountPath: "/etc/kubernetes/kubeconfig",
+									ReadOnly:  true,
+								},
+							}, componentVolumeMounts(component)...),
+							LivenessProbe:  livenessProbe("kube-scheduler", component.Probes.Liveness),
+							ReadinessProbe: readinessProbe("kube-scheduler", component.Probes.Readiness),
+							StartupProbe:   startupProbe("kube-scheduler", component.Probes.Startup),
+						},
+					},
+					Volumes: append([]corev1.Volume{
 						{
 							Name: "kubeconfig",
 							VolumeSource: corev1.VolumeSource{
 								Secret: &corev1.SecretVolumeSource{
-									SecretName: "kubeconfig-controller-manager",
+									SecretName: "kubeconfig-scheduler",
 								},
 							},
 						},
-					},
+					}, componentVolumes(component)...),
 				},
 			},
 		}
+		if controllerutil.DeploymentSpecChanged(desired, deployment.Spec) {
+			deployment.Spec = desired
+		}
 		return nil
 	}); err != nil {
-		klog.ErrorS(err, "unable to create deployment for controller-manager")
+		klog.ErrorS(err, "unable to create deployment for scheduler")
+		return err
+	}
+
+	if err := c.reconcilePodDisruptionBudget(ctx, tenant, "kube-scheduler", controlPlaneReplicas(tenant)); err != nil {
+		klog.ErrorS(err, "unable to create pod disruption budget for scheduler")
 		return err
 	}
 
@@ -609,19 +736,19 @@ func (c *TenantController) reconcileControllerManager(ctx context.Context, tenan
 }
 
 func (c *TenantController) parseCASecret(ctx context.Context, namespace, name string) (*x509.Certificate, crypto.Signer, error) {
-	serverCertSecret := &corev1.Secret{}
+	caSecret := &corev1.Secret{}
 	if err := c.Client.Get(ctx, types.NamespacedName{
 		Namespace: namespace,
 		Name:      name,
-	}, serverCertSecret); err != nil {
-		klog.ErrorS(err, "unable to get secret for server-cert")
+	}, caSecret); err != nil {
+		klog.ErrorS(err, "unable to get secret", "namespace", namespace, "name", name)
 		return nil, nil, err
 	}
 
-	ca, ok := serverCertSecret.Data["ca.crt"]
+	ca, ok := caSecret.Data["ca.crt"]
 	if !ok {
-		klog.Error("ca.crt is empty in server-cert secret")
-		return nil, nil, errors.New("empty ca.crt")
+		klog.Errorf("ca.crt is empty in %s secret", name)
+		return nil, nil, fmt.Errorf("empty ca.crt in secret %s/%s", namespace, name)
 	}
 	caCert, err := secret.DecodeCertPEM(ca)
 	if err != nil {
@@ -629,10 +756,10 @@ func (c *TenantController) parseCASecret(ctx context.Context, namespace, name st
 		return nil, nil, err
 	}
 
-	key, ok := serverCertSecret.Data["ca.key"]
+	key, ok := caSecret.Data["ca.key"]
 	if !ok {
-		klog.Error("ca.key is empty in server-cert secret")
-		return nil, nil, errors.New("empty ca.key")
+		klog.Errorf("ca.key is empty in %s secret", name)
+		return nil, nil, fmt.Errorf("empty ca.key in secret %s/%s", namespace, name)
 	}
 	caKey, err := secret.DecodePrivateKeyPEM(key)
 	if err != nil {
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+)
+
+// componentEndpoint is the health endpoint of a control-plane component. The components serve
+// it on their own port, so the probes of one component can not be reused for another. The pods
+// do not run in the host network, so the endpoints are probed on the pod IP.
+type componentEndpoint struct {
+	port   int
+	scheme corev1.URIScheme
+
+	livenessPath  string
+	readinessPath string
+	startupPath   string
+}
+
+// componentEndpoints are the health endpoints of the control-plane components by app.
+var componentEndpoints = map[string]componentEndpoint{
+	"etcd": {
+		port:          2381,
+		scheme:        corev1.URISchemeHTTP,
+		livenessPath:  "/health?exclude=NOSPACE&serializable=true",
+		readinessPath: "/health?serializable=false",
+		startupPath:   "/health?serializable=false",
+	},
+	"kube-apiserver": {
+		port:          6443,
+		scheme:        corev1.URISchemeHTTPS,
+		livenessPath:  "/livez",
+		readinessPath: "/readyz",
+		startupPath:   "/livez",
+	},
+	"kube-controller-manager": {
+		port:          10257,
+		scheme:        corev1.URISchemeHTTPS,
+		livenessPath:  "/healthz",
+		readinessPath: "/healthz",
+		startupPath:   "/healthz",
+	},
+	"kube-scheduler": {
+		port:          10259,
+		scheme:        corev1.URISchemeHTTPS,
+		livenessPath:  "/healthz",
+		readinessPath: "/healthz",
+		startupPath:   "/healthz",
+	},
+}
+
+func (e componentEndpoint) handler(path string) corev1.ProbeHandler {
+	return corev1.ProbeHandler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path:   path,
+			Port:   intstr.FromInt(e.port),
+			Scheme: e.scheme,
+		},
+	}
+}
+
+// livenessProbe returns the liveness probe of the control-plane component app with the override
+// merged in.
+func livenessProbe(app string, override *v1alpha1.ProbeOverride) *corev1.Probe {
+	endpoint := componentEndpoints[app]
+	return mergeProbe(&corev1.Probe{
+		ProbeHandler:        endpoint.handler(endpoint.livenessPath),
+		InitialDelaySeconds: 10,
+		PeriodSeconds:       10,
+		TimeoutSeconds:      15,
+		SuccessThreshold:    1,
+		FailureThreshold:    8,
+	}, override)
+}
+
+// readinessProbe returns the readiness probe of the control-plane component app with the
+// override merged in.
+func readinessProbe(app string, override *v1alpha1.ProbeOverride) *corev1.Probe {
+	endpoint := componentEndpoints[app]
+	return mergeProbe(&corev1.Probe{
+		ProbeHandler:     endpoint.handler(endpoint.readinessPath),
+		PeriodSeconds:    1,
+		TimeoutSeconds:   15,
+		SuccessThreshold: 1,
+		FailureThreshold: 3,
+	}, override)
+}
+
+// startupProbe returns the startup probe of the control-plane component app with the override
+// merged in.
+func startupProbe(app string, override *v1alpha1.ProbeOverride) *corev1.Probe {
+	endpoint := componentEndpoints[app]
+	return mergeProbe(&corev1.Probe{
+		ProbeHandler:        endpoint.handler(endpoint.startupPath),
+		InitialDelaySeconds: 10,
+		PeriodSeconds:       10,
+		TimeoutSeconds:      15,
+		SuccessThreshold:    1,
+		FailureThreshold:    24,
+	}, override)
+}
+
+// mergeProbe returns the probe with the fields set in the override replacing its defaults.
+func mergeProbe(probe *corev1.Probe, override *v1alpha1.ProbeOverride) *corev1.Probe {
+	if override == nil {
+		return probe
+	}
+	if override.InitialDelaySeconds != nil {
+		probe.InitialDelaySeconds = *override.InitialDelaySeconds
+	}
+	if override.PeriodSeconds != nil {
+		probe.PeriodSeconds = *override.PeriodSeconds
+	}
+	if override.TimeoutSeconds != nil {
+		probe.TimeoutSeconds = *override.TimeoutSeconds
+	}
+	if override.SuccessThreshold != nil {
+		probe.SuccessThreshold = *override.SuccessThreshold
+	}
+	if override.FailureThreshold != nil {
+		probe.FailureThreshold = *override.FailureThreshold
+	}
+	return probe
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestMergeProbe(t *testing.T) {
+	tests := []struct {
+		name     string
+		override *v1alpha1.ProbeOverride
+		want     func(*corev1.Probe)
+	}{
+		{
+			name: "defaults",
+			want: func(*corev1.Probe) {},
+		},
+		{
+			name:     "empty override",
+			override: &v1alpha1.ProbeOverride{},
+			want:     func(*corev1.Probe) {},
+		},
+		{
+			name: "override",
+			override: &v1alpha1.ProbeOverride{
+				InitialDelaySeconds: pointer.Int32(0),
+				FailureThreshold:    pointer.Int32(30),
+			},
+			want: func(probe *corev1.Probe) {
+				probe.InitialDelaySeconds = 0
+				probe.FailureThreshold = 30
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := livenessProbe("kube-apiserver", nil)
+			test.want(want)
+			got := livenessProbe("kube-apiserver", test.override)
+			assert.Equal(t, want, got)
+			assert.Equal(t, "/livez", got.HTTPGet.Path)
+		})
+	}
+}
+
+func TestComponentProbes(t *testing.T) {
+	tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+	tenant.Spec.ControlPlane.Scheduler.Probes.Readiness = &v1alpha1.ProbeOverride{PeriodSeconds: pointer.Int32(5)}
+	c := &TenantController{Client: newFakeClient()}
+	ctx := context.Background()
+	assert.NoError(t, c.reconcileControllerManager(ctx, tenant))
+	assert.NoError(t, c.reconcileScheduler(ctx, tenant))
+
+	tests := []struct {
+		app        string
+		wantPort   int
+		wantPeriod int32
+	}{
+		{app: "kube-controller-manager", wantPort: 10257, wantPeriod: 1},
+		{app: "kube-scheduler", wantPort: 10259, wantPeriod: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.app, func(t *testing.T) {
+			deployment := &appsv1.Deployment{}
+			assert.NoError(t, c.Client.Get(ctx, types.NamespacedName{Namespace: tenant.ClusterNamespaceInHost(), Name: test.app}, deployment))
+			container := deployment.Spec.Template.Spec.Containers[0]
+			if assert.NotNil(t, container.ReadinessProbe) {
+				assert.Equal(t, "/healthz", container.ReadinessProbe.HTTPGet.Path)
+				assert.Equal(t, test.wantPort, container.ReadinessProbe.HTTPGet.Port.IntValue())
+				assert.Equal(t, test.wantPeriod, container.ReadinessProbe.PeriodSeconds)
+			}
+			assert.Equal(t, livenessProbe(test.app, nil), container.LivenessProbe)
+		})
+	}
+}
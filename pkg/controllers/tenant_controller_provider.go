@@ -0,0 +1,169 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	certutil "k8s.io/client-go/util/cert"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/certmanager"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/controllerutil"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+)
+
+// errCertificatePending is returned while a certificate is not issued yet.
+var errCertificatePending = errors.New("certificate is pending")
+
+// certProvider issues the leaf certificates signed by the tenant ca.
+type certProvider interface {
+	// EnsureCert makes sure data holds a certificate and key for the config under <name>.crt and
+	// <name>.key, it returns errCertificatePending while the certificate is being issued.
+	EnsureCert(ctx context.Context, data map[string][]byte, name string, config *certutil.Config) error
+}
+
+// certProvider returns the provider of the certificates signed by the tenant ca. When the
+// certificates are issued in-process the ca is loaded from the referenced Secret, or taken from
+// the data of the ca secret.
+func (c *TenantController) certProvider(ctx context.Context, tenant *v1alpha1.Tenant, serverCertData map[string][]byte) (certProvider, error) {
+	renewal := tenantCertRenewal(tenant)
+	if issuer := tenant.Spec.Certificates.Issuer; issuer != nil {
+		return &certManagerCertProvider{
+			client: c.Client,
+			tenant: tenant,
+			issuer: certmanager.IssuerRef{
+				Name:  issuer.Name,
+				Kind:  issuer.Kind,
+				Group: issuer.Group,
+			},
+			renewal: renewal,
+		}, nil
+	}
+
+	var caCert *x509.Certificate
+	var caKey crypto.Signer
+	var err error
+	if ref := tenant.Spec.Certificates.CA; ref != nil {
+		caCert, caKey, err = c.loadCA(ctx, ref)
+	} else {
+		caCert, caKey, err = decodeCertAndKey(serverCertData, "ca")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &secretCertProvider{
+		caCert:  caCert,
+		caKey:   caKey,
+		renewal: renewal,
+	}, nil
+}
+
+// secretCertProvider issues the certificates in-process, signed by the ca.
+type secretCertProvider struct {
+	caCert  *x509.Certificate
+	caKey   crypto.Signer
+	renewal certRenewal
+}
+
+func (p *secretCertProvider) EnsureCert(_ context.Context, data map[string][]byte, name string, config *certutil.Config) error {
+	return ensureCert(data, name, p.caCert, p.caKey, config, p.renewal)
+}
+
+// certManagerCertProvider requests the certificates from a cert-manager issuer, the certificate
+// <name> is a Certificate named <name> issued into the Secret <name>-tls in the namespace of the
+// tenant. cert-manager renews the certificates, the renewed ones are picked up by the next reconcile.
+type certManagerCertProvider struct {
+	client  client.Client
+	tenant  *v1alpha1.Tenant
+	issuer  certmanager.IssuerRef
+	renewal certRenewal
+}
+
+func (p *certManagerCertProvider) EnsureCert(ctx context.Context, data map[string][]byte, name string, config *certutil.Config) error {
+	namespace := p.tenant.ClusterNamespaceInHost()
+	certificate := certmanager.NewCertificate(namespace, name)
+	if _, err := controllerutil.CreateOrPatch(ctx, p.client, certificate, func() error {
+		certificate.SetOwnerReferences(ownerReferences(p.tenant))
+		return certmanager.SetSpec(certificate, certmanager.CertificateSpec{
+			SecretName:  issuedSecretName(name),
+			Issuer:      p.issuer,
+			Config:      config,
+			Key:         p.renewal.Key,
+			Duration:    p.renewal.Validity,
+			RenewBefore: p.renewal.RenewBefore,
+		})
+	}); err != nil {
+		return fmt.Errorf("unable to create certificate %s: %v", name, err)
+	}
+	if !certmanager.IsReady(certificate) {
+		return errCertificatePending
+	}
+
+	issued := &corev1.Secret{}
+	if err := p.client.Get(ctx, types.NamespacedName{
+		Namespace: namespace,
+		Name:      issuedSecretName(name),
+	}, issued); err != nil {
+		if apierrors.IsNotFound(err) {
+			return errCertificatePending
+		}
+		return err
+	}
+	cert, err := secret.DecodeCertPEM(issued.Data[corev1.TLSCertKey])
+	if err != nil {
+		return fmt.Errorf("unable to decode certificate %s: %v", name, err)
+	}
+	// the secret lags behind while a changed certificate is reissued
+	if cert.Subject.CommonName != config.CommonName || !secret.HasAltNames(cert, config.AltNames) {
+		return errCertificatePending
+	}
+
+	data[name+".crt"] = issued.Data[corev1.TLSCertKey]
+	data[name+".key"] = issued.Data[corev1.TLSPrivateKeyKey]
+	return nil
+}
+
+// issuedSecretName returns the name of the Secret cert-manager issues the certificate name into.
+func issuedSecretName(name string) string {
+	return name + "-tls"
+}
+
+// issuerCABundle returns the ca of the issuer, as published by cert-manager with the apiserver
+// certificate, all certificates of the tenant are issued by the same issuer.
+func (c *TenantController) issuerCABundle(ctx context.Context, tenant *v1alpha1.Tenant) ([]byte, error) {
+	issued := &corev1.Secret{}
+	if err := c.Client.Get(ctx, types.NamespacedName{
+		Namespace: tenant.ClusterNamespaceInHost(),
+		Name:      issuedSecretName("apiserver"),
+	}, issued); err != nil {
+		return nil, err
+	}
+	caBundle := issued.Data["ca.crt"]
+	if _, err := secret.DecodeCertsPEM(caBundle); err != nil {
+		return nil, fmt.Errorf("issuer does not publish its ca in ca.crt: %v", err)
+	}
+	return caBundle, nil
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/conditions"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+)
+
+const (
+	// certificatesHashAnnotation is set on the pod templates of the control plane to the hash of
+	// the secrets they mount, so the pods are rolled once a certificate is renewed.
+	certificatesHashAnnotation = "tenancy.kcp.io/certificates-hash"
+
+	defaultCertRenewBefore = 30 * 24 * time.Hour
+)
+
+// certificatesHashSecrets are the secrets hashed into the pod templates of the control plane, by
+// component.
+var certificatesHashSecrets = map[string][]string{
+	"kube-apiserver": {caSecretName, frontProxyCASecretName, serviceAccountSecretName, apiServerCertSecretName,
+		apiServerEtcdClientSecretName, oidcCASecretName, authnWebhookSecretName, authzWebhookSecretName, auditSecretName},
+	"kube-controller-manager": {caSecretName, frontProxyCASecretName, serviceAccountSecretName, "kubeconfig-controller-manager"},
+	"kube-scheduler":          {"kubeconfig-scheduler"},
+}
+
+// certRenewal is how the leaf certificates of a tenant are issued, how long they are valid and
+// when they are renewed.
+type certRenewal struct {
+	Validity    time.Duration
+	RenewBefore time.Duration
+	Key         secret.KeyConfig
+}
+
+// tenantCertRenewal returns the certificate renewal of the tenant with defaults applied.
+func tenantCertRenewal(tenant *v1alpha1.Tenant) certRenewal {
+	renewal := certRenewal{
+		Validity:    secret.DefaultCertValidity,
+		RenewBefore: defaultCertRenewBefore,
+	}
+	if tenant.Spec.Certificates.Validity != nil {
+		renewal.Validity = tenant.Spec.Certificates.Validity.Duration
+	}
+	if tenant.Spec.Certificates.RenewBefore != nil {
+		renewal.RenewBefore = tenant.Spec.Certificates.RenewBefore.Duration
+	}
+	renewal.Key = secret.KeyConfig{
+		Algorithm: secret.KeyAlgorithm(tenant.Spec.Certificates.KeyAlgorithm),
+		Size:      tenant.Spec.Certificates.KeySize,
+	}
+	return renewal
+}
+
+// due returns true if the certificate signed by the ca is to be renewed. A certificate expiring
+// with its ca is not, renewing it can not extend its validity.
+func (r certRenewal) due(cert, caCert *x509.Certificate) bool {
+	return time.Now().Add(r.RenewBefore).After(cert.NotAfter) && cert.NotAfter.Before(caCert.NotAfter)
+}
+
+// reconcileCertificates reports the expiry of the certificates of the tenant and returns how long
+// until the next leaf certificate is to be renewed.
+func (c *TenantController) reconcileCertificates(ctx context.Context, tenant *v1alpha1.Tenant) (time.Duration, error) {
+	names := []string{
+		caSecretName, frontProxyCASecretName, apiServerCertSecretName, apiServerEtcdClientSecretName,
+		"kubeconfig-admin", "kubeconfig-controller-manager", "kubeconfig-scheduler",
+	}
+	if tenant.EtcdMode() == v1alpha1.EtcdModeDedicated {
+		names = append(names, etcdCertSecretName)
+	}
+	if tenant.Status.ExternalEndpoint != "" {
+		names = append(names, "kubeconfig-admin-external")
+	}
+
+	var statuses []v1alpha1.CertificateStatus
+	var leaves []*x509.Certificate
+	for _, name := range names {
+		secretObj := &corev1.Secret{}
+		if err := c.Client.Get(ctx, types.NamespacedName{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      name,
+		}, secretObj); err != nil {
+			klog.ErrorS(err, "unable to get secret", "name", name)
+			return 0, err
+		}
+
+		for key, data := range secretObj.Data {
+			for _, cert := range certificatesOf(key, data) {
+				statuses = append(statuses, v1alpha1.CertificateStatus{
+					Name:     name + "/" + key,
+					NotAfter: metav1.NewTime(cert.NotAfter),
+				})
+				if !cert.IsCA {
+					leaves = append(leaves, cert)
+				}
+			}
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	tenant.Status.Certificates = statuses
+
+	renewal := tenantCertRenewal(tenant)
+	var expiring []string
+	for _, status := range statuses {
+		if time.Now().Add(renewal.RenewBefore).After(status.NotAfter.Time) {
+			expiring = append(expiring, status.Name)
+		}
+	}
+	if len(expiring) != 0 {
+		conditions.MarkTrue(tenant, v1alpha1.TenantConditionCertificatesExpiring, "Expiring",
+			fmt.Sprintf("Certificates expire within %s: %s", renewal.RenewBefore, strings.Join(expiring, ", ")))
+	} else {
+		conditions.MarkFalse(tenant, v1alpha1.TenantConditionCertificatesExpiring, "Valid",
+			fmt.Sprintf("No certificate expires within %s", renewal.RenewBefore))
+	}
+
+	var renewIn time.Duration
+	for _, cert := range leaves {
+		if d := time.Until(cert.NotAfter.Add(-renewal.RenewBefore)); d > 0 && (renewIn == 0 || d < renewIn) {
+			renewIn = d
+		}
+	}
+	return renewIn, nil
+}
+
+// certificatesOf returns the certificates in the secret data under key, the certificate under
+// <name>.crt or the client certificates of the kubeconfig under <name>.conf.
+func certificatesOf(key string, data []byte) []*x509.Certificate {
+	switch {
+	case strings.HasSuffix(key, ".crt"):
+		if cert, err := secret.DecodeCertPEM(data); err == nil {
+			return []*x509.Certificate{cert}
+		}
+	case strings.HasSuffix(key, ".conf"):
+		config, err := clientcmd.Load(data)
+		if err != nil {
+			return nil
+		}
+		var certs []*x509.Certificate
+		for _, authInfo := range config.AuthInfos {
+			if cert, err := secret.DecodeCertPEM(authInfo.ClientCertificateData); err == nil {
+				certs = append(certs, cert)
+			}
+		}
+		return certs
+	}
+	return nil
+}
+
+// secretsHash returns the hash of the data of the secrets as read by reader, missing secrets are
+// skipped.
+func secretsHash(ctx context.Context, reader client.Reader, namespace string, names ...string) (string, error) {
+	hash := sha256.New()
+	for _, name := range names {
+		secretObj := &corev1.Secret{}
+		if err := reader.Get(ctx, types.NamespacedName{
+			Namespace: namespace,
+			Name:      name,
+		}, secretObj); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return "", err
+		}
+
+		keys := make([]string, 0, len(secretObj.Data))
+		for key := range secretObj.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(hash, "%s\n", name)
+		for _, key := range keys {
+			fmt.Fprintf(hash, "%s=%x\n", key, secretObj.Data[key])
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
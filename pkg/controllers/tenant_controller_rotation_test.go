@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+)
+
+func TestEnsureCert(t *testing.T) {
+	keyConfig := secret.KeyConfig{Algorithm: secret.KeyAlgorithmECDSA}
+	caCert, caKey, err := secret.NewCA(nil, keyConfig)
+	assert.NoError(t, err)
+	otherCACert, otherCAKey, err := secret.NewCA(nil, keyConfig)
+	assert.NoError(t, err)
+
+	config := &certutil.Config{
+		CommonName: "kube-apiserver",
+		AltNames:   certutil.AltNames{DNSNames: []string{"kube-apiserver"}},
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	renewal := certRenewal{Validity: 24 * time.Hour, RenewBefore: time.Hour, Key: keyConfig}
+
+	tests := []struct {
+		name string
+		// issue signs the certificate in data before ensureCert, none if nil
+		issue        func(data map[string][]byte)
+		config       *certutil.Config
+		renewal      certRenewal
+		wantReissued bool
+	}{
+		{
+			name:         "missing",
+			wantReissued: true,
+		},
+		{
+			name: "valid",
+			issue: func(data map[string][]byte) {
+				assert.NoError(t, ensureCert(data, "apiserver", caCert, caKey, config, renewal))
+			},
+		},
+		{
+			name: "due for renewal",
+			issue: func(data map[string][]byte) {
+				assert.NoError(t, ensureCert(data, "apiserver", caCert, caKey, config,
+					certRenewal{Validity: 30 * time.Minute, RenewBefore: 10 * time.Minute, Key: keyConfig}))
+			},
+			wantReissued: true,
+		},
+		{
+			name: "signed by another ca",
+			issue: func(data map[string][]byte) {
+				assert.NoError(t, ensureCert(data, "apiserver", otherCACert, otherCAKey, config, renewal))
+			},
+			wantReissued: true,
+		},
+		{
+			name: "alt names changed",
+			issue: func(data map[string][]byte) {
+				assert.NoError(t, ensureCert(data, "apiserver", caCert, caKey, config, renewal))
+			},
+			config: &certutil.Config{
+				CommonName: "kube-apiserver",
+				AltNames:   certutil.AltNames{DNSNames: []string{"kube-apiserver", "api.example.com"}},
+				Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			},
+			wantReissued: true,
+		},
+		{
+			name: "key algorithm changed",
+			issue: func(data map[string][]byte) {
+				assert.NoError(t, ensureCert(data, "apiserver", caCert, caKey, config, renewal))
+			},
+			renewal: certRenewal{
+				Validity:    24 * time.Hour,
+				RenewBefore: time.Hour,
+				Key:         secret.KeyConfig{Algorithm: secret.KeyAlgorithmEd25519},
+			},
+			wantReissued: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := map[string][]byte{}
+			if test.issue != nil {
+				test.issue(data)
+			}
+			issued := data["apiserver.crt"]
+			if test.config == nil {
+				test.config = config
+			}
+			if test.renewal == (certRenewal{}) {
+				test.renewal = renewal
+			}
+
+			assert.NoError(t, ensureCert(data, "apiserver", caCert, caKey, test.config, test.renewal))
+			assert.Equal(t, test.wantReissued, string(issued) != string(data["apiserver.crt"]))
+			cert, _, err := decodeCertAndKey(data, "apiserver")
+			assert.NoError(t, err)
+			assert.NoError(t, cert.CheckSignatureFrom(caCert))
+		})
+	}
+}
+
+func TestCertRenewalDue(t *testing.T) {
+	renewal := certRenewal{RenewBefore: time.Hour}
+	now := time.Now()
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		caExpiry time.Time
+		want     bool
+	}{
+		{
+			name:     "not due",
+			notAfter: now.Add(2 * time.Hour),
+			caExpiry: now.Add(24 * time.Hour),
+		},
+		{
+			name:     "due",
+			notAfter: now.Add(30 * time.Minute),
+			caExpiry: now.Add(24 * time.Hour),
+			want:     true,
+		},
+		{
+			name:     "expiring with the ca",
+			notAfter: now.Add(30 * time.Minute),
+			caExpiry: now.Add(30 * time.Minute),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cert := &x509.Certificate{NotAfter: test.notAfter}
+			caCert := &x509.Certificate{NotAfter: test.caExpiry}
+			assert.Equal(t, test.want, renewal.due(cert, caCert))
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/controllerutil"
+)
+
+// The pki of the tenant is split into secrets by who needs it, the components mount only the keys
+// they use through projected volumes.
+const (
+	// caSecretName holds the tenant ca, the cas of a rotation in flight and the trusted ca bundle.
+	caSecretName = "ca"
+	// frontProxyCASecretName holds the front proxy ca.
+	frontProxyCASecretName = "front-proxy-ca"
+	// serviceAccountSecretName holds the key pair signing the service account tokens.
+	serviceAccountSecretName = "sa"
+	// apiServerCertSecretName holds the serving and client certificates of the apiserver.
+	apiServerCertSecretName = "apiserver-cert"
+	// apiServerEtcdClientSecretName holds the etcd ca and the etcd client certificate of the apiserver.
+	apiServerEtcdClientSecretName = "apiserver-etcd-client"
+
+	// legacyServerCertSecretName held the whole pki of the tenant before it was split, it seeds the
+	// split secrets so the cas and keys of existing tenants are kept.
+	legacyServerCertSecretName = "server-cert"
+)
+
+var (
+	caSecretKeys                  = []string{"ca.crt", "ca.key", "ca-new.crt", "ca-new.key", "ca-old.crt", caBundleKey}
+	frontProxyCASecretKeys        = []string{"front-proxy-ca.crt", "front-proxy-ca.key"}
+	serviceAccountSecretKeys      = []string{"sa.key", "sa.pub"}
+	apiServerCertSecretKeys       = []string{"apiserver.crt", "apiserver.key", "apiserver-kubelet-client.crt", "apiserver-kubelet-client.key", "front-proxy-client.crt", "front-proxy-client.key"}
+	apiServerEtcdClientSecretKeys = []string{"etcd-ca.crt", "apiserver-etcd-client.crt", "apiserver-etcd-client.key"}
+)
+
+// reconcilePKISecret reconciles the secret name holding the keys of the pki of the tenant, mutate
+// ensures the data of the secret. A new secret is seeded with the keys from the legacy server-cert
+// secret, keys outside of keys are dropped.
+func (c *TenantController) reconcilePKISecret(ctx context.Context, tenant *v1alpha1.Tenant, name string, keys []string, mutate func(data map[string][]byte) error) error {
+	secretObj := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      name,
+		},
+	}
+	legacy := &corev1.Secret{}
+	if err := c.Client.Get(ctx, types.NamespacedName{
+		Namespace: tenant.ClusterNamespaceInHost(),
+		Name:      legacyServerCertSecretName,
+	}, legacy); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	_, err := controllerutil.CreateOrPatch(ctx, c.Client, secretObj, func() error {
+		secretObj.ObjectMeta.OwnerReferences = ownerReferences(tenant)
+		secretObj.Type = "kcp/kube-secret"
+		data := make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			if value, ok := secretObj.Data[key]; ok {
+				data[key] = value
+			} else if value, ok := legacy.Data[key]; ok && secretObj.CreationTimestamp.IsZero() {
+				data[key] = value
+			}
+		}
+		if err := mutate(data); err != nil {
+			return err
+		}
+
+		secretObj.Data = make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			if value, ok := data[key]; ok {
+				secretObj.Data[key] = value
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// secretProjection projects the keys of the secret name into a volume under the same paths.
+func secretProjection(name string, keys ...string) corev1.VolumeProjection {
+	items := make([]corev1.KeyToPath, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, corev1.KeyToPath{Key: key, Path: key})
+	}
+	return corev1.VolumeProjection{
+		Secret: &corev1.SecretProjection{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			Items:                items,
+		},
+	}
+}
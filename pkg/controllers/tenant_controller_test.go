@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/version"
+)
+
+func newFakeClient(objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+// newIndexedFakeClient returns a fake client listing the objects matching the fieldIndexes, like
+// the cache of the manager. The fake client does not support field selectors.
+func newIndexedFakeClient(objs ...client.Object) client.Client {
+	return &indexedClient{Client: newFakeClient(objs...)}
+}
+
+type indexedClient struct {
+	client.Client
+}
+
+func (c *indexedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if listOpts.FieldSelector == nil {
+		return c.Client.List(ctx, list, opts...)
+	}
+	requirements := listOpts.FieldSelector.Requirements()
+	if len(requirements) != 1 {
+		return fmt.Errorf("non-exact field matches are not supported by the cache")
+	}
+	field, value := requirements[0].Field, requirements[0].Value
+	listOpts.FieldSelector = nil
+	if err := c.Client.List(ctx, list, listOpts); err != nil {
+		return err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	var matched []runtime.Object
+	for _, item := range items {
+		for _, index := range fieldIndexes {
+			if index.field == field && reflect.TypeOf(index.obj) == reflect.TypeOf(item) &&
+				containsString(index.extract(item.(client.Object)), value) {
+				matched = append(matched, item)
+			}
+		}
+	}
+	return meta.SetList(list, matched)
+}
+
+// newControlPlaneDeployments returns the deployments of the control plane of tenant running its
+// version, rolled out except for the rolling ones.
+func newControlPlaneDeployments(tenant *v1alpha1.Tenant, rolling ...string) []client.Object {
+	var objs []client.Object
+	for _, component := range controlPlaneComponents {
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: tenant.ClusterNamespaceInHost(),
+				Name:      component.Name,
+				// the fake client does not set it
+				UID: types.UID(component.Name),
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:  component.Container,
+								Image: version.Image(tenant.Spec.ImageRepository, component.Name, tenant.Status.Version),
+							},
+						},
+					},
+				},
+			},
+			Status: appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1},
+		}
+		if containsString(rolling, component.Name) {
+			deployment.Status.UpdatedReplicas = 0
+		}
+		objs = append(objs, deployment)
+	}
+	return objs
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/conditions"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/version"
+)
+
+type controlPlaneComponent struct {
+	// Name is the name of the Deployment and of the image of the component.
+	Name string
+	// Container is the name of the component container in the Deployment.
+	Container string
+}
+
+// controlPlaneComponents lists the control-plane components in upgrade order, the
+// apiserver goes first so it is never older than the components talking to it.
+var controlPlaneComponents = []controlPlaneComponent{
+	{Name: "kube-apiserver", Container: "apiserver"},
+	{Name: "kube-controller-manager", Container: "controller-manager"},
+	{Name: "kube-scheduler", Container: "scheduler"},
+}
+
+// reconcileUpgrade rolls the control plane to the requested version one component at a time.
+func (c *TenantController) reconcileUpgrade(ctx context.Context, tenant *v1alpha1.Tenant) (reconcile.Result, error) {
+	// the spec is validated so the version always resolves
+	desired, _ := version.Resolve(tenant.Spec.Version)
+
+	if tenant.Status.Upgrade == nil {
+		if desired == tenant.Status.Version {
+			if conditions.GetReason(tenant, v1alpha1.TenantConditionUpgrading) == "UpgradeRefused" {
+				conditions.Delete(tenant, v1alpha1.TenantConditionUpgrading)
+			}
+			return reconcile.Result{}, nil
+		}
+
+		if err := version.ValidateUpgrade(tenant.Status.Version, desired); err != nil {
+			klog.ErrorS(err, "refuse to upgrade Tenant", "name", tenant.Name)
+			conditions.MarkFalse(tenant, v1alpha1.TenantConditionUpgrading, "UpgradeRefused", err.Error())
+			return reconcile.Result{}, nil
+		}
+		tenant.Status.Upgrade = &v1alpha1.TenantUpgradeStatus{
+			Version: desired,
+		}
+	}
+
+	target := tenant.Status.Upgrade.Version
+	if desired != target {
+		klog.Warningf("tenant[%s] is upgrading to %s, version %s is applied after it completes", tenant.Name, target, desired)
+	}
+	conditions.MarkTrue(tenant, v1alpha1.TenantConditionUpgrading, "Upgrading",
+		fmt.Sprintf("Upgrading from %s to %s", tenant.Status.Version, target))
+
+	for _, component := range controlPlaneComponents {
+		if containsString(tenant.Status.Upgrade.Components, component.Name) {
+			continue
+		}
+
+		deployment := &appsv1.Deployment{}
+		if err := c.Client.Get(ctx, types.NamespacedName{
+			Namespace: tenant.ClusterNamespaceInHost(),
+			Name:      component.Name,
+		}, deployment); err != nil {
+			klog.ErrorS(err, "unable to get deployment", "name", component.Name)
+			return reconcile.Result{}, err
+		}
+		// the image is set by the phase of the component, which runs the version of the upgrade
+		// once the upgrade reaches the component
+		if image := version.Image(tenant.Spec.ImageRepository, component.Name, target); containerImage(deployment, component.Container) != image {
+			klog.V(1).InfoS("waiting for deployment to be upgraded", "name", component.Name, "version", target)
+			return reconcile.Result{Requeue: true}, nil
+		}
+		if !isDeploymentRolledOut(deployment) {
+			klog.V(1).InfoS("waiting for deployment to roll out", "name", component.Name, "version", target)
+			return reconcile.Result{Requeue: true, RequeueAfter: 10 * time.Second}, nil
+		}
+		tenant.Status.Upgrade.Components = append(tenant.Status.Upgrade.Components, component.Name)
+	}
+
+	tenant.Status.Version = target
+	tenant.Status.Upgrade = nil
+	conditions.MarkFalse(tenant, v1alpha1.TenantConditionUpgrading, "Completed", fmt.Sprintf("Upgraded to %s", target))
+	return reconcile.Result{}, nil
+}
+
+// componentVersion returns the version a control-plane component runs. During an upgrade the
+// components already upgraded and the one being upgraded run the upgrade version.
+func componentVersion(tenant *v1alpha1.Tenant, name string) string {
+	upgrade := tenant.Status.Upgrade
+	if upgrade == nil {
+		return tenant.Status.Version
+	}
+	for _, component := range controlPlaneComponents {
+		if component.Name == name {
+			return upgrade.Version
+		}
+		if !containsString(upgrade.Components, component.Name) {
+			// components after the one being upgraded keep running the current version
+			break
+		}
+	}
+	return tenant.Status.Version
+}
+
+// containerImage returns the image of the container name in the pod template of the deployment.
+func containerImage(deployment *appsv1.Deployment, name string) string {
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name == name {
+			return container.Image
+		}
+	}
+	return ""
+}
+
+// isDeploymentRolledOut returns true if all replicas of the latest revision are updated and ready.
+func isDeploymentRolledOut(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.Replicas == replicas &&
+		deployment.Status.ReadyReplicas == replicas
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/conditions"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/version"
+)
+
+func TestReconcileUpgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		upgrade *v1alpha1.TenantUpgradeStatus
+		// images are the versions the components run, by name, the current version if not set
+		images  map[string]string
+		rolling []string
+
+		wantVersion string
+		wantUpgrade *v1alpha1.TenantUpgradeStatus
+		wantReason  string
+		wantResult  reconcile.Result
+	}{
+		{
+			name:        "up to date",
+			version:     "v1.22",
+			wantVersion: "v1.22.9",
+		},
+		{
+			name:        "downgrade refused",
+			version:     "v1.21",
+			wantVersion: "v1.22.9",
+			wantReason:  "UpgradeRefused",
+		},
+		{
+			name:        "started",
+			version:     "v1.23",
+			wantVersion: "v1.22.9",
+			wantUpgrade: &v1alpha1.TenantUpgradeStatus{Version: "v1.23.4"},
+			wantReason:  "Upgrading",
+			wantResult:  reconcile.Result{Requeue: true},
+		},
+		{
+			name:        "apiserver rolling",
+			version:     "v1.23",
+			upgrade:     &v1alpha1.TenantUpgradeStatus{Version: "v1.23.4"},
+			images:      map[string]string{"kube-apiserver": "v1.23.4"},
+			rolling:     []string{"kube-apiserver"},
+			wantVersion: "v1.22.9",
+			wantUpgrade: &v1alpha1.TenantUpgradeStatus{Version: "v1.23.4"},
+			wantReason:  "Upgrading",
+			wantResult:  reconcile.Result{Requeue: true, RequeueAfter: 10 * time.Second},
+		},
+		{
+			name:    "controller-manager not upgraded yet",
+			version: "v1.23",
+			upgrade: &v1alpha1.TenantUpgradeStatus{Version: "v1.23.4"},
+			images:  map[string]string{"kube-apiserver": "v1.23.4"},
+
+			wantVersion: "v1.22.9",
+			wantUpgrade: &v1alpha1.TenantUpgradeStatus{
+				Version:    "v1.23.4",
+				Components: []string{"kube-apiserver"},
+			},
+			wantReason: "Upgrading",
+			wantResult: reconcile.Result{Requeue: true},
+		},
+		{
+			name:    "controller-manager rolling",
+			version: "v1.23",
+			upgrade: &v1alpha1.TenantUpgradeStatus{Version: "v1.23.4"},
+			images:  map[string]string{"kube-apiserver": "v1.23.4", "kube-controller-manager": "v1.23.4"},
+			rolling: []string{"kube-controller-manager"},
+
+			wantVersion: "v1.22.9",
+			wantUpgrade: &v1alpha1.TenantUpgradeStatus{
+				Version:    "v1.23.4",
+				Components: []string{"kube-apiserver"},
+			},
+			wantReason: "Upgrading",
+			wantResult: reconcile.Result{Requeue: true, RequeueAfter: 10 * time.Second},
+		},
+		{
+			name:    "upgraded",
+			version: "v1.23",
+			upgrade: &v1alpha1.TenantUpgradeStatus{Version: "v1.23.4"},
+			images: map[string]string{
+				"kube-apiserver":          "v1.23.4",
+				"kube-controller-manager": "v1.23.4",
+				"kube-scheduler":          "v1.23.4",
+			},
+			wantVersion: "v1.23.4",
+			wantReason:  "Completed",
+		},
+		{
+			name:    "version changed during the upgrade",
+			version: "v1.23.1",
+			upgrade: &v1alpha1.TenantUpgradeStatus{
+				Version:    "v1.23.4",
+				Components: []string{"kube-apiserver", "kube-controller-manager"},
+			},
+			images:      map[string]string{"kube-scheduler": "v1.23.4"},
+			wantVersion: "v1.23.4",
+			wantReason:  "Completed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+			tenant.Spec.Version = test.version
+			tenant.Status.Version = "v1.22.9"
+			tenant.Status.Upgrade = test.upgrade
+			objs := newControlPlaneDeployments(tenant, test.rolling...)
+			for _, obj := range objs {
+				if image, ok := test.images[obj.GetName()]; ok {
+					deployment := obj.(*appsv1.Deployment)
+					deployment.Spec.Template.Spec.Containers[0].Image = version.Image("", obj.GetName(), image)
+				}
+			}
+			c := &TenantController{Client: newFakeClient(objs...)}
+
+			result, err := c.reconcileUpgrade(context.Background(), tenant)
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantResult, result)
+			assert.Equal(t, test.wantVersion, tenant.Status.Version)
+			assert.Equal(t, test.wantUpgrade, tenant.Status.Upgrade)
+			assert.Equal(t, test.wantReason, conditions.GetReason(tenant, v1alpha1.TenantConditionUpgrading))
+
+			// the deployments are left to the phases
+			for _, component := range controlPlaneComponents {
+				deployment := &appsv1.Deployment{}
+				assert.NoError(t, c.Client.Get(context.Background(), types.NamespacedName{
+					Namespace: tenant.ClusterNamespaceInHost(),
+					Name:      component.Name,
+				}, deployment))
+				want, ok := test.images[component.Name]
+				if !ok {
+					want = "v1.22.9"
+				}
+				assert.Equal(t, version.Image("", component.Name, want),
+					deployment.Spec.Template.Spec.Containers[0].Image, component.Name)
+			}
+		})
+	}
+}
+
+func TestComponentVersion(t *testing.T) {
+	tenant := &v1alpha1.Tenant{}
+	tenant.Status.Version = "v1.22.9"
+	assert.Equal(t, "v1.22.9", componentVersion(tenant, "kube-scheduler"))
+
+	tenant.Status.Upgrade = &v1alpha1.TenantUpgradeStatus{
+		Version:    "v1.23.4",
+		Components: []string{"kube-apiserver"},
+	}
+	assert.Equal(t, "v1.23.4", componentVersion(tenant, "kube-apiserver"))
+	assert.Equal(t, "v1.23.4", componentVersion(tenant, "kube-controller-manager"))
+	assert.Equal(t, "v1.22.9", componentVersion(tenant, "kube-scheduler"))
+}
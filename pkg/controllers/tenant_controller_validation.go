@@ -0,0 +1,453 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	utilnet "k8s.io/utils/net"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/conditions"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/ipam"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/version"
+)
+
+// validateTenant checks the Tenant spec and returns a slice of found errs.
+func validateTenant(tenant *v1alpha1.Tenant) field.ErrorList {
+	errs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	if _, err := version.Resolve(tenant.Spec.Version); err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("version"), tenant.Spec.Version, err.Error()))
+	}
+
+	for i, name := range tenant.Spec.CertSANs {
+		if net.ParseIP(name) != nil {
+			continue
+		}
+		if len(validation.IsDNS1123Subdomain(name)) != 0 && len(validation.IsWildcardDNS1123Subdomain(name)) != 0 {
+			errs = append(errs, field.Invalid(specPath.Child("certSANs").Index(i), name, "must be an IP or a DNS name"))
+		}
+	}
+
+	errs = append(errs, validateCertificates(tenant, specPath.Child("certificates"))...)
+	errs = append(errs, validateControlPlane(tenant, specPath.Child("controlPlane"))...)
+	errs = append(errs, validateAuthentication(&tenant.Spec.Authentication, specPath.Child("authentication"))...)
+	if webhook := tenant.Spec.Authorization.Webhook; webhook != nil {
+		errs = append(errs, validateSecretReference(&webhook.KubeConfigSecret,
+			specPath.Child("authorization", "webhook", "kubeConfigSecret"))...)
+	}
+	if audit := tenant.Spec.Audit; audit != nil {
+		errs = append(errs, validateAudit(audit, specPath.Child("audit"))...)
+	}
+	errs = append(errs, validateNetwork(tenant, specPath.Child("network"))...)
+	errs = append(errs, validateEtcd(tenant, specPath.Child("etcd"))...)
+	if expose := tenant.Spec.Expose; expose != nil {
+		errs = append(errs, validateExpose(expose, specPath.Child("expose"))...)
+	}
+
+	return errs
+}
+
+// validateCertificates checks the certificate settings of the tenant.
+func validateCertificates(tenant *v1alpha1.Tenant, certificatesPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	renewal := tenantCertRenewal(tenant)
+	if renewal.Validity < time.Hour {
+		errs = append(errs, field.Invalid(certificatesPath.Child("validity"), renewal.Validity.String(), "must be at least 1h"))
+	}
+	if renewal.RenewBefore <= 0 || renewal.RenewBefore >= renewal.Validity {
+		errs = append(errs, field.Invalid(certificatesPath.Child("renewBefore"), renewal.RenewBefore.String(),
+			"must be positive and less than the validity"))
+	}
+	if err := renewal.Key.Validate(); err != nil {
+		switch renewal.Key.Algorithm {
+		case secret.KeyAlgorithmRSA, secret.KeyAlgorithmECDSA, secret.KeyAlgorithmEd25519, "":
+			errs = append(errs, field.Invalid(certificatesPath.Child("keySize"), renewal.Key.Size, err.Error()))
+		default:
+			errs = append(errs, field.NotSupported(certificatesPath.Child("keyAlgorithm"), renewal.Key.Algorithm,
+				[]string{string(secret.KeyAlgorithmRSA), string(secret.KeyAlgorithmECDSA), string(secret.KeyAlgorithmEd25519)}))
+		}
+	}
+	if tenant.Spec.Certificates.CA != nil && tenant.Spec.Certificates.Issuer != nil {
+		errs = append(errs, field.Forbidden(certificatesPath.Child("issuer"), "can not be set together with ca"))
+	}
+	if tenant.Status.ExternalCA && tenant.Spec.Certificates.CA == nil && tenant.Spec.Certificates.Issuer == nil {
+		// a generated ca would replace the ca trusted by the clients without a rotation
+		errs = append(errs, field.Forbidden(certificatesPath.Child("ca"),
+			"can not be removed once in use, the tenant does not hold the key of the ca"))
+	}
+	if overlap := caRotationOverlap(tenant); overlap < 0 {
+		errs = append(errs, field.Invalid(certificatesPath.Child("caRotationOverlap"), overlap.String(), "must not be negative"))
+	}
+	return errs
+}
+
+// validateControlPlane checks the replicas and the components of the control plane.
+func validateControlPlane(tenant *v1alpha1.Tenant, controlPlanePath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if replicas := controlPlaneReplicas(tenant); replicas < 1 {
+		errs = append(errs, field.Invalid(controlPlanePath.Child("replicas"), replicas, "must be at least 1"))
+	}
+	for _, component := range []struct {
+		name string
+		app  string
+		spec *v1alpha1.ComponentSpec
+	}{
+		{"apiServer", "kube-apiserver", &tenant.Spec.ControlPlane.APIServer},
+		{"controllerManager", "kube-controller-manager", &tenant.Spec.ControlPlane.ControllerManager},
+		{"scheduler", "kube-scheduler", &tenant.Spec.ControlPlane.Scheduler},
+	} {
+		errs = append(errs, validateComponent(tenant, component.app, component.spec, controlPlanePath.Child(component.name))...)
+	}
+	return errs
+}
+
+// validateComponent checks the scheduling, resources, args, volumes and probes of the
+// control-plane component app of the tenant.
+func validateComponent(tenant *v1alpha1.Tenant, app string, component *v1alpha1.ComponentSpec, componentPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if component.PriorityClassName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(component.PriorityClassName) {
+			errs = append(errs, field.Invalid(componentPath.Child("priorityClassName"), component.PriorityClassName, msg))
+		}
+	}
+	if component.Resources != nil {
+		for resourceName, request := range component.Resources.Requests {
+			if limit, ok := component.Resources.Limits[resourceName]; ok && request.Cmp(limit) > 0 {
+				errs = append(errs, field.Invalid(componentPath.Child("resources", "requests").Key(string(resourceName)),
+					request.String(), fmt.Sprintf("must be less than or equal to the %s limit", resourceName)))
+			}
+		}
+	}
+	for _, name := range sets.StringKeySet(component.ExtraArgs).List() {
+		switch {
+		case name == "feature-gates":
+			errs = append(errs, field.Forbidden(componentPath.Child("extraArgs").Key(name), "use featureGates instead"))
+		case isPlatformFlag(tenant, app, name):
+			errs = append(errs, field.Forbidden(componentPath.Child("extraArgs").Key(name), "is set by the platform"))
+		case name == "" || strings.HasPrefix(name, "-") || strings.Contains(name, "="):
+			errs = append(errs, field.Invalid(componentPath.Child("extraArgs").Key(name), name,
+				"must be a flag name without the leading dashes"))
+		}
+	}
+	volumeNames := sets.NewString()
+	for i, volume := range component.ExtraVolumes {
+		volumePath := componentPath.Child("extraVolumes").Index(i)
+		switch {
+		case sets.NewString(reservedVolumes...).Has(volume.Name):
+			errs = append(errs, field.Forbidden(volumePath.Child("name"), fmt.Sprintf("%s is used by the platform", volume.Name)))
+		case volumeNames.Has(volume.Name):
+			errs = append(errs, field.Duplicate(volumePath.Child("name"), volume.Name))
+		}
+		for _, msg := range validation.IsDNS1123Label(volume.Name) {
+			errs = append(errs, field.Invalid(volumePath.Child("name"), volume.Name, msg))
+		}
+		volumeNames.Insert(volume.Name)
+		if !path.IsAbs(volume.MountPath) {
+			errs = append(errs, field.Invalid(volumePath.Child("mountPath"), volume.MountPath, "must be an absolute path"))
+		}
+		if (volume.Secret == nil) == (volume.ConfigMap == nil) {
+			errs = append(errs, field.Invalid(volumePath, volume.Name, "must set exactly one of secret and configMap"))
+		}
+	}
+	for _, probe := range []struct {
+		name     string
+		override *v1alpha1.ProbeOverride
+	}{
+		{"liveness", component.Probes.Liveness},
+		{"readiness", component.Probes.Readiness},
+		{"startup", component.Probes.Startup},
+	} {
+		errs = append(errs, validateProbeOverride(probe.override, probe.name != "readiness", componentPath.Child("probes", probe.name))...)
+	}
+	return errs
+}
+
+// validateProbeOverride checks the timing of the probe override, the success threshold of the
+// liveness and startup probes must be 1.
+func validateProbeOverride(override *v1alpha1.ProbeOverride, singleSuccess bool, probePath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if override == nil {
+		return errs
+	}
+	if seconds := override.InitialDelaySeconds; seconds != nil && *seconds < 0 {
+		errs = append(errs, field.Invalid(probePath.Child("initialDelaySeconds"), *seconds, "must not be negative"))
+	}
+	for _, value := range []struct {
+		name  string
+		value *int32
+	}{
+		{"periodSeconds", override.PeriodSeconds},
+		{"timeoutSeconds", override.TimeoutSeconds},
+		{"successThreshold", override.SuccessThreshold},
+		{"failureThreshold", override.FailureThreshold},
+	} {
+		if value.value != nil && *value.value < 1 {
+			errs = append(errs, field.Invalid(probePath.Child(value.name), *value.value, "must be at least 1"))
+		}
+	}
+	if threshold := override.SuccessThreshold; singleSuccess && threshold != nil && *threshold > 1 {
+		errs = append(errs, field.Invalid(probePath.Child("successThreshold"), *threshold, "must be 1"))
+	}
+	return errs
+}
+
+// validateAuthentication checks the authenticators of the tenant apiserver.
+func validateAuthentication(authentication *v1alpha1.AuthenticationSpec, authenticationPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if oidc := authentication.OIDC; oidc != nil {
+		oidcPath := authenticationPath.Child("oidc")
+		if issuerURL, err := url.Parse(oidc.IssuerURL); err != nil || issuerURL.Scheme != "https" || issuerURL.Host == "" {
+			errs = append(errs, field.Invalid(oidcPath.Child("issuerURL"), oidc.IssuerURL, "must be an https URL"))
+		}
+		if oidc.ClientID == "" {
+			errs = append(errs, field.Required(oidcPath.Child("clientID"), "must not be empty"))
+		}
+		for i, scope := range oidc.ExtraScopes {
+			if scope == "" || strings.ContainsAny(scope, " \t\n") {
+				errs = append(errs, field.Invalid(oidcPath.Child("extraScopes").Index(i), scope, "must be a single scope"))
+			}
+		}
+		if ref := oidc.CASecret; ref != nil {
+			errs = append(errs, validateSecretReference(ref, oidcPath.Child("caSecret"))...)
+		}
+	}
+	if webhook := authentication.Webhook; webhook != nil {
+		errs = append(errs, validateSecretReference(&webhook.KubeConfigSecret,
+			authenticationPath.Child("webhook", "kubeConfigSecret"))...)
+	}
+	return errs
+}
+
+// validateAudit checks the audit policy and backends of the tenant apiserver.
+func validateAudit(spec *v1alpha1.AuditSpec, auditPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if ref := spec.PolicyConfigMap; ref != nil {
+		refPath := auditPath.Child("policyConfigMap")
+		for _, msg := range validation.IsDNS1123Label(ref.Namespace) {
+			errs = append(errs, field.Invalid(refPath.Child("namespace"), ref.Namespace, msg))
+		}
+		for _, msg := range validation.IsDNS1123Subdomain(ref.Name) {
+			errs = append(errs, field.Invalid(refPath.Child("name"), ref.Name, msg))
+		}
+	}
+	if spec.Log == nil && spec.Webhook == nil {
+		errs = append(errs, field.Required(auditPath, "must set at least one of log and webhook"))
+	}
+	if log := spec.Log; log != nil && log.ClaimName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(log.ClaimName) {
+			errs = append(errs, field.Invalid(auditPath.Child("log", "claimName"), log.ClaimName, msg))
+		}
+	}
+	if webhook := spec.Webhook; webhook != nil {
+		errs = append(errs, validateSecretReference(&webhook.KubeConfigSecret,
+			auditPath.Child("webhook", "kubeConfigSecret"))...)
+	}
+	return errs
+}
+
+// validateNetwork checks the ip ranges of the tenant, which can not change once allocated.
+func validateNetwork(tenant *v1alpha1.Tenant, networkPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	network := tenant.Spec.Network
+	for _, cidrs := range []struct {
+		name  string
+		cidrs []string
+	}{
+		{"serviceCIDRs", network.ServiceCIDRs},
+		{"podCIDRs", network.PodCIDRs},
+	} {
+		cidrsPath := networkPath.Child(cidrs.name)
+		valid := true
+		for i, cidr := range cidrs.cidrs {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				errs = append(errs, field.Invalid(cidrsPath.Index(i), cidr, err.Error()))
+				valid = false
+				continue
+			}
+			// the apiserver refuses service ranges of more than 2^20 ips
+			if ones, bits := ipNet.Mask.Size(); cidrs.name == "serviceCIDRs" && bits-ones > 20 {
+				errs = append(errs, field.Invalid(cidrsPath.Index(i), cidr, fmt.Sprintf("must have a prefix length of at least %d", bits-20)))
+			}
+		}
+		switch {
+		case len(cidrs.cidrs) > 2:
+			errs = append(errs, field.TooMany(cidrsPath, len(cidrs.cidrs), 2))
+		case valid && len(cidrs.cidrs) == 2:
+			if dualStack, _ := utilnet.IsDualStackCIDRStrings(cidrs.cidrs); !dualStack {
+				errs = append(errs, field.Invalid(cidrsPath, cidrs.cidrs, "must be one ipv4 and one ipv6 range for dual-stack"))
+			}
+		}
+		if status := tenant.Status.Network; status != nil && len(cidrs.cidrs) != 0 {
+			allocated := status.ServiceCIDRs
+			if cidrs.name == "podCIDRs" {
+				allocated = status.PodCIDRs
+			}
+			if strings.Join(cidrs.cidrs, ",") != strings.Join(allocated, ",") {
+				errs = append(errs, field.Forbidden(cidrsPath,
+					fmt.Sprintf("can not change from %s once allocated", strings.Join(allocated, ","))))
+			}
+		}
+	}
+	for _, serviceCIDR := range parseCIDRs(network.ServiceCIDRs) {
+		for _, podCIDR := range parseCIDRs(network.PodCIDRs) {
+			if ipam.Overlaps(serviceCIDR, podCIDR) {
+				errs = append(errs, field.Invalid(networkPath.Child("podCIDRs"), podCIDR.String(),
+					fmt.Sprintf("must not overlap service cidr %s", serviceCIDR)))
+			}
+		}
+	}
+	ipv4MaskSize, ipv6MaskSize := nodeCIDRMaskSizes(tenant)
+	for _, podCIDR := range parseCIDRs(tenantNetwork(tenant).PodCIDRs) {
+		name, maskSize := "nodeCIDRMaskSizeIPv4", ipv4MaskSize
+		if utilnet.IsIPv6CIDR(podCIDR) {
+			name, maskSize = "nodeCIDRMaskSizeIPv6", ipv6MaskSize
+		}
+		// the controller-manager allocates the node ranges from the pod range, at most 2^16 of them
+		ones, bits := podCIDR.Mask.Size()
+		min, max := ones+1, ones+16
+		if max > bits {
+			max = bits
+		}
+		if int(maskSize) < min || int(maskSize) > max {
+			errs = append(errs, field.Invalid(networkPath.Child(name), maskSize,
+				fmt.Sprintf("must be between %d and %d for pod cidr %s", min, max, podCIDR)))
+		}
+	}
+	return errs
+}
+
+// validateEtcd checks the etcd mode, the dedicated etcd and the placement of the tenant.
+func validateEtcd(tenant *v1alpha1.Tenant, etcdPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if tenant.Status.EtcdMode != "" && tenant.EtcdMode() != tenant.Status.EtcdMode {
+		errs = append(errs, field.Forbidden(etcdPath.Child("mode"),
+			fmt.Sprintf("can not change from %s once provisioned", tenant.Status.EtcdMode)))
+	}
+	if tenant.EtcdMode() == v1alpha1.EtcdModeDedicated {
+		errs = append(errs, validateDedicatedEtcd(tenant, etcdPath.Child("dedicated"))...)
+	}
+	if placement := tenant.Spec.Etcd.Placement; placement != nil {
+		errs = append(errs, validateEtcdPlacement(tenant, placement, etcdPath.Child("placement"))...)
+	}
+	return errs
+}
+
+// validateDedicatedEtcd checks the size of the dedicated etcd, which can not change once created.
+func validateDedicatedEtcd(tenant *v1alpha1.Tenant, dedicatedPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	dedicated := tenant.Spec.Etcd.Dedicated
+	if dedicated == nil {
+		dedicated = &v1alpha1.DedicatedEtcdSpec{}
+	}
+	replicas := int32(1)
+	if dedicated.Replicas != nil {
+		replicas = *dedicated.Replicas
+	}
+	if replicas%2 == 0 {
+		errs = append(errs, field.Invalid(dedicatedPath.Child("replicas"), replicas, "must be odd"))
+	}
+	if status := tenant.Status.DedicatedEtcd; status != nil {
+		if replicas != status.Replicas {
+			errs = append(errs, field.Forbidden(dedicatedPath.Child("replicas"),
+				fmt.Sprintf("can not change from %d once created", status.Replicas)))
+		}
+		storage := defaultEtcdStorage
+		if dedicated.Storage != nil {
+			storage = *dedicated.Storage
+		}
+		if storage.Cmp(status.Storage) != 0 {
+			errs = append(errs, field.Forbidden(dedicatedPath.Child("storage"),
+				fmt.Sprintf("can not change from %s once created", status.Storage.String())))
+		}
+	}
+	return errs
+}
+
+// validateEtcdPlacement checks the placement policy of the tenant on the EtcdBackends.
+func validateEtcdPlacement(tenant *v1alpha1.Tenant, placement *v1alpha1.EtcdPlacement, placementPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if tenant.EtcdMode() != v1alpha1.EtcdModeShared {
+		errs = append(errs, field.Forbidden(placementPath, "only used in Shared mode"))
+	}
+	policy := tenant.EtcdPlacementPolicy()
+	switch {
+	case policy == v1alpha1.EtcdPlacementPolicyReference && placement.Backend == "":
+		errs = append(errs, field.Required(placementPath.Child("backend"), "required for Reference"))
+	case policy == v1alpha1.EtcdPlacementPolicyReference && conditions.Has(tenant, v1alpha1.TenantConditionProvisioned) &&
+		placement.Backend != tenant.Status.EtcdBackend:
+		errs = append(errs, field.Forbidden(placementPath.Child("backend"), "can not move the tenant once provisioned"))
+	case policy != v1alpha1.EtcdPlacementPolicyReference && placement.Backend != "":
+		errs = append(errs, field.Forbidden(placementPath.Child("backend"), "only used for Reference"))
+	}
+	switch {
+	case policy == v1alpha1.EtcdPlacementPolicySelector && placement.Selector == nil:
+		errs = append(errs, field.Required(placementPath.Child("selector"), "required for Selector"))
+	case policy == v1alpha1.EtcdPlacementPolicySelector:
+		if _, err := metav1.LabelSelectorAsSelector(placement.Selector); err != nil {
+			errs = append(errs, field.Invalid(placementPath.Child("selector"), placement.Selector, err.Error()))
+		}
+	case placement.Selector != nil:
+		errs = append(errs, field.Forbidden(placementPath.Child("selector"), "only used for Selector"))
+	}
+	return errs
+}
+
+// validateExpose checks how the tenant apiserver is published outside the host cluster.
+func validateExpose(expose *v1alpha1.ExposeSpec, exposePath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if expose.Host == "" && expose.Type != v1alpha1.ExposeTypeLoadBalancer {
+		errs = append(errs, field.Required(exposePath.Child("host"), fmt.Sprintf("required for %s", expose.Type)))
+	}
+	if expose.Host != "" && net.ParseIP(expose.Host) == nil {
+		for _, msg := range validation.IsDNS1123Subdomain(expose.Host) {
+			errs = append(errs, field.Invalid(exposePath.Child("host"), expose.Host, msg))
+		}
+	}
+	if expose.NodePort != 0 && expose.Type != v1alpha1.ExposeTypeNodePort {
+		errs = append(errs, field.Forbidden(exposePath.Child("nodePort"), "only used for NodePort"))
+	}
+	if _, ok := expose.Annotations[managedAnnotationsAnnotation]; ok {
+		errs = append(errs, field.Forbidden(exposePath.Child("annotations").Key(managedAnnotationsAnnotation), "is set by the platform"))
+	}
+	return errs
+}
+
+// validateSecretReference checks ref names a Secret.
+func validateSecretReference(ref *v1alpha1.SecretReference, refPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	for _, msg := range validation.IsDNS1123Label(ref.Namespace) {
+		errs = append(errs, field.Invalid(refPath.Child("namespace"), ref.Namespace, msg))
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(ref.Name) {
+		errs = append(errs, field.Invalid(refPath.Child("name"), ref.Name, msg))
+	}
+	return errs
+}
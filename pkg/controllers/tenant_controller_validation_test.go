@@ -0,0 +1,365 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/pointer"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/apis/tenancy/v1alpha1"
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/conditions"
+)
+
+// errorFields returns the path and the type of errs, in order.
+func errorFields(errs field.ErrorList) []string {
+	var fields []string
+	for _, err := range errs {
+		fields = append(fields, err.Field+": "+err.Type.String())
+	}
+	return fields
+}
+
+func TestValidateTenant(t *testing.T) {
+	storage := resource.MustParse("20Gi")
+	tests := []struct {
+		name   string
+		tenant func(*v1alpha1.Tenant)
+		want   []string
+	}{
+		{
+			name:   "defaults",
+			tenant: func(*v1alpha1.Tenant) {},
+		},
+		{
+			name: "unknown version",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Version = "v1.8"
+			},
+			want: []string{"spec.version: Invalid value"},
+		},
+		{
+			name: "cert sans",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.CertSANs = []string{"10.0.0.1", "*.example.com", "api.example.com", "not a name"}
+			},
+			want: []string{"spec.certSANs[3]: Invalid value"},
+		},
+		{
+			name: "renewal longer than the validity",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Certificates.Validity = &metav1.Duration{Duration: 2 * time.Hour}
+				tenant.Spec.Certificates.RenewBefore = &metav1.Duration{Duration: 3 * time.Hour}
+			},
+			want: []string{"spec.certificates.renewBefore: Invalid value"},
+		},
+		{
+			name: "unsupported key algorithm",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Certificates.KeyAlgorithm = "DSA"
+			},
+			want: []string{"spec.certificates.keyAlgorithm: Unsupported value"},
+		},
+		{
+			name: "invalid rsa key size",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Certificates.KeyAlgorithm = v1alpha1.KeyAlgorithmRSA
+				tenant.Spec.Certificates.KeySize = 1000
+			},
+			want: []string{"spec.certificates.keySize: Invalid value"},
+		},
+		{
+			name: "ca and issuer",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Certificates.CA = &v1alpha1.CASecretReference{Namespace: "default", Name: "ca"}
+				tenant.Spec.Certificates.Issuer = &v1alpha1.IssuerReference{Name: "issuer"}
+			},
+			want: []string{"spec.certificates.issuer: Forbidden"},
+		},
+		{
+			name: "external ca removed",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Status.ExternalCA = true
+			},
+			want: []string{"spec.certificates.ca: Forbidden"},
+		},
+		{
+			name: "external ca switched to an issuer",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Certificates.Issuer = &v1alpha1.IssuerReference{Name: "issuer"}
+				tenant.Status.ExternalCA = true
+			},
+		},
+		{
+			name: "component",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.ControlPlane.Replicas = pointer.Int32(0)
+				tenant.Spec.ControlPlane.APIServer = v1alpha1.ComponentSpec{
+					PriorityClassName: "Critical",
+					Resources: &corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+						Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+					},
+					ExtraArgs: map[string]string{
+						"feature-gates":  "A=true",
+						"secure-port":    "443",
+						"--v":            "4",
+						"max-inflight":   "400",
+						"etcd-prefix":    "/other",
+						"profiling=true": "",
+					},
+				}
+			},
+			want: []string{
+				"spec.controlPlane.replicas: Invalid value",
+				"spec.controlPlane.apiServer.priorityClassName: Invalid value",
+				"spec.controlPlane.apiServer.resources.requests[cpu]: Invalid value",
+				"spec.controlPlane.apiServer.extraArgs[--v]: Invalid value",
+				"spec.controlPlane.apiServer.extraArgs[etcd-prefix]: Forbidden",
+				"spec.controlPlane.apiServer.extraArgs[feature-gates]: Forbidden",
+				"spec.controlPlane.apiServer.extraArgs[profiling=true]: Invalid value",
+				"spec.controlPlane.apiServer.extraArgs[secure-port]: Forbidden",
+			},
+		},
+		{
+			name: "component probes",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.ControlPlane.ControllerManager.Probes = v1alpha1.ComponentProbes{
+					Liveness: &v1alpha1.ProbeOverride{
+						InitialDelaySeconds: pointer.Int32(-1),
+						SuccessThreshold:    pointer.Int32(2),
+					},
+					Readiness: &v1alpha1.ProbeOverride{
+						PeriodSeconds:    pointer.Int32(0),
+						SuccessThreshold: pointer.Int32(2),
+					},
+					Startup: &v1alpha1.ProbeOverride{FailureThreshold: pointer.Int32(60)},
+				}
+			},
+			want: []string{
+				"spec.controlPlane.controllerManager.probes.liveness.initialDelaySeconds: Invalid value",
+				"spec.controlPlane.controllerManager.probes.liveness.successThreshold: Invalid value",
+				"spec.controlPlane.controllerManager.probes.readiness.periodSeconds: Invalid value",
+			},
+		},
+		{
+			name: "component volumes",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.ControlPlane.Scheduler.ExtraVolumes = []v1alpha1.ComponentVolume{
+					{Name: "pki", MountPath: "/pki", Secret: &corev1.SecretVolumeSource{SecretName: "pki"}},
+					{Name: "config", MountPath: "/config", ConfigMap: &corev1.ConfigMapVolumeSource{}},
+					{Name: "config", MountPath: "config"},
+				}
+			},
+			want: []string{
+				"spec.controlPlane.scheduler.extraVolumes[0].name: Forbidden",
+				"spec.controlPlane.scheduler.extraVolumes[2].name: Duplicate value",
+				"spec.controlPlane.scheduler.extraVolumes[2].mountPath: Invalid value",
+				"spec.controlPlane.scheduler.extraVolumes[2]: Invalid value",
+			},
+		},
+		{
+			name: "authentication and authorization",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Authentication.OIDC = &v1alpha1.OIDCSpec{
+					IssuerURL:   "http://issuer.example.com",
+					ExtraScopes: []string{"groups", "offline access"},
+					CASecret:    &v1alpha1.SecretReference{Namespace: "default", Name: "Issuer"},
+				}
+				tenant.Spec.Authentication.Webhook = &v1alpha1.WebhookSpec{
+					KubeConfigSecret: v1alpha1.SecretReference{Namespace: "", Name: "authn"},
+				}
+				tenant.Spec.Authorization.Webhook = &v1alpha1.WebhookSpec{
+					KubeConfigSecret: v1alpha1.SecretReference{Namespace: "default", Name: "authz"},
+				}
+			},
+			want: []string{
+				"spec.authentication.oidc.issuerURL: Invalid value",
+				"spec.authentication.oidc.clientID: Required value",
+				"spec.authentication.oidc.extraScopes[1]: Invalid value",
+				"spec.authentication.oidc.caSecret.name: Invalid value",
+				"spec.authentication.webhook.kubeConfigSecret.namespace: Invalid value",
+			},
+		},
+		{
+			name: "audit without backend",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Audit = &v1alpha1.AuditSpec{
+					PolicyConfigMap: &v1alpha1.ConfigMapReference{Namespace: "default", Name: "Policy"},
+				}
+			},
+			want: []string{
+				"spec.audit.policyConfigMap.name: Invalid value",
+				"spec.audit: Required value",
+			},
+		},
+		{
+			name: "audit log claim",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Audit = &v1alpha1.AuditSpec{
+					Log: &v1alpha1.AuditLogSpec{ClaimName: "Audit"},
+				}
+			},
+			want: []string{"spec.audit.log.claimName: Invalid value"},
+		},
+		{
+			name: "network",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Network.ServiceCIDRs = []string{"10.0.0.0/8", "10.96.0.0/12"}
+				tenant.Spec.Network.PodCIDRs = []string{"10.244.0.0/16", "fd00::/48", "fd01::/48"}
+			},
+			want: []string{
+				"spec.network.serviceCIDRs[0]: Invalid value",
+				"spec.network.serviceCIDRs: Invalid value",
+				"spec.network.podCIDRs: Too many",
+				"spec.network.podCIDRs: Invalid value",
+			},
+		},
+		{
+			name: "network changed once allocated",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Network.ServiceCIDRs = []string{"10.100.0.0/16"}
+				tenant.Status.Network = &v1alpha1.NetworkStatus{
+					ServiceCIDRs: []string{"10.96.0.0/16"},
+					PodCIDRs:     []string{"10.244.0.0/16"},
+				}
+			},
+			want: []string{"spec.network.serviceCIDRs: Forbidden"},
+		},
+		{
+			name: "node mask size",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Network.PodCIDRs = []string{"10.244.0.0/24"}
+			},
+			want: []string{"spec.network.nodeCIDRMaskSizeIPv4: Invalid value"},
+		},
+		{
+			name: "etcd mode changed",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+				tenant.Status.EtcdMode = v1alpha1.EtcdModeShared
+			},
+			want: []string{"spec.etcd.mode: Forbidden"},
+		},
+		{
+			name: "dedicated etcd even replicas",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+				tenant.Spec.Etcd.Dedicated = &v1alpha1.DedicatedEtcdSpec{Replicas: pointer.Int32(2)}
+			},
+			want: []string{"spec.etcd.dedicated.replicas: Invalid value"},
+		},
+		{
+			name: "dedicated etcd unchanged",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+				tenant.Spec.Etcd.Dedicated = &v1alpha1.DedicatedEtcdSpec{Replicas: pointer.Int32(3)}
+				tenant.Status.DedicatedEtcd = &v1alpha1.DedicatedEtcdStatus{Replicas: 3, Storage: defaultEtcdStorage}
+			},
+		},
+		{
+			name: "dedicated etcd resized",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+				tenant.Spec.Etcd.Dedicated = &v1alpha1.DedicatedEtcdSpec{Replicas: pointer.Int32(5), Storage: &storage}
+				tenant.Status.DedicatedEtcd = &v1alpha1.DedicatedEtcdStatus{Replicas: 3, Storage: defaultEtcdStorage}
+			},
+			want: []string{
+				"spec.etcd.dedicated.replicas: Forbidden",
+				"spec.etcd.dedicated.storage: Forbidden",
+			},
+		},
+		{
+			name: "placement in dedicated mode",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Etcd.Mode = v1alpha1.EtcdModeDedicated
+				tenant.Spec.Etcd.Placement = &v1alpha1.EtcdPlacement{Backend: "a"}
+			},
+			want: []string{
+				"spec.etcd.placement: Forbidden",
+				"spec.etcd.placement.backend: Forbidden",
+			},
+		},
+		{
+			name: "placement reference without backend",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Etcd.Placement = &v1alpha1.EtcdPlacement{
+					Policy:   v1alpha1.EtcdPlacementPolicyReference,
+					Selector: &metav1.LabelSelector{},
+				}
+			},
+			want: []string{
+				"spec.etcd.placement.backend: Required value",
+				"spec.etcd.placement.selector: Forbidden",
+			},
+		},
+		{
+			name: "placement reference moved once provisioned",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Etcd.Placement = &v1alpha1.EtcdPlacement{
+					Policy:  v1alpha1.EtcdPlacementPolicyReference,
+					Backend: "b",
+				}
+				tenant.Status.EtcdBackend = "a"
+				conditions.MarkTrue(tenant, v1alpha1.TenantConditionProvisioned, "Success", "Success to provision")
+			},
+			want: []string{"spec.etcd.placement.backend: Forbidden"},
+		},
+		{
+			name: "placement selector without selector",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Etcd.Placement = &v1alpha1.EtcdPlacement{Policy: v1alpha1.EtcdPlacementPolicySelector}
+			},
+			want: []string{"spec.etcd.placement.selector: Required value"},
+		},
+		{
+			name: "expose",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Expose = &v1alpha1.ExposeSpec{
+					Type:        v1alpha1.ExposeTypeIngress,
+					NodePort:    30443,
+					Annotations: map[string]string{managedAnnotationsAnnotation: ""},
+				}
+			},
+			want: []string{
+				"spec.expose.host: Required value",
+				"spec.expose.nodePort: Forbidden",
+				"spec.expose.annotations[tenancy.kcp.io/managed-annotations]: Forbidden",
+			},
+		},
+		{
+			name: "expose load balancer",
+			tenant: func(tenant *v1alpha1.Tenant) {
+				tenant.Spec.Expose = &v1alpha1.ExposeSpec{Type: v1alpha1.ExposeTypeLoadBalancer}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenant := &v1alpha1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}}
+			test.tenant(tenant)
+			assert.Equal(t, test.want, errorFields(validateTenant(tenant)))
+		})
+	}
+}
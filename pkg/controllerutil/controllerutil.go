@@ -84,6 +84,42 @@ func PatchIfExists(ctx context.Context, c client.Client, obj client.Object, f co
 		return controllerutil.OperationResultNone, err
 	}
 
+	return patch(ctx, c, obj, key, f)
+}
+
+// CreateOrPatch creates the given object in the Kubernetes cluster if not exists, otherwise patches it.
+// The object's desired state must be reconciled with the existing state inside the passed in callback MutateFn.
+func CreateOrPatch(ctx context.Context, c client.Client, obj client.Object, f controllerutil.MutateFn) (controllerutil.OperationResult, error) {
+	key := client.ObjectKeyFromObject(obj)
+	if err := c.Get(ctx, key, obj); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return controllerutil.OperationResultNone, err
+		}
+		if err := mutate(f, key, obj); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+		if err := c.Create(ctx, obj); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+		return controllerutil.OperationResultCreated, nil
+	}
+
+	return patch(ctx, c, obj, key, f)
+}
+
+// DeleteIfExists deletes the given object in the Kubernetes cluster if exists.
+func DeleteIfExists(ctx context.Context, c client.Client, obj client.Object) (bool, error) {
+	if err := c.Delete(ctx, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// patch mutates the given existing object and patches the object and its status if changed.
+func patch(ctx context.Context, c client.Client, obj client.Object, key client.ObjectKey, f controllerutil.MutateFn) (controllerutil.OperationResult, error) {
 	// Create patches for the object and its possible status.
 	objPatch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
 	statusPatch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
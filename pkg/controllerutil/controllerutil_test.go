@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestCreateOrPatch(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+	desired := map[string]string{"key": "value"}
+	newConfigMap := func() *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "test",
+			},
+		}
+	}
+
+	t.Log("----- create if not exists")
+	cm := newConfigMap()
+	result, err := CreateOrPatch(ctx, c, cm, func() error {
+		cm.Data = desired
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultCreated, result)
+
+	t.Log("----- no patch if not changed")
+	cm = newConfigMap()
+	result, err = CreateOrPatch(ctx, c, cm, func() error {
+		cm.Data = desired
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultNone, result)
+
+	t.Log("----- patch drift")
+	cm = newConfigMap()
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(cm), cm))
+	cm.Data["key"] = "drift"
+	assert.NoError(t, c.Update(ctx, cm))
+
+	cm = newConfigMap()
+	result, err = CreateOrPatch(ctx, c, cm, func() error {
+		cm.Data = desired
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, controllerutil.OperationResultUpdated, result)
+
+	cm = newConfigMap()
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(cm), cm))
+	assert.Equal(t, desired, cm.Data)
+
+	t.Log("----- name is immutable")
+	cm = newConfigMap()
+	_, err = CreateOrPatch(ctx, c, cm, func() error {
+		cm.Name = "other"
+		return nil
+	})
+	assert.Error(t, err)
+}
+
+func TestDeleteIfExists(t *testing.T) {
+	ctx := context.Background()
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test",
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cm.DeepCopy()).Build()
+
+	deleted, err := DeleteIfExists(ctx, c, cm.DeepCopy())
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	deleted, err = DeleteIfExists(ctx, c, cm.DeepCopy())
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerutil
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// DeploymentSpecChanged returns whether the fields of the Deployment spec set by the controller
+// differ between desired and current, see PodTemplateChanged.
+func DeploymentSpecChanged(desired, current appsv1.DeploymentSpec) bool {
+	return !equality.Semantic.DeepEqual(desired.Replicas, current.Replicas) ||
+		!equality.Semantic.DeepEqual(desired.Strategy, current.Strategy) ||
+		!equality.Semantic.DeepEqual(desired.Selector, current.Selector) ||
+		PodTemplateChanged(desired.Template, current.Template)
+}
+
+// PodTemplateChanged returns whether the fields of the pod template set by the controller differ
+// between desired and current. The slices and maps are compared whole, so entries removed from
+// desired or added to current are a change. The fields the apiserver defaults are defaulted in
+// desired first, the fields the controller never sets are ignored, as are the annotations not in
+// desired, e.g. the restart annotation of kubectl.
+func PodTemplateChanged(desired, current corev1.PodTemplateSpec) bool {
+	if !equality.Semantic.DeepEqual(desired.Labels, current.Labels) {
+		return true
+	}
+	for key, value := range desired.Annotations {
+		if current.Annotations[key] != value {
+			return true
+		}
+	}
+
+	desiredSpec := desired.Spec.DeepCopy()
+	setPodSpecDefaults(desiredSpec)
+	return !equality.Semantic.DeepEqual(ownedPodSpec(desiredSpec), ownedPodSpec(&current.Spec))
+}
+
+// ownedPodSpec returns the fields of spec set by the controller.
+func ownedPodSpec(spec *corev1.PodSpec) corev1.PodSpec {
+	containers := make([]corev1.Container, 0, len(spec.Containers))
+	for _, container := range spec.Containers {
+		containers = append(containers, corev1.Container{
+			Name:            container.Name,
+			Image:           container.Image,
+			ImagePullPolicy: container.ImagePullPolicy,
+			Command:         container.Command,
+			Args:            container.Args,
+			Env:             container.Env,
+			Ports:           container.Ports,
+			Resources:       container.Resources,
+			VolumeMounts:    container.VolumeMounts,
+			LivenessProbe:   container.LivenessProbe,
+			ReadinessProbe:  container.ReadinessProbe,
+			StartupProbe:    container.StartupProbe,
+		})
+	}
+	return corev1.PodSpec{
+		Containers:                containers,
+		Volumes:                   spec.Volumes,
+		NodeSelector:              spec.NodeSelector,
+		Tolerations:               spec.Tolerations,
+		Affinity:                  spec.Affinity,
+		PriorityClassName:         spec.PriorityClassName,
+		TopologySpreadConstraints: spec.TopologySpreadConstraints,
+	}
+}
+
+// setPodSpecDefaults sets the defaults the apiserver sets for the fields of ownedPodSpec.
+func setPodSpecDefaults(spec *corev1.PodSpec) {
+	for i := range spec.Volumes {
+		source := &spec.Volumes[i].VolumeSource
+		switch {
+		case source.Secret != nil && source.Secret.DefaultMode == nil:
+			source.Secret.DefaultMode = defaultMode()
+		case source.ConfigMap != nil && source.ConfigMap.DefaultMode == nil:
+			source.ConfigMap.DefaultMode = defaultMode()
+		case source.Projected != nil && source.Projected.DefaultMode == nil:
+			source.Projected.DefaultMode = defaultMode()
+		}
+	}
+	for i := range spec.Containers {
+		container := &spec.Containers[i]
+		for j := range container.Env {
+			if ref := container.Env[j].ValueFrom; ref != nil && ref.FieldRef != nil && ref.FieldRef.APIVersion == "" {
+				ref.FieldRef.APIVersion = "v1"
+			}
+		}
+		for j := range container.Ports {
+			if container.Ports[j].Protocol == "" {
+				container.Ports[j].Protocol = corev1.ProtocolTCP
+			}
+		}
+		for _, probe := range []*corev1.Probe{container.LivenessProbe, container.ReadinessProbe, container.StartupProbe} {
+			if probe == nil {
+				continue
+			}
+			if probe.TimeoutSeconds == 0 {
+				probe.TimeoutSeconds = 1
+			}
+			if probe.PeriodSeconds == 0 {
+				probe.PeriodSeconds = 10
+			}
+			if probe.SuccessThreshold == 0 {
+				probe.SuccessThreshold = 1
+			}
+			if probe.FailureThreshold == 0 {
+				probe.FailureThreshold = 3
+			}
+			if probe.HTTPGet != nil && probe.HTTPGet.Path == "" {
+				probe.HTTPGet.Path = "/"
+			}
+			if probe.HTTPGet != nil && probe.HTTPGet.Scheme == "" {
+				probe.HTTPGet.Scheme = corev1.URISchemeHTTP
+			}
+		}
+	}
+}
+
+func defaultMode() *int32 {
+	mode := corev1.SecretVolumeSourceDefaultMode
+	return &mode
+}
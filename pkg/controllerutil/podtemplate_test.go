@@ -0,0 +1,193 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func desiredPodTemplate() corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      map[string]string{"app": "kube-apiserver"},
+			Annotations: map[string]string{"hash": "1"},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{"role": "control-plane"},
+			Tolerations: []corev1.Toleration{
+				{Key: "control-plane", Operator: corev1.TolerationOpExists},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    "apiserver",
+					Image:   "kube-apiserver:v1.23.6",
+					Command: []string{"kube-apiserver", "--secure-port=6443"},
+					Env: []corev1.EnvVar{
+						{
+							Name: "POD_NAME",
+							ValueFrom: &corev1.EnvVarSource{
+								FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+							},
+						},
+					},
+					LivenessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							HTTPGet: &corev1.HTTPGetAction{Path: "/livez"},
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "kubeconfig",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{SecretName: "kubeconfig"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// defaultedPodTemplate returns the desired pod template as stored by the apiserver.
+func defaultedPodTemplate() corev1.PodTemplateSpec {
+	template := desiredPodTemplate()
+	template.Annotations["kubectl.kubernetes.io/restartedAt"] = "2022-01-01T00:00:00Z"
+	spec := &template.Spec
+	spec.RestartPolicy = corev1.RestartPolicyAlways
+	spec.DNSPolicy = corev1.DNSClusterFirst
+	spec.TerminationGracePeriodSeconds = pointer.Int64(30)
+	spec.Volumes[0].Secret.DefaultMode = pointer.Int32(corev1.SecretVolumeSourceDefaultMode)
+	container := &spec.Containers[0]
+	container.TerminationMessagePath = corev1.TerminationMessagePathDefault
+	container.Env[0].ValueFrom.FieldRef.APIVersion = "v1"
+	container.LivenessProbe.HTTPGet.Scheme = corev1.URISchemeHTTP
+	container.LivenessProbe.TimeoutSeconds = 1
+	container.LivenessProbe.PeriodSeconds = 10
+	container.LivenessProbe.SuccessThreshold = 1
+	container.LivenessProbe.FailureThreshold = 3
+	return template
+}
+
+func TestPodTemplateChanged(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired func(*corev1.PodTemplateSpec)
+		current func(*corev1.PodTemplateSpec)
+		want    bool
+	}{
+		{name: "defaulted by the apiserver"},
+		{
+			name: "arg removed from desired",
+			desired: func(template *corev1.PodTemplateSpec) {
+				template.Spec.Containers[0].Command = template.Spec.Containers[0].Command[:1]
+			},
+			want: true,
+		},
+		{
+			name: "arg appended to current",
+			current: func(template *corev1.PodTemplateSpec) {
+				template.Spec.Containers[0].Command = append(template.Spec.Containers[0].Command, "--v=4")
+			},
+			want: true,
+		},
+		{
+			name: "env removed from desired",
+			desired: func(template *corev1.PodTemplateSpec) {
+				template.Spec.Containers[0].Env = nil
+			},
+			want: true,
+		},
+		{
+			name: "volume removed from desired",
+			desired: func(template *corev1.PodTemplateSpec) {
+				template.Spec.Volumes = nil
+			},
+			want: true,
+		},
+		{
+			name: "node selector removed from desired",
+			desired: func(template *corev1.PodTemplateSpec) {
+				template.Spec.NodeSelector = nil
+			},
+			want: true,
+		},
+		{
+			name: "toleration removed from desired",
+			desired: func(template *corev1.PodTemplateSpec) {
+				template.Spec.Tolerations = nil
+			},
+			want: true,
+		},
+		{
+			name: "affinity set in current",
+			current: func(template *corev1.PodTemplateSpec) {
+				template.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{}}
+			},
+			want: true,
+		},
+		{
+			name: "container appended to current",
+			current: func(template *corev1.PodTemplateSpec) {
+				template.Spec.Containers = append(template.Spec.Containers, corev1.Container{Name: "debug"})
+			},
+			want: true,
+		},
+		{
+			name: "annotation changed",
+			desired: func(template *corev1.PodTemplateSpec) {
+				template.Annotations["hash"] = "2"
+			},
+			want: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			desired, current := desiredPodTemplate(), defaultedPodTemplate()
+			if test.desired != nil {
+				test.desired(&desired)
+			}
+			if test.current != nil {
+				test.current(&current)
+			}
+			assert.Equal(t, test.want, PodTemplateChanged(desired, current))
+		})
+	}
+}
+
+func TestDeploymentSpecChanged(t *testing.T) {
+	desired := appsv1.DeploymentSpec{
+		Replicas: pointer.Int32(3),
+		Template: desiredPodTemplate(),
+	}
+	current := appsv1.DeploymentSpec{
+		Replicas:             pointer.Int32(3),
+		RevisionHistoryLimit: pointer.Int32(10),
+		Template:             defaultedPodTemplate(),
+	}
+	assert.False(t, DeploymentSpecChanged(desired, current))
+
+	current.Replicas = pointer.Int32(1)
+	assert.True(t, DeploymentSpecChanged(desired, current))
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// CACertKey is the key of the etcd ca certificate in the etcd secret.
+	CACertKey = "etcd-ca.crt"
+	// ClientCertKey is the key of the etcd client certificate in the etcd secret.
+	ClientCertKey = "apiserver-etcd-client.crt"
+	// ClientKeyKey is the key of the etcd client key in the etcd secret.
+	ClientKeyKey = "apiserver-etcd-client.key"
+
+	dialTimeout = 5 * time.Second
+)
+
+// NewClient creates a client for the comma separated etcd servers, authenticated
+// with the client certificate in the etcd secret data.
+func NewClient(servers string, data map[string][]byte) (*clientv3.Client, error) {
+	tlsConfig, err := TLSConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(servers, ","),
+		DialTimeout: dialTimeout,
+		TLS:         tlsConfig,
+	})
+}
+
+// TLSConfig builds the tls config trusting the etcd ca and presenting the client
+// certificate in the etcd secret data.
+func TLSConfig(data map[string][]byte) (*tls.Config, error) {
+	caCert, ok := data[CACertKey]
+	if !ok {
+		return nil, fmt.Errorf("empty %s", CACertKey)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificate found in %s", CACertKey)
+	}
+
+	cert, err := tls.X509KeyPair(data[ClientCertKey], data[ClientKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s or %s: %v", ClientCertKey, ClientKeyKey, err)
+	}
+
+	return &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// DeletePrefix deletes all the keys under the prefix and returns the number of deleted keys.
+func DeletePrefix(ctx context.Context, c *clientv3.Client, prefix string) (int64, error) {
+	if prefix == "" || prefix == "/" {
+		return 0, errors.New("refuse to delete the whole keyspace")
+	}
+
+	resp, err := c.Delete(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Deleted, nil
+}
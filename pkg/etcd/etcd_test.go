@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
+)
+
+func TestTLSConfig(t *testing.T) {
+	caCert, caKey, err := secret.NewCA(&certutil.Config{CommonName: "etcd-ca"}, secret.KeyConfig{})
+	assert.NoError(t, err)
+	cert, key, err := secret.NewCertAndKey(caCert, caKey, &certutil.Config{
+		CommonName: "kube-apiserver-etcd-client",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, secret.KeyConfig{}, 0)
+	assert.NoError(t, err)
+	encodedKey, err := secret.EncodePrivateKeyPEM(key)
+	assert.NoError(t, err)
+	_, otherKey, err := secret.NewPubAndKey(secret.KeyConfig{})
+	assert.NoError(t, err)
+	encodedOtherKey, err := secret.EncodePrivateKeyPEM(otherKey)
+	assert.NoError(t, err)
+
+	valid := map[string][]byte{
+		CACertKey:     secret.EncodeCertPEM(caCert),
+		ClientCertKey: secret.EncodeCertPEM(cert),
+		ClientKeyKey:  encodedKey,
+	}
+	withData := func(key string, value []byte) map[string][]byte {
+		data := map[string][]byte{}
+		for k, v := range valid {
+			data[k] = v
+		}
+		if value == nil {
+			delete(data, key)
+		} else {
+			data[key] = value
+		}
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		data    map[string][]byte
+		wantErr bool
+	}{
+		{name: "valid", data: valid},
+		{name: "missing ca", data: withData(CACertKey, nil), wantErr: true},
+		{name: "invalid ca", data: withData(CACertKey, []byte("invalid")), wantErr: true},
+		{name: "missing client cert", data: withData(ClientCertKey, nil), wantErr: true},
+		{name: "mismatched client key", data: withData(ClientKeyKey, encodedOtherKey), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := TLSConfig(test.data)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, config.Certificates, 1)
+			assert.NotNil(t, config.RootCAs)
+		})
+	}
+}
+
+func TestDeletePrefixRefusesWholeKeyspace(t *testing.T) {
+	for _, prefix := range []string{"", "/"} {
+		_, err := DeletePrefix(context.Background(), nil, prefix)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ipam allocates the ip ranges of the tenant clusters from the pools of the platform.
+package ipam
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+)
+
+// ErrPoolExhausted is returned when no range of the requested size is free in the pool.
+var ErrPoolExhausted = errors.New("no free range left in the pool")
+
+// Overlaps returns whether the ranges a and b share any ip.
+func Overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// Allocate returns the first range of the pool with the prefix length maskSize that overlaps
+// none of the used ranges.
+func Allocate(pool *net.IPNet, maskSize int, used []*net.IPNet) (*net.IPNet, error) {
+	ones, bits := pool.Mask.Size()
+	if maskSize < ones || maskSize > bits {
+		return nil, fmt.Errorf("mask size %d must be between %d and %d", maskSize, ones, bits)
+	}
+
+	base := ipToInt(pool.IP.Mask(pool.Mask), bits)
+	step := new(big.Int).Lsh(big.NewInt(1), uint(bits-maskSize))
+	end := new(big.Int).Add(base, new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)))
+	for candidate := base; candidate.Cmp(end) < 0; {
+		subnet := &net.IPNet{IP: intToIP(candidate, bits), Mask: net.CIDRMask(maskSize, bits)}
+		var overlapping *net.IPNet
+		for _, u := range used {
+			if _, uBits := u.Mask.Size(); uBits == bits && Overlaps(subnet, u) {
+				overlapping = u
+				break
+			}
+		}
+		if overlapping == nil {
+			return subnet, nil
+		}
+
+		// continue with the first candidate past the overlapping range
+		last := lastIP(overlapping, bits)
+		offset := new(big.Int).Sub(last, base)
+		offset.Div(offset, step).Add(offset, big.NewInt(1)).Mul(offset, step)
+		candidate = new(big.Int).Add(base, offset)
+	}
+	return nil, ErrPoolExhausted
+}
+
+func ipToInt(ip net.IP, bits int) *big.Int {
+	if bits == 8*net.IPv4len {
+		ip = ip.To4()
+	} else {
+		ip = ip.To16()
+	}
+	return new(big.Int).SetBytes(ip)
+}
+
+func intToIP(i *big.Int, bits int) net.IP {
+	ip := make(net.IP, bits/8)
+	return i.FillBytes(ip)
+}
+
+// lastIP returns the last ip of the range cidr as an integer.
+func lastIP(cidr *net.IPNet, bits int) *big.Int {
+	ones, _ := cidr.Mask.Size()
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	first := ipToInt(cidr.IP.Mask(cidr.Mask), bits)
+	return first.Add(first, size).Sub(first, big.NewInt(1))
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParseCIDR(t *testing.T, s string) *net.IPNet {
+	_, cidr, err := net.ParseCIDR(s)
+	assert.NoError(t, err)
+	return cidr
+}
+
+func TestOverlaps(t *testing.T) {
+	assert.True(t, Overlaps(mustParseCIDR(t, "10.0.0.0/8"), mustParseCIDR(t, "10.1.0.0/16")))
+	assert.True(t, Overlaps(mustParseCIDR(t, "10.1.0.0/16"), mustParseCIDR(t, "10.0.0.0/8")))
+	assert.False(t, Overlaps(mustParseCIDR(t, "10.1.0.0/16"), mustParseCIDR(t, "10.2.0.0/16")))
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name     string
+		pool     string
+		maskSize int
+		used     []string
+		want     string
+		wantErr  error
+	}{
+		{name: "empty pool", pool: "10.0.0.0/8", maskSize: 16, want: "10.0.0.0/16"},
+		{name: "skip used", pool: "10.0.0.0/8", maskSize: 16, used: []string{"10.0.0.0/16", "10.1.0.0/16"}, want: "10.2.0.0/16"},
+		{name: "skip smaller used", pool: "10.0.0.0/8", maskSize: 16, used: []string{"10.0.5.0/24"}, want: "10.1.0.0/16"},
+		{name: "skip larger used", pool: "10.0.0.0/8", maskSize: 16, used: []string{"10.0.0.0/12"}, want: "10.16.0.0/16"},
+		{name: "ignore other family", pool: "10.0.0.0/8", maskSize: 16, used: []string{"fd00::/8"}, want: "10.0.0.0/16"},
+		{name: "ipv6", pool: "fd00::/48", maskSize: 64, used: []string{"fd00::/64"}, want: "fd00:0:0:1::/64"},
+		{name: "exhausted", pool: "10.0.0.0/15", maskSize: 16, used: []string{"10.0.0.0/16", "10.1.0.0/16"}, wantErr: ErrPoolExhausted},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var used []*net.IPNet
+			for _, u := range test.used {
+				used = append(used, mustParseCIDR(t, u))
+			}
+			got, err := Allocate(mustParseCIDR(t, test.pool), test.maskSize, used)
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.want, got.String())
+			}
+		})
+	}
+
+	_, err := Allocate(mustParseCIDR(t, "10.0.0.0/16"), 8, nil)
+	assert.Error(t, err)
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package kubeconfig
 
 import (
-	"crypto"
 	"crypto/x509"
 	"fmt"
 
@@ -27,21 +26,18 @@ import (
 	"github.com/k8s-cloud-platform/multi-tenants/pkg/secret"
 )
 
-// NewWithSecret creates a new kubeconfig using the cluster name and specified endpoint.
-func NewWithSecret(clusterName, endpoint string, caCert *x509.Certificate, caKey crypto.Signer, config *certutil.Config) (*api.Config, error) {
-	cert, key, err := secret.NewCertAndKey(caCert, caKey, config)
-	if err != nil {
-		return nil, err
-	}
-
-	userName := fmt.Sprintf("%s-%s", clusterName, config.CommonName)
+// NewWithCertificate creates a new kubeconfig using the cluster name and specified endpoint, trusting
+// the PEM-encoded cas and authenticated with the PEM-encoded client certificate and key issued for
+// the common name.
+func NewWithCertificate(clusterName, endpoint, commonName string, caData, certData, keyData []byte) *api.Config {
+	userName := fmt.Sprintf("%s-%s", clusterName, commonName)
 	contextName := fmt.Sprintf("%s@%s", userName, clusterName)
 
 	return &api.Config{
 		Clusters: map[string]*api.Cluster{
 			clusterName: {
 				Server:                   endpoint,
-				CertificateAuthorityData: secret.EncodeCertPEM(caCert),
+				CertificateAuthorityData: caData,
 			},
 		},
 		Contexts: map[string]*api.Context{
@@ -52,12 +48,12 @@ func NewWithSecret(clusterName, endpoint string, caCert *x509.Certificate, caKey
 		},
 		AuthInfos: map[string]*api.AuthInfo{
 			userName: {
-				ClientKeyData:         secret.EncodePrivateKeyPEM(key),
-				ClientCertificateData: secret.EncodeCertPEM(cert),
+				ClientKeyData:         keyData,
+				ClientCertificateData: certData,
 			},
 		},
 		CurrentContext: contextName,
-	}, nil
+	}
 }
 
 // NewWithToken creates a new kubeconfig using the cluster name and specified endpoint.
@@ -86,3 +82,52 @@ func NewWithToken(clusterName, endpoint string, caCert *x509.Certificate, token
 		CurrentContext: contextName,
 	}, nil
 }
+
+// NewWithExec creates a new kubeconfig using the cluster name and specified endpoint, trusting the
+// PEM-encoded cas and authenticated with the credentials the exec plugin returns for the user.
+func NewWithExec(clusterName, endpoint, userName string, caData []byte, exec *api.ExecConfig) *api.Config {
+	authName := fmt.Sprintf("%s-%s", clusterName, userName)
+	contextName := fmt.Sprintf("%s@%s", authName, clusterName)
+	return &api.Config{
+		Clusters: map[string]*api.Cluster{
+			clusterName: {
+				Server:                   endpoint,
+				CertificateAuthorityData: caData,
+			},
+		},
+		Contexts: map[string]*api.Context{
+			contextName: {
+				Cluster:  clusterName,
+				AuthInfo: authName,
+			},
+		},
+		AuthInfos: map[string]*api.AuthInfo{
+			authName: {
+				Exec: exec,
+			},
+		},
+		CurrentContext: contextName,
+	}
+}
+
+// NewWithOIDC creates a new kubeconfig using the cluster name and specified endpoint, trusting the
+// PEM-encoded cas and authenticated with the ID tokens of the OpenID Connect provider at issuerURL
+// issued for clientID. The tokens are fetched by the kubelogin plugin, kubectl oidc-login,
+// requesting the extra scopes besides openid.
+func NewWithOIDC(clusterName, endpoint string, caData []byte, issuerURL, clientID string, extraScopes []string) *api.Config {
+	args := []string{
+		"oidc-login",
+		"get-token",
+		"--oidc-issuer-url=" + issuerURL,
+		"--oidc-client-id=" + clientID,
+	}
+	for _, scope := range extraScopes {
+		args = append(args, "--oidc-extra-scope="+scope)
+	}
+	return NewWithExec(clusterName, endpoint, "oidc", caData, &api.ExecConfig{
+		APIVersion:      "client.authentication.k8s.io/v1beta1",
+		Command:         "kubectl",
+		Args:            args,
+		InteractiveMode: api.IfAvailableExecInteractiveMode,
+	})
+}
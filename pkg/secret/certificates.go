@@ -20,23 +20,34 @@ import (
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"errors"
 	"fmt"
 	"math/big"
 	"time"
 
+	"k8s.io/apimachinery/pkg/util/sets"
 	certutil "k8s.io/client-go/util/cert"
 )
 
-// NewCA creates new certificate and private key for the certificate authority.
-func NewCA(config *certutil.Config) (*x509.Certificate, *rsa.PrivateKey, error) {
+const (
+	// DefaultCAValidity is how long a certificate authority is valid.
+	DefaultCAValidity = time.Hour * 24 * 365 * 10
+	// DefaultCertValidity is how long a certificate is valid if not specified.
+	DefaultCertValidity = time.Hour * 24 * 365
+)
+
+// NewCA creates new certificate and private key for the certificate authority, the key is
+// generated as selected by keyConfig.
+func NewCA(config *certutil.Config, keyConfig KeyConfig) (*x509.Certificate, crypto.Signer, error) {
 	if config == nil {
 		config = &certutil.Config{}
 	}
 
-	key, err := NewPrivateKey()
+	key, err := NewPrivateKey(keyConfig)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -49,14 +60,16 @@ func NewCA(config *certutil.Config) (*x509.Certificate, *rsa.PrivateKey, error)
 	return c, key, nil
 }
 
-// NewCertAndKey creates new certificate and key by passing the certificate authority certificate and key
-func NewCertAndKey(caCert *x509.Certificate, caKey crypto.Signer, config *certutil.Config) (*x509.Certificate, *rsa.PrivateKey, error) {
-	key, err := NewPrivateKey()
+// NewCertAndKey creates new certificate and key by passing the certificate authority certificate and key,
+// the key is generated as selected by keyConfig. The certificate is valid for validity, DefaultCertValidity
+// if zero, but never outlives the certificate authority.
+func NewCertAndKey(caCert *x509.Certificate, caKey crypto.Signer, config *certutil.Config, keyConfig KeyConfig, validity time.Duration) (*x509.Certificate, crypto.Signer, error) {
+	key, err := NewPrivateKey(keyConfig)
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to create private key %v", err)
 	}
 
-	cert, err := newSignedCert(config, key, caCert, caKey)
+	cert, err := newSignedCert(config, key, caCert, caKey, validity)
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to sign certificate. %v", err)
 	}
@@ -64,37 +77,89 @@ func NewCertAndKey(caCert *x509.Certificate, caKey crypto.Signer, config *certut
 	return cert, key, nil
 }
 
-func NewPubAndKey() (*rsa.PublicKey, *rsa.PrivateKey, error) {
-	key, err := NewPrivateKey()
+// NewPubAndKey creates a key pair as selected by keyConfig, e.g. to sign service account tokens.
+func NewPubAndKey(keyConfig KeyConfig) (crypto.PublicKey, crypto.Signer, error) {
+	key, err := NewPrivateKey(keyConfig)
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to create private key %v", err)
 	}
 
-	pub, ok := key.Public().(*rsa.PublicKey)
-	if !ok {
-		return nil, nil, errors.New("unable to convert key public to *rsa.PublicKey")
+	return key.Public(), key, nil
+}
+
+// ValidateCA checks that the certificate is a certificate authority allowed to sign certificates,
+// valid now, and that the key belongs to it. It accepts intermediate certificate authorities.
+func ValidateCA(caCert *x509.Certificate, caKey crypto.Signer) error {
+	if !caCert.BasicConstraintsValid || !caCert.IsCA {
+		return errors.New("certificate is not a certificate authority")
+	}
+	if caCert.KeyUsage != 0 && caCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return errors.New("certificate authority is not allowed to sign certificates")
+	}
+	now := time.Now()
+	if now.Before(caCert.NotBefore) || now.After(caCert.NotAfter) {
+		return fmt.Errorf("certificate authority is only valid from %s to %s", caCert.NotBefore, caCert.NotAfter)
+	}
+	pub, ok := caCert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(caKey.Public()) {
+		return errors.New("key does not match the certificate authority")
+	}
+	return nil
+}
+
+// HasAltNames returns true if the certificate carries exactly the given subject alternative
+// names, regardless of their order.
+func HasAltNames(cert *x509.Certificate, altNames certutil.AltNames) bool {
+	dnsNames := sets.NewString(altNames.DNSNames...)
+	if !dnsNames.Equal(sets.NewString(cert.DNSNames...)) {
+		return false
 	}
 
-	return pub, key, nil
+	ips := sets.NewString()
+	for _, ip := range altNames.IPs {
+		ips.Insert(ip.String())
+	}
+	certIPs := sets.NewString()
+	for _, ip := range cert.IPAddresses {
+		certIPs.Insert(ip.String())
+	}
+	return ips.Equal(certIPs)
 }
 
-// newSelfSignedCACert creates a CA certificate.
+// newSelfSignedCACert creates a CA certificate with the subject of the config, the common name
+// defaults to ca and the organization to kcp.
 func newSelfSignedCACert(config *certutil.Config, key crypto.Signer) (*x509.Certificate, error) {
-	config.CommonName = "ca"
-	config.Organization = []string{"kcp"}
+	subject := pkix.Name{
+		CommonName:   config.CommonName,
+		Organization: config.Organization,
+	}
+	if subject.CommonName == "" {
+		subject.CommonName = "ca"
+	}
+	if len(subject.Organization) == 0 {
+		subject.Organization = []string{"kcp"}
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := subjectKeyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
 
 	now := time.Now().UTC()
 
 	tmpl := x509.Certificate{
-		SerialNumber: new(big.Int).SetInt64(0),
-		Subject: pkix.Name{
-			CommonName:   config.CommonName,
-			Organization: config.Organization,
-		},
+		SerialNumber:          serial,
+		Subject:               subject,
+		SubjectKeyId:          keyID,
+		AuthorityKeyId:        keyID,
 		DNSNames:              config.AltNames.DNSNames,
 		NotBefore:             now.Add(time.Minute * -5),
-		NotAfter:              now.Add(time.Hour * 24 * 365 * 10), // 10 years
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		NotAfter:              now.Add(DefaultCAValidity),
+		KeyUsage:              keyUsage(key) | x509.KeyUsageCertSign,
 		MaxPathLenZero:        true,
 		BasicConstraintsValid: true,
 		MaxPathLen:            0,
@@ -110,20 +175,38 @@ func newSelfSignedCACert(config *certutil.Config, key crypto.Signer) (*x509.Cert
 }
 
 // newSignedCert creates a signed certificate using the given CA certificate and key
-func newSignedCert(config *certutil.Config, key crypto.Signer, caCert *x509.Certificate, caKey crypto.Signer) (*x509.Certificate, error) {
+func newSignedCert(config *certutil.Config, key crypto.Signer, caCert *x509.Certificate, caKey crypto.Signer, validity time.Duration) (*x509.Certificate, error) {
 	now := time.Now().UTC()
+	if validity <= 0 {
+		validity = DefaultCertValidity
+	}
+	notAfter := now.Add(validity)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := subjectKeyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
 
 	certTmpl := x509.Certificate{
-		SerialNumber: new(big.Int).SetInt64(0),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			CommonName:   config.CommonName,
 			Organization: config.Organization,
 		},
+		SubjectKeyId:          keyID,
+		AuthorityKeyId:        caCert.SubjectKeyId,
 		DNSNames:              config.AltNames.DNSNames,
 		IPAddresses:           config.AltNames.IPs,
 		NotBefore:             now.Add(time.Minute * -5),
-		NotAfter:              now.Add(time.Hour * 24 * 365 * 10), // 10 years
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		NotAfter:              notAfter,
+		KeyUsage:              keyUsage(key),
 		ExtKeyUsage:           config.Usages,
 		BasicConstraintsValid: true,
 		MaxPathLen:            0,
@@ -136,3 +219,40 @@ func newSignedCert(config *certutil.Config, key crypto.Signer, caCert *x509.Cert
 
 	return x509.ParseCertificate(certDERBytes)
 }
+
+// keyUsage returns the key usage of a certificate for the key, key encipherment only applies
+// to RSA keys.
+func keyUsage(key crypto.Signer) x509.KeyUsage {
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		return x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+	}
+	return x509.KeyUsageDigitalSignature
+}
+
+// newSerialNumber returns a random positive serial number of up to 128 bits, so certificates
+// issued by the same certificate authority never share a serial number.
+func newSerialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate serial number: %v", err)
+	}
+	return serial.Add(serial, big.NewInt(1)), nil
+}
+
+// subjectKeyID returns the key identifier of the public key, the SHA-1 hash of its encoded
+// subjectPublicKey as described in RFC 5280 section 4.2.1.2.
+func subjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(info.SubjectPublicKey.Bytes)
+	return sum[:], nil
+}
@@ -17,10 +17,14 @@ limitations under the License.
 package secret
 
 import (
+	"crypto"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"io/ioutil"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	certutil "k8s.io/client-go/util/cert"
@@ -95,26 +99,30 @@ func TestCerts(t *testing.T) {
 		t.Logf("----- sign certs for: %s", test.name)
 
 		t.Logf("----- sign ca cert")
-		ca, key, err := NewCA(test.caConfig)
+		ca, key, err := NewCA(test.caConfig, KeyConfig{})
+		assert.NoError(t, err)
+		encodedKey, err := EncodePrivateKeyPEM(key)
 		assert.NoError(t, err)
 		t.Logf("%s", EncodeCertPEM(ca))
-		t.Logf("%s", EncodePrivateKeyPEM(key))
+		t.Logf("%s", encodedKey)
 
 		if saveFile {
 			ioutil.WriteFile(test.name+"-ca.crt", EncodeCertPEM(ca), 0644)
-			ioutil.WriteFile(test.name+"-ca.key", EncodePrivateKeyPEM(key), 0644)
+			ioutil.WriteFile(test.name+"-ca.key", encodedKey, 0644)
 		}
 
 		for _, cert := range test.certCases {
 			t.Logf("----- sign certs: %s", cert.certName)
-			pub, key, err := NewCertAndKey(ca, key, cert.certConfig)
+			pub, key, err := NewCertAndKey(ca, key, cert.certConfig, KeyConfig{}, 0)
+			assert.NoError(t, err)
+			encodedKey, err := EncodePrivateKeyPEM(key)
 			assert.NoError(t, err)
 			t.Logf("%s", EncodeCertPEM(pub))
-			t.Logf("%s", EncodePrivateKeyPEM(key))
+			t.Logf("%s", encodedKey)
 
 			if saveFile {
 				ioutil.WriteFile(cert.certName+".crt", EncodeCertPEM(pub), 0644)
-				ioutil.WriteFile(cert.certName+".key", EncodePrivateKeyPEM(key), 0644)
+				ioutil.WriteFile(cert.certName+".key", encodedKey, 0644)
 			}
 		}
 	}
@@ -123,15 +131,302 @@ func TestCerts(t *testing.T) {
 func TestPubAndKey(t *testing.T) {
 	t.Log("----- sign for sa")
 
-	pub, key, err := NewPubAndKey()
+	pub, key, err := NewPubAndKey(KeyConfig{})
 	assert.NoError(t, err)
 	encodedPub, err := EncodePublicKeyPEM(pub)
 	assert.NoError(t, err)
+	encodedKey, err := EncodePrivateKeyPEM(key)
+	assert.NoError(t, err)
 	t.Logf("%s", encodedPub)
-	t.Logf("%s", EncodePrivateKeyPEM(key))
+	t.Logf("%s", encodedKey)
 
 	if saveFile {
 		ioutil.WriteFile("sa.pub", encodedPub, 0644)
-		ioutil.WriteFile("sa.key", EncodePrivateKeyPEM(key), 0644)
+		ioutil.WriteFile("sa.key", encodedKey, 0644)
+	}
+}
+
+func TestHasAltNames(t *testing.T) {
+	caCert, caKey, err := NewCA(nil, KeyConfig{})
+	assert.NoError(t, err)
+	cert, _, err := NewCertAndKey(caCert, caKey, &certutil.Config{
+		CommonName: "kube-apiserver",
+		AltNames: certutil.AltNames{
+			DNSNames: []string{"kubernetes", "localhost"},
+			IPs:      []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("10.101.0.1")},
+		},
+		Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, KeyConfig{}, 0)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		altNames certutil.AltNames
+		want     bool
+	}{
+		{
+			name: "same names in other order",
+			altNames: certutil.AltNames{
+				DNSNames: []string{"localhost", "kubernetes"},
+				IPs:      []net.IP{net.ParseIP("10.101.0.1"), net.ParseIP("127.0.0.1")},
+			},
+			want: true,
+		},
+		{
+			name: "dns name added",
+			altNames: certutil.AltNames{
+				DNSNames: []string{"kubernetes", "localhost", "kubernetes.default"},
+				IPs:      []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("10.101.0.1")},
+			},
+		},
+		{
+			name: "ip removed",
+			altNames: certutil.AltNames{
+				DNSNames: []string{"kubernetes", "localhost"},
+				IPs:      []net.IP{net.ParseIP("127.0.0.1")},
+			},
+		},
+		{
+			name: "ip changed",
+			altNames: certutil.AltNames{
+				DNSNames: []string{"kubernetes", "localhost"},
+				IPs:      []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("10.96.0.1")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, HasAltNames(cert, test.altNames))
+		})
+	}
+}
+
+func TestCertValidity(t *testing.T) {
+	caCert, caKey, err := NewCA(nil, KeyConfig{})
+	assert.NoError(t, err)
+	config := &certutil.Config{
+		CommonName: "test",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	tests := []struct {
+		name     string
+		validity time.Duration
+		want     time.Time
+	}{
+		{name: "default", validity: 0, want: time.Now().Add(DefaultCertValidity)},
+		{name: "custom", validity: 24 * time.Hour, want: time.Now().Add(24 * time.Hour)},
+		{name: "capped by ca", validity: 2 * DefaultCAValidity, want: caCert.NotAfter},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cert, _, err := NewCertAndKey(caCert, caKey, config, KeyConfig{}, test.validity)
+			assert.NoError(t, err)
+			assert.WithinDuration(t, test.want, cert.NotAfter, time.Minute)
+			assert.False(t, cert.NotAfter.After(caCert.NotAfter))
+		})
+	}
+}
+
+func TestCertsPEM(t *testing.T) {
+	oldCA, oldKey, err := NewCA(nil, KeyConfig{})
+	assert.NoError(t, err)
+	newCA, newKey, err := NewCA(nil, KeyConfig{})
+	assert.NoError(t, err)
+	config := &certutil.Config{
+		CommonName: "test",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	oldCert, _, err := NewCertAndKey(oldCA, oldKey, config, KeyConfig{}, 0)
+	assert.NoError(t, err)
+	newCert, _, err := NewCertAndKey(newCA, newKey, config, KeyConfig{}, 0)
+	assert.NoError(t, err)
+
+	bundle, err := DecodeCertsPEM(EncodeCertsPEM(oldCA, newCA))
+	assert.NoError(t, err)
+	assert.Len(t, bundle, 2)
+
+	// certificates signed by either ca are trusted by the bundle
+	roots := x509.NewCertPool()
+	for _, ca := range bundle {
+		roots.AddCert(ca)
+	}
+	for _, cert := range []*x509.Certificate{oldCert, newCert} {
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		assert.NoError(t, err)
+	}
+
+	_, err = DecodeCertsPEM(nil)
+	assert.Error(t, err)
+}
+
+func TestCASubject(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *certutil.Config
+		want   pkix.Name
+	}{
+		{
+			name:   "defaults",
+			config: nil,
+			want:   pkix.Name{CommonName: "ca", Organization: []string{"kcp"}},
+		},
+		{
+			name:   "common name",
+			config: &certutil.Config{CommonName: "front-proxy-ca"},
+			want:   pkix.Name{CommonName: "front-proxy-ca", Organization: []string{"kcp"}},
+		},
+		{
+			name:   "common name and organization",
+			config: &certutil.Config{CommonName: "etcd-ca", Organization: []string{"etcd"}},
+			want:   pkix.Name{CommonName: "etcd-ca", Organization: []string{"etcd"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ca, _, err := NewCA(test.config, KeyConfig{})
+			assert.NoError(t, err)
+			assert.Equal(t, test.want.CommonName, ca.Subject.CommonName)
+			assert.Equal(t, test.want.Organization, ca.Subject.Organization)
+			assert.NotEmpty(t, ca.SubjectKeyId)
+		})
 	}
 }
+
+func TestVerify(t *testing.T) {
+	serverCA, serverKey, err := NewCA(nil, KeyConfig{})
+	assert.NoError(t, err)
+	frontProxyCA, frontProxyKey, err := NewCA(&certutil.Config{CommonName: "front-proxy-ca"}, KeyConfig{})
+	assert.NoError(t, err)
+
+	config := &certutil.Config{
+		CommonName: "kube-apiserver",
+		AltNames: certutil.AltNames{
+			DNSNames: []string{"kubernetes"},
+		},
+		Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	serials := map[string]bool{
+		serverCA.SerialNumber.String():     true,
+		frontProxyCA.SerialNumber.String(): true,
+	}
+	assert.Len(t, serials, 2)
+
+	for i := 0; i < 3; i++ {
+		cert, _, err := NewCertAndKey(serverCA, serverKey, config, KeyConfig{}, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, cert.SerialNumber.Sign())
+		assert.False(t, serials[cert.SerialNumber.String()], "serial number reused")
+		serials[cert.SerialNumber.String()] = true
+		assert.NotEmpty(t, cert.SubjectKeyId)
+		assert.Equal(t, serverCA.SubjectKeyId, cert.AuthorityKeyId)
+
+		roots := x509.NewCertPool()
+		roots.AddCert(serverCA)
+		_, err = cert.Verify(x509.VerifyOptions{
+			DNSName:   "kubernetes",
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		assert.NoError(t, err)
+
+		// a certificate of the server ca is not trusted by the front proxy ca
+		others := x509.NewCertPool()
+		others.AddCert(frontProxyCA)
+		_, err = cert.Verify(x509.VerifyOptions{
+			DNSName:   "kubernetes",
+			Roots:     others,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		assert.Error(t, err)
+	}
+
+	cert, _, err := NewCertAndKey(frontProxyCA, frontProxyKey, &certutil.Config{
+		CommonName: "front-proxy-client",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, KeyConfig{}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, frontProxyCA.SubjectKeyId, cert.AuthorityKeyId)
+	assert.Equal(t, "front-proxy-ca", cert.Issuer.CommonName)
+}
+
+func TestValidateCA(t *testing.T) {
+	// a corporate root and an intermediate issued by it, as handed out to a tenant
+	root, rootKey := newTestCA(t, "corporate-root", nil, nil)
+	intermediate, intermediateKey := newTestCA(t, "tenant-intermediate", root, rootKey)
+
+	leaf, leafKey, err := NewCertAndKey(intermediate, intermediateKey, &certutil.Config{
+		CommonName: "leaf",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, KeyConfig{}, 0)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		key     crypto.Signer
+		wantErr bool
+	}{
+		{name: "root", cert: root, key: rootKey},
+		{name: "intermediate", cert: intermediate, key: intermediateKey},
+		{name: "mismatched key", cert: intermediate, key: rootKey, wantErr: true},
+		{name: "not a ca", cert: leaf, key: leafKey, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateCA(test.cert, test.key)
+			assert.Equal(t, test.wantErr, err != nil, err)
+		})
+	}
+
+	// leaves signed by the intermediate chain to the corporate root
+	cert, _, err := NewCertAndKey(intermediate, intermediateKey, &certutil.Config{
+		CommonName: "kube-apiserver",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, KeyConfig{}, 0)
+	assert.NoError(t, err)
+	assert.False(t, cert.NotAfter.After(intermediate.NotAfter))
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate)
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	assert.NoError(t, err)
+}
+
+// newTestCA creates a certificate authority signed by the parent, self-signed if the parent is nil,
+// which is allowed to issue intermediate certificate authorities.
+func newTestCA(t *testing.T, commonName string, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := NewPrivateKey(KeyConfig{Algorithm: KeyAlgorithmECDSA})
+	assert.NoError(t, err)
+	serial, err := newSerialNumber()
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(DefaultCertValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert, key
+}
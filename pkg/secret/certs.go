@@ -18,8 +18,6 @@ package secret
 
 import (
 	"crypto"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -27,17 +25,6 @@ import (
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
-const (
-	// DefaultRSAKeySize is the default key size used when created RSA keys.
-	DefaultRSAKeySize = 2048
-)
-
-// NewPrivateKey creates an RSA private key.
-func NewPrivateKey() (*rsa.PrivateKey, error) {
-	pk, err := rsa.GenerateKey(rand.Reader, DefaultRSAKeySize)
-	return pk, err
-}
-
 // EncodeCertPEM returns PEM-endcoded certificate data.
 func EncodeCertPEM(cert *x509.Certificate) []byte {
 	block := pem.Block{
@@ -47,18 +34,33 @@ func EncodeCertPEM(cert *x509.Certificate) []byte {
 	return pem.EncodeToMemory(&block)
 }
 
-// EncodePrivateKeyPEM returns PEM-encoded private key data.
-func EncodePrivateKeyPEM(key *rsa.PrivateKey) []byte {
+// EncodeCertsPEM returns the PEM-encoded certificates concatenated, e.g. a bundle of trusted
+// certificate authorities.
+func EncodeCertsPEM(certs ...*x509.Certificate) []byte {
+	var encoded []byte
+	for _, cert := range certs {
+		encoded = append(encoded, EncodeCertPEM(cert)...)
+	}
+	return encoded
+}
+
+// EncodePrivateKeyPEM returns PEM-encoded PKCS #8 private key data, which covers RSA, ECDSA
+// and Ed25519 keys.
+func EncodePrivateKeyPEM(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
 	block := pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(key),
+		Type:  "PRIVATE KEY",
+		Bytes: der,
 	}
 
-	return pem.EncodeToMemory(&block)
+	return pem.EncodeToMemory(&block), nil
 }
 
 // EncodePublicKeyPEM returns PEM-encoded public key data.
-func EncodePublicKeyPEM(key *rsa.PublicKey) ([]byte, error) {
+func EncodePublicKeyPEM(key crypto.PublicKey) ([]byte, error) {
 	der, err := x509.MarshalPKIXPublicKey(key)
 	if err != nil {
 		return []byte{}, err
@@ -81,6 +83,31 @@ func DecodeCertPEM(encoded []byte) (*x509.Certificate, error) {
 	return x509.ParseCertificate(block.Bytes)
 }
 
+// DecodeCertsPEM returns all certificates of the PEM-encoded data, it fails if the data
+// contains no certificate.
+func DecodeCertsPEM(encoded []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, encoded = pem.Decode(encoded)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("unable to decode PEM data")
+	}
+	return certs, nil
+}
+
 // DecodePrivateKeyPEM attempts to return a decoded key or nil
 // if the encoded input does not contain a private key.
 func DecodePrivateKeyPEM(encoded []byte) (crypto.Signer, error) {
@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+)
+
+// KeyAlgorithm is the algorithm of a private key.
+type KeyAlgorithm string
+
+const (
+	KeyAlgorithmRSA     KeyAlgorithm = "RSA"
+	KeyAlgorithmECDSA   KeyAlgorithm = "ECDSA"
+	KeyAlgorithmEd25519 KeyAlgorithm = "Ed25519"
+)
+
+const (
+	// DefaultRSAKeySize is the default key size used when created RSA keys.
+	DefaultRSAKeySize = 2048
+	// DefaultECDSAKeySize is the default curve size used when created ECDSA keys.
+	DefaultECDSAKeySize = 256
+)
+
+// KeyConfig selects the algorithm and size of private keys, the zero value is RSA 2048.
+type KeyConfig struct {
+	// Algorithm is the key algorithm, RSA if empty.
+	Algorithm KeyAlgorithm
+	// Size is the RSA key size in bits, 2048, 3072 or 4096, or the ECDSA curve size,
+	// 256 or 384. Zero is the default size of the algorithm, it is not used for Ed25519.
+	Size int
+}
+
+// Validate returns an error if the algorithm or the size is not supported.
+func (c KeyConfig) Validate() error {
+	switch c.algorithm() {
+	case KeyAlgorithmRSA:
+		switch c.Size {
+		case 0, 2048, 3072, 4096:
+			return nil
+		}
+		return fmt.Errorf("unsupported RSA key size %d, must be 2048, 3072 or 4096", c.Size)
+	case KeyAlgorithmECDSA:
+		if _, err := c.curve(); err != nil {
+			return err
+		}
+		return nil
+	case KeyAlgorithmEd25519:
+		if c.Size != 0 {
+			return fmt.Errorf("key size is not supported for Ed25519")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key algorithm %q, must be RSA, ECDSA or Ed25519", c.Algorithm)
+}
+
+// Matches returns true if the public key is of the algorithm and size of the config.
+func (c KeyConfig) Matches(pub crypto.PublicKey) bool {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		size := c.Size
+		if size == 0 {
+			size = DefaultRSAKeySize
+		}
+		return c.algorithm() == KeyAlgorithmRSA && key.N.BitLen() == size
+	case *ecdsa.PublicKey:
+		curve, err := c.curve()
+		return c.algorithm() == KeyAlgorithmECDSA && err == nil && key.Curve == curve
+	case ed25519.PublicKey:
+		return c.algorithm() == KeyAlgorithmEd25519
+	}
+	return false
+}
+
+func (c KeyConfig) algorithm() KeyAlgorithm {
+	if c.Algorithm == "" {
+		return KeyAlgorithmRSA
+	}
+	return c.Algorithm
+}
+
+func (c KeyConfig) curve() (elliptic.Curve, error) {
+	switch c.Size {
+	case 0, 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	}
+	return nil, fmt.Errorf("unsupported ECDSA key size %d, must be 256 or 384", c.Size)
+}
+
+// ServiceAccountKeyConfig returns the key config of the service account signing key. The
+// apiserver signs tokens with RSA or ECDSA keys only, Ed25519 falls back to ECDSA P-256.
+func ServiceAccountKeyConfig(config KeyConfig) KeyConfig {
+	if config.algorithm() == KeyAlgorithmEd25519 {
+		return KeyConfig{Algorithm: KeyAlgorithmECDSA, Size: DefaultECDSAKeySize}
+	}
+	return config
+}
+
+// NewPrivateKey creates a private key of the algorithm and size of the config.
+func NewPrivateKey(config KeyConfig) (crypto.Signer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch config.algorithm() {
+	case KeyAlgorithmECDSA:
+		curve, _ := config.curve()
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case KeyAlgorithmEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		size := config.Size
+		if size == 0 {
+			size = DefaultRSAKeySize
+		}
+		return rsa.GenerateKey(rand.Reader, size)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secret
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+func TestKeyAlgorithms(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    KeyConfig
+		keyUsage  x509.KeyUsage
+		algorithm x509.PublicKeyAlgorithm
+	}{
+		{
+			name:      "default",
+			config:    KeyConfig{},
+			keyUsage:  x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+			algorithm: x509.RSA,
+		},
+		{
+			name:      "rsa 3072",
+			config:    KeyConfig{Algorithm: KeyAlgorithmRSA, Size: 3072},
+			keyUsage:  x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+			algorithm: x509.RSA,
+		},
+		{
+			name:      "ecdsa p-256",
+			config:    KeyConfig{Algorithm: KeyAlgorithmECDSA},
+			keyUsage:  x509.KeyUsageDigitalSignature,
+			algorithm: x509.ECDSA,
+		},
+		{
+			name:      "ecdsa p-384",
+			config:    KeyConfig{Algorithm: KeyAlgorithmECDSA, Size: 384},
+			keyUsage:  x509.KeyUsageDigitalSignature,
+			algorithm: x509.ECDSA,
+		},
+		{
+			name:      "ed25519",
+			config:    KeyConfig{Algorithm: KeyAlgorithmEd25519},
+			keyUsage:  x509.KeyUsageDigitalSignature,
+			algorithm: x509.Ed25519,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ca, caKey, err := NewCA(nil, test.config)
+			assert.NoError(t, err)
+			assert.True(t, test.config.Matches(ca.PublicKey))
+
+			cert, key, err := NewCertAndKey(ca, caKey, &certutil.Config{
+				CommonName: "test",
+				Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}, test.config, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, test.algorithm, cert.PublicKeyAlgorithm)
+			assert.Equal(t, test.keyUsage, cert.KeyUsage)
+			assert.True(t, test.config.Matches(cert.PublicKey))
+
+			roots := x509.NewCertPool()
+			roots.AddCert(ca)
+			_, err = cert.Verify(x509.VerifyOptions{
+				Roots:     roots,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+			assert.NoError(t, err)
+
+			// keys round trip through PKCS #8
+			encodedKey, err := EncodePrivateKeyPEM(key)
+			assert.NoError(t, err)
+			assert.Contains(t, string(encodedKey), "BEGIN PRIVATE KEY")
+			decodedKey, err := DecodePrivateKeyPEM(encodedKey)
+			assert.NoError(t, err)
+			assert.True(t, test.config.Matches(decodedKey.Public()))
+		})
+	}
+}
+
+func TestKeyConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  KeyConfig
+		wantErr bool
+	}{
+		{name: "default", config: KeyConfig{}},
+		{name: "rsa 4096", config: KeyConfig{Algorithm: KeyAlgorithmRSA, Size: 4096}},
+		{name: "rsa 1024", config: KeyConfig{Algorithm: KeyAlgorithmRSA, Size: 1024}, wantErr: true},
+		{name: "ecdsa p-384", config: KeyConfig{Algorithm: KeyAlgorithmECDSA, Size: 384}},
+		{name: "ecdsa p-521", config: KeyConfig{Algorithm: KeyAlgorithmECDSA, Size: 521}, wantErr: true},
+		{name: "ed25519 with size", config: KeyConfig{Algorithm: KeyAlgorithmEd25519, Size: 256}, wantErr: true},
+		{name: "unknown", config: KeyConfig{Algorithm: "DSA"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			assert.Equal(t, test.wantErr, err != nil, err)
+		})
+	}
+}
+
+func TestServiceAccountKeyConfig(t *testing.T) {
+	for _, config := range []KeyConfig{
+		{},
+		{Algorithm: KeyAlgorithmECDSA, Size: 384},
+		{Algorithm: KeyAlgorithmEd25519},
+	} {
+		saConfig := ServiceAccountKeyConfig(config)
+		// the apiserver signs service account tokens with RSA and ECDSA keys only
+		assert.NotEqual(t, KeyAlgorithmEd25519, saConfig.algorithm())
+
+		pub, key, err := NewPubAndKey(saConfig)
+		assert.NoError(t, err)
+		assert.True(t, saConfig.Matches(key.Public()))
+		_, err = EncodePublicKeyPEM(pub)
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+)
+
+const (
+	// DefaultVersion is the Kubernetes version used when a tenant does not specify one.
+	DefaultVersion = "v1.23.4"
+	// DefaultImageRepository is the registry used when a tenant does not specify one.
+	DefaultImageRepository = "k8s.gcr.io"
+	// EtcdVersion is the version of the etcd provisioned for tenants in dedicated etcd mode.
+	EtcdVersion = "3.5.1-0"
+)
+
+// versionRegexp matches versions in the form v<major>.<minor>[.<patch>].
+var versionRegexp = regexp.MustCompile(`^v?[0-9]+\.[0-9]+(\.[0-9]+)?$`)
+
+// supportedVersions maps each supported minor version to the patch release used
+// when a tenant only specifies the minor version.
+var supportedVersions = map[string]string{
+	"1.21": "v1.21.12",
+	"1.22": "v1.22.9",
+	"1.23": "v1.23.4",
+}
+
+// SupportedMinorVersions returns the supported minor versions in ascending order.
+func SupportedMinorVersions() []string {
+	result := make([]string, 0, len(supportedVersions))
+	for minor := range supportedVersions {
+		result = append(result, "v"+minor)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return utilversion.MustParseGeneric(result[i]).LessThan(utilversion.MustParseGeneric(result[j]))
+	})
+	return result
+}
+
+// Resolve validates the requested version against the supported versions and returns
+// the full version to deploy, e.g. v1.22 resolves to v1.22.9. An empty version resolves
+// to DefaultVersion.
+func Resolve(version string) (string, error) {
+	if version == "" {
+		return DefaultVersion, nil
+	}
+
+	if !versionRegexp.MatchString(version) {
+		return "", fmt.Errorf("invalid version %q, must be in the form v<major>.<minor>[.<patch>]", version)
+	}
+	v, err := utilversion.ParseGeneric(version)
+	if err != nil {
+		return "", fmt.Errorf("invalid version %q: %v", version, err)
+	}
+
+	minor := fmt.Sprintf("%d.%d", v.Major(), v.Minor())
+	defaultPatch, ok := supportedVersions[minor]
+	if !ok {
+		return "", fmt.Errorf("unsupported version %q, supported versions are %s",
+			version, strings.Join(SupportedMinorVersions(), ", "))
+	}
+	if len(v.Components()) == 2 {
+		return defaultPatch, nil
+	}
+	return fmt.Sprintf("v%d.%d.%d", v.Major(), v.Minor(), v.Patch()), nil
+}
+
+// Image returns the image reference of a control-plane component, e.g. kube-apiserver,
+// for the given repository and resolved version.
+func Image(repository, component, version string) string {
+	if repository == "" {
+		repository = DefaultImageRepository
+	}
+	return strings.TrimSuffix(repository, "/") + "/" + component + ":" + version
+}
+
+// EtcdImage returns the image reference of etcd for the given repository.
+func EtcdImage(repository string) string {
+	return Image(repository, "etcd", EtcdVersion)
+}
+
+// ValidateUpgrade checks whether a control plane running version from may be upgraded
+// to version to. Downgrades are refused, and upgrades must move one minor version at a
+// time so the version skew between control-plane components never exceeds one minor.
+func ValidateUpgrade(from, to string) error {
+	fromVersion, err := utilversion.ParseGeneric(from)
+	if err != nil {
+		return fmt.Errorf("invalid version %q: %v", from, err)
+	}
+	toVersion, err := utilversion.ParseGeneric(to)
+	if err != nil {
+		return fmt.Errorf("invalid version %q: %v", to, err)
+	}
+
+	if toVersion.LessThan(fromVersion) {
+		return fmt.Errorf("downgrade from %s to %s is not supported", from, to)
+	}
+	if toVersion.Major() != fromVersion.Major() || toVersion.Minor() > fromVersion.Minor()+1 {
+		return fmt.Errorf("upgrade from %s to %s skips minor versions, upgrade one minor version at a time", from, to)
+	}
+	return nil
+}
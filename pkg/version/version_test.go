@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", version: "", want: DefaultVersion},
+		{name: "minor only", version: "v1.22", want: "v1.22.9"},
+		{name: "minor without prefix", version: "1.21", want: "v1.21.12"},
+		{name: "full version", version: "v1.23.1", want: "v1.23.1"},
+		{name: "unsupported minor", version: "v1.19.0", wantErr: true},
+		{name: "pre-release", version: "v1.23.0-rc.1", wantErr: true},
+		{name: "invalid", version: "latest", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Resolve(test.version)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestImage(t *testing.T) {
+	assert.Equal(t, "k8s.gcr.io/kube-apiserver:v1.23.4", Image("", "kube-apiserver", "v1.23.4"))
+	assert.Equal(t, "registry.example.com/k8s/kube-controller-manager:v1.22.9",
+		Image("registry.example.com/k8s/", "kube-controller-manager", "v1.22.9"))
+	assert.Equal(t, "k8s.gcr.io/etcd:"+EtcdVersion, EtcdImage(""))
+}
+
+func TestSupportedMinorVersions(t *testing.T) {
+	assert.Equal(t, []string{"v1.21", "v1.22", "v1.23"}, SupportedMinorVersions())
+}
+
+func TestValidateUpgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		wantErr bool
+	}{
+		{name: "same version", from: "v1.22.9", to: "v1.22.9"},
+		{name: "patch upgrade", from: "v1.22.1", to: "v1.22.9"},
+		{name: "minor upgrade", from: "v1.22.9", to: "v1.23.4"},
+		{name: "patch downgrade", from: "v1.23.4", to: "v1.23.1", wantErr: true},
+		{name: "minor downgrade", from: "v1.23.4", to: "v1.22.9", wantErr: true},
+		{name: "skip minor", from: "v1.21.12", to: "v1.23.4", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateUpgrade(test.from, test.to)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}